@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"dominfo/utils"
+
+	"github.com/fatih/color"
+)
+
+// runCommand runs a non-interactive subcommand and exits with its status code
+func runCommand(args []string) {
+	switch args[0] {
+	case "certs":
+		os.Exit(runCertsCommand(args[1:]))
+	case "vulndb":
+		os.Exit(runVulnDBCommand(args[1:]))
+	default:
+		color.Red("error: unknown command %s", args[0])
+		os.Exit(2)
+	}
+}
+
+// runCertsCommand checks certificate expiry for the domains given as arguments or in a file
+func runCertsCommand(args []string) int {
+	fs := flag.NewFlagSet("certs", flag.ContinueOnError)
+	file := fs.String("file", "", "File with one host[:port] [sni] entry per line")
+	fs.IntVar(&utils.CertExpiryWarnDays, "warn", utils.CertExpiryWarnDays, "Days before expiry that trigger a warning")
+	fs.IntVar(&utils.CertExpiryCriticalDays, "critical", utils.CertExpiryCriticalDays, "Days before expiry that are critical")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: dominfo certs [-warn days] [-critical days] [-file list] [host[:port][,sni] ...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return utils.CertExitUnknown
+	}
+
+	var targets []utils.TLSTarget
+	if *file != "" {
+		fileTargets, err := utils.LoadCertTargets(*file)
+		if err != nil {
+			color.Red("error: could not read %s: %s", *file, err)
+			return utils.CertExitUnknown
+		}
+		targets = append(targets, fileTargets...)
+	}
+	// On the command line the SNI is separated by a comma so that entries need no quoting
+	for _, arg := range fs.Args() {
+		target, err := utils.ParseCertTarget(strings.Replace(arg, ",", " ", 1))
+		if err != nil {
+			color.Red("error: %s", err)
+			return utils.CertExitUnknown
+		}
+		targets = append(targets, target)
+	}
+
+	report, code, err := utils.GetCertExpiryReport(targets)
+	if err != nil {
+		color.Red("error: %s", err)
+		fs.Usage()
+		return code
+	}
+	fmt.Println(report)
+	return code
+}
+
+// runVulnDBCommand converts NVD JSON feeds into a dataset that can be passed to --vuln-db
+func runVulnDBCommand(args []string) int {
+	fs := flag.NewFlagSet("vulndb", flag.ContinueOnError)
+	output := fs.String("out", "vulndb.json", "Dataset file to create or merge into")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: dominfo vulndb [-out dataset.json] feed.json [feed.json ...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	products, cves, err := utils.ImportVulnerabilityData(*output, fs.Args())
+	if err != nil {
+		color.Red("error: %s", err)
+		return 1
+	}
+	fmt.Printf("%s: %d products, %d CVE entries\n", *output, products, cves)
+	return 0
+}
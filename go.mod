@@ -7,6 +7,7 @@ require (
 	github.com/fatih/color v1.17.0
 	github.com/miekg/dns v1.1.61
 	github.com/olekukonko/tablewriter v0.0.5
+	golang.org/x/net v0.26.0
 )
 
 require (
@@ -14,7 +15,6 @@ require (
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mattn/go-runewidth v0.0.9 // indirect
 	golang.org/x/mod v0.18.0 // indirect
-	golang.org/x/net v0.26.0 // indirect
 	golang.org/x/sync v0.7.0 // indirect
 	golang.org/x/sys v0.21.0 // indirect
 	golang.org/x/term v0.21.0 // indirect
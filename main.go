@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"strings"
@@ -15,6 +16,51 @@ import (
 )
 
 func main() {
+	flag.StringVar(&utils.CABundlePath, "ca-bundle", "", "PEM file with trusted CA certificates used instead of the system roots")
+	flag.StringVar(&utils.SSLLabsEmail, "ssllabs-email", utils.SSLLabsEmail, "Email registered with the SSL Labs v4 API (defaults to $SSLLABS_EMAIL)")
+	flag.IntVar(&utils.CertExpiryWarnDays, "cert-warn-days", utils.CertExpiryWarnDays, "Days before certificate expiry that trigger a warning")
+	flag.IntVar(&utils.CertExpiryCriticalDays, "cert-critical-days", utils.CertExpiryCriticalDays, "Days before certificate expiry that are critical")
+	flag.StringVar(&utils.DiscoveryWordlist, "wordlist", "", "File with extra paths for the sensitive file discovery, one per line")
+	flag.IntVar(&utils.DiscoveryConcurrency, "discovery-concurrency", utils.DiscoveryConcurrency, "Parallel requests of the sensitive file discovery")
+	flag.Float64Var(&utils.DiscoveryRate, "discovery-rate", utils.DiscoveryRate, "Requests per second of the sensitive file discovery, 0 for no limit")
+	flag.StringVar(&utils.TechRulesPath, "tech-rules", "", "Technology fingerprint rules file in the Wappalyzer format, merged over the built-in rules")
+	flag.StringVar(&utils.VulnDBPaths, "vuln-db", "", "Comma separated vulnerability datasets or NVD JSON feeds, merged over the built-in dataset")
+	flag.StringVar(&utils.FaviconDBPath, "favicon-db", "", "Known favicon database in JSON, product names mapped to mmh3, md5 and html structure hashes")
+	flag.StringVar(&utils.PortSpec, "ports", "", "Ports to scan: numbers, ranges and profiles (common, web, db, mail, remote-admin), like 1-1024,8080,web")
+	flag.IntVar(&utils.TopPorts, "top-ports", 0, "Scan the N most frequent ports of the services file, like 100 or 1000")
+	flag.StringVar(&utils.ServicesFile, "services-file", "", "Port to service map in the nmap-services format used instead of the bundled one")
+	flag.DurationVar(&utils.PortTimeout, "port-timeout", utils.PortTimeout, "Connect timeout of the port scan")
+	flag.IntVar(&utils.PortConcurrency, "port-concurrency", utils.PortConcurrency, "Parallel connections of the port scan")
+	flag.IntVar(&utils.PortRetries, "port-retries", utils.PortRetries, "Extra attempts for ports that time out")
+	flag.BoolVar(&utils.ServiceDetection, "service-detection", utils.ServiceDetection, "Probe open ports to identify the service and version behind them")
+	flag.StringVar(&utils.ServiceProbesFile, "service-probes", "", "Service probes and match signatures in the nmap-service-probes format used instead of the bundled ones")
+	flag.DurationVar(&utils.ProbeTimeout, "probe-timeout", utils.ProbeTimeout, "Timeout of each service detection probe")
+	flag.BoolVar(&utils.UDPScan, "udp", utils.UDPScan, "Probe DNS, NTP, SNMP, IKE, SSDP, memcached, NetBIOS, mDNS and TFTP over UDP during the port scan")
+	flag.DurationVar(&utils.UDPTimeout, "udp-timeout", utils.UDPTimeout, "Wait for a UDP answer before a port counts as open|filtered")
+	flag.StringVar(&utils.ExcludeSpec, "exclude", "", "Comma separated addresses, CIDR blocks and ranges that are never scanned")
+	flag.StringVar(&utils.ExcludeFile, "exclude-file", "", "File with addresses, CIDR blocks and ranges that are never scanned, one per line")
+	flag.IntVar(&utils.MaxTargets, "max-targets", utils.MaxTargets, "Largest number of addresses a CIDR block or range may expand to")
+	flag.Float64Var(&utils.ScanRate, "scan-rate", utils.ScanRate, "Connections and packets per second over the port, UDP, TLS and blacklist scans, 0 for no limit")
+	flag.Parse()
+
+	// Mistakes in the port selection, probe file and exclusions are reported before the menu rather than during a scan
+	if _, err := utils.SelectedPorts(); err != nil {
+		color.Red("error: %s", err)
+		os.Exit(2)
+	}
+	if _, err := utils.ServiceProbes(); err != nil {
+		color.Red("error: %s", err)
+		os.Exit(2)
+	}
+	if _, err := utils.Exclusions(); err != nil {
+		color.Red("error: %s", err)
+		os.Exit(2)
+	}
+
+	if flag.NArg() > 0 {
+		runCommand(flag.Args())
+	}
+
 	showBanner()
 	for {
 		showMenu()
@@ -33,12 +79,21 @@ func showMenu() {
 	fmt.Println("\n=== Domain Information Tool ===")
 	fmt.Println("1. Basic Scan (Whois,SSL-Lab,Dns Records,DnsSEC etc.)")
 	fmt.Println("2. Multi Port Scanner (Web,Sql,Ftp,SSH etc.)")
-	fmt.Println("3. Security Headers Detection")
+	fmt.Println("3. Security Headers Detection (CSP,Cookies,Redirects,CORS)")
 	fmt.Println("4. Subdomain Scanner (Top 100 Subdomain)")
 	fmt.Println("5. Waf Detection")
 	fmt.Println("6. Blacklist Check")
 	fmt.Println("7. Detect Server Technologies")
 	fmt.Println("8. Full Scan (It may take time.)")
+	fmt.Println("9. Mail Server Check (SMTP,STARTTLS,DANE,Open Relay)")
+	fmt.Println("10. Local TLS Scan (Protocols,Ciphers,Grade)")
+	fmt.Println("11. TLS Vulnerability Probes (Heartbleed,ROBOT,CCS,Renegotiation etc.)")
+	fmt.Println("12. TLS Services Scan (All TLS and STARTTLS Ports)")
+	fmt.Println("13. Certificate Expiry Check (Multiple Domains)")
+	fmt.Println("14. TLS Fingerprinting and Host Clustering (JARM)")
+	fmt.Println("15. HTTP Methods Check (OPTIONS,TRACE,PUT,WebDAV)")
+	fmt.Println("16. Well-Known Resources (security.txt,robots.txt,Sitemaps)")
+	fmt.Println("17. Sensitive File Discovery (.git,.env,Backups,Admin Panels)")
 	fmt.Println("0. Exit")
 	fmt.Print("\nPlease enter your choice: ")
 }
@@ -70,6 +125,24 @@ func handleChoice(choice int) {
 		startServerTechScan()
 	case 8:
 		startFullScan()
+	case 9:
+		startMailServerCheck()
+	case 10:
+		startTLSScan()
+	case 11:
+		startTLSVulnScan()
+	case 12:
+		startTLSServicesScan()
+	case 13:
+		startCertExpiryCheck()
+	case 14:
+		startTLSFingerprinting()
+	case 15:
+		startHTTPMethodsCheck()
+	case 16:
+		startWellKnownCheck()
+	case 17:
+		startDiscoveryScan()
 	case 0:
 		fmt.Println("Exiting...")
 		os.Exit(0)
@@ -85,6 +158,47 @@ func getDomainFromUser() string {
 	return strings.TrimSpace(domain)
 }
 
+// getScanTargetFromUser reads a domain or comma separated IP addresses, CIDR blocks and ranges
+func getScanTargetFromUser() string {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Print("\nPlease enter the domain, IP, CIDR block or range (e.g. example.com, 192.0.2.0/24, 192.0.2.1-50): ")
+	target, _ := reader.ReadString('\n')
+	return strings.TrimSpace(target)
+}
+
+// getTargetsFromUser reads a domain list file name or comma separated host[:port] [sni] entries
+func getTargetsFromUser() ([]utils.TLSTarget, error) {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Print("\nPlease enter a domain list file or comma separated host[:port] [sni] entries: ")
+	input, _ := reader.ReadString('\n')
+	input = strings.TrimSpace(input)
+
+	if _, err := os.Stat(input); err == nil {
+		return utils.LoadCertTargets(input)
+	}
+
+	var targets []utils.TLSTarget
+	for _, entry := range strings.Split(input, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		target, err := utils.ParseCertTarget(entry)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func getConfirmationFromUser(question string) bool {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Printf("%s (y/N): ", question)
+	answer, _ := reader.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
 func startBasicScan() {
 	domain := getDomainFromUser()
 	if !utils.IsValidDomain(domain) {
@@ -160,6 +274,15 @@ func startBasicScan() {
 			}
 			resultCh <- dnsSecCheck
 		},
+		func() {
+			defer wg.Done()
+			caaCheck, err := utils.GetCAAReport(domain)
+			if err != nil {
+				errorCh <- fmt.Errorf("error: could not check CAA records: %s", err)
+				return
+			}
+			resultCh <- caaCheck
+		},
 	}
 
 	for _, scanFunc := range scanFunctions {
@@ -182,9 +305,9 @@ func startBasicScan() {
 }
 
 func startPortScan() {
-	domain := getDomainFromUser()
-	if !utils.IsValidDomain(domain) {
-		color.Red("\nerror: invalid domain %s\n", domain)
+	target := getScanTargetFromUser()
+	if !utils.IsValidTarget(target) {
+		color.Red("\nerror: invalid domain or address %s\n", target)
 		return
 	}
 
@@ -194,7 +317,7 @@ func startPortScan() {
 	time.Sleep(3 * time.Second)
 	s.Stop()
 
-	portScanResults := fmt.Sprintf("\n%s\n%s", color.New(color.FgYellow, color.Bold).Sprint("Open Ports:"), utils.PortScan(domain))
+	portScanResults := fmt.Sprintf("\n%s\n%s", color.New(color.FgYellow, color.Bold).Sprint("Open Ports:"), utils.PortScan(target))
 
 	utils.ClearScreen()
 	fmt.Println(portScanResults)
@@ -218,9 +341,14 @@ func startSecurityHeadersScan() {
 		color.Red("error: %s", err)
 		return
 	}
+	cors, err := utils.GetCORSReport(domain)
+	if err != nil {
+		color.Red("error: could not check CORS: %s", err)
+	}
 
 	utils.ClearScreen()
 	fmt.Println(headers)
+	fmt.Println(cors)
 }
 
 func startSubdomainScan() {
@@ -275,9 +403,9 @@ func startWAFScan() {
 }
 
 func startBlacklistCheck() {
-	domain := getDomainFromUser()
-	if !utils.IsValidDomain(domain) {
-		color.Red("\nerror: invalid domain %s\n", domain)
+	target := getScanTargetFromUser()
+	if !utils.IsValidTarget(target) {
+		color.Red("\nerror: invalid domain or address %s\n", target)
 		return
 	}
 
@@ -287,7 +415,7 @@ func startBlacklistCheck() {
 	time.Sleep(3 * time.Second)
 	s.Stop()
 
-	blacklistCheck, err := utils.CheckBlacklist(domain)
+	blacklistCheck, err := utils.CheckBlacklist(target)
 	if err != nil {
 		color.Red("error: could not check blacklist: %s", err)
 		return
@@ -320,6 +448,214 @@ func startServerTechScan() {
 	fmt.Println(serverTech)
 }
 
+func startMailServerCheck() {
+	domain := getDomainFromUser()
+	if !utils.IsValidDomain(domain) {
+		color.Red("\nerror: invalid domain %s\n", domain)
+		return
+	}
+	relayTest := getConfirmationFromUser("Run the non-destructive open relay test?")
+
+	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
+	s.Start()
+	color.New(color.FgGreen, color.Bold).Println("\nStarting Mail Server check...")
+	time.Sleep(3 * time.Second)
+	s.Stop()
+
+	mailServers, err := utils.CheckMailServers(domain, relayTest)
+	if err != nil {
+		color.Red("error: could not check mail servers: %s", err)
+		return
+	}
+
+	utils.ClearScreen()
+	fmt.Println(mailServers)
+}
+
+func startTLSScan() {
+	target := getScanTargetFromUser()
+	if !utils.IsValidTarget(target) {
+		color.Red("\nerror: invalid domain or address %s\n", target)
+		return
+	}
+
+	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
+	s.Start()
+	color.New(color.FgGreen, color.Bold).Println("\nStarting TLS scan...")
+	time.Sleep(3 * time.Second)
+	s.Stop()
+
+	tlsScan, err := utils.GetTLSScanReport(target)
+	if err != nil {
+		color.Red("error: could not scan TLS configuration: %s", err)
+		return
+	}
+
+	utils.ClearScreen()
+	fmt.Println(tlsScan)
+}
+
+func startTLSVulnScan() {
+	target := getScanTargetFromUser()
+	if !utils.IsValidTarget(target) {
+		color.Red("\nerror: invalid domain or address %s\n", target)
+		return
+	}
+
+	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
+	s.Start()
+	color.New(color.FgGreen, color.Bold).Println("\nStarting TLS vulnerability probes...")
+	time.Sleep(3 * time.Second)
+	s.Stop()
+
+	tlsVulns, err := utils.GetTLSVulnerabilityReport(target)
+	if err != nil {
+		color.Red("error: could not probe TLS vulnerabilities: %s", err)
+		return
+	}
+
+	utils.ClearScreen()
+	fmt.Println(tlsVulns)
+}
+
+func startTLSServicesScan() {
+	target := getScanTargetFromUser()
+	if !utils.IsValidTarget(target) {
+		color.Red("\nerror: invalid domain or address %s\n", target)
+		return
+	}
+
+	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
+	s.Start()
+	color.New(color.FgGreen, color.Bold).Println("\nStarting TLS services scan...")
+	time.Sleep(3 * time.Second)
+	s.Stop()
+
+	tlsServices, err := utils.GetTLSServicesReport(target)
+	if err != nil {
+		color.Red("error: could not scan TLS services: %s", err)
+		return
+	}
+
+	utils.ClearScreen()
+	fmt.Println(tlsServices)
+}
+
+func startCertExpiryCheck() {
+	targets, err := getTargetsFromUser()
+	if err != nil {
+		color.Red("\nerror: %s\n", err)
+		return
+	}
+
+	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
+	s.Start()
+	color.New(color.FgGreen, color.Bold).Println("\nStarting certificate expiry check...")
+	time.Sleep(3 * time.Second)
+	s.Stop()
+
+	certExpiry, _, err := utils.GetCertExpiryReport(targets)
+	if err != nil {
+		color.Red("error: could not check certificate expiry: %s", err)
+		return
+	}
+
+	utils.ClearScreen()
+	fmt.Println(certExpiry)
+}
+
+func startTLSFingerprinting() {
+	targets, err := getTargetsFromUser()
+	if err != nil {
+		color.Red("\nerror: %s\n", err)
+		return
+	}
+
+	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
+	s.Start()
+	color.New(color.FgGreen, color.Bold).Println("\nStarting TLS fingerprinting...")
+	time.Sleep(3 * time.Second)
+	s.Stop()
+
+	fingerprints, err := utils.GetTLSFingerprintReport(targets)
+	if err != nil {
+		color.Red("error: could not fingerprint TLS hosts: %s", err)
+		return
+	}
+
+	utils.ClearScreen()
+	fmt.Println(fingerprints)
+}
+
+func startHTTPMethodsCheck() {
+	domain := getDomainFromUser()
+	if !utils.IsValidDomain(domain) {
+		color.Red("\nerror: invalid domain %s\n", domain)
+		return
+	}
+
+	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
+	s.Start()
+	color.New(color.FgGreen, color.Bold).Println("\nStarting HTTP methods check...")
+	time.Sleep(3 * time.Second)
+	s.Stop()
+
+	methods, err := utils.GetHTTPMethodsReport(domain)
+	if err != nil {
+		color.Red("error: could not check HTTP methods: %s", err)
+		return
+	}
+
+	utils.ClearScreen()
+	fmt.Println(methods)
+}
+
+func startWellKnownCheck() {
+	domain := getDomainFromUser()
+	if !utils.IsValidDomain(domain) {
+		color.Red("\nerror: invalid domain %s\n", domain)
+		return
+	}
+
+	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
+	s.Start()
+	color.New(color.FgGreen, color.Bold).Println("\nStarting well-known resources check...")
+	time.Sleep(3 * time.Second)
+	s.Stop()
+
+	wellKnown, err := utils.GetWellKnownReport(domain)
+	if err != nil {
+		color.Red("error: could not check well-known resources: %s", err)
+		return
+	}
+
+	utils.ClearScreen()
+	fmt.Println(wellKnown)
+}
+
+func startDiscoveryScan() {
+	domain := getDomainFromUser()
+	if !utils.IsValidDomain(domain) {
+		color.Red("\nerror: invalid domain %s\n", domain)
+		return
+	}
+
+	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
+	s.Start()
+	color.New(color.FgGreen, color.Bold).Println("\nStarting sensitive file discovery...")
+	time.Sleep(3 * time.Second)
+	s.Stop()
+
+	discovery, err := utils.GetDiscoveryReport(domain)
+	if err != nil {
+		color.Red("error: could not discover files: %s", err)
+		return
+	}
+
+	utils.ClearScreen()
+	fmt.Println(discovery)
+}
+
 func startFullScan() {
 	domain := getDomainFromUser()
 	if !utils.IsValidDomain(domain) {
@@ -391,6 +727,42 @@ func startFullScan() {
 			}
 			resultCh <- headers
 		},
+		func() {
+			defer wg.Done()
+			cors, err := utils.GetCORSReport(domain)
+			if err != nil {
+				errorCh <- fmt.Errorf("error: could not check CORS: %s", err)
+				return
+			}
+			resultCh <- cors
+		},
+		func() {
+			defer wg.Done()
+			methods, err := utils.GetHTTPMethodsReport(domain)
+			if err != nil {
+				errorCh <- fmt.Errorf("error: could not check HTTP methods: %s", err)
+				return
+			}
+			resultCh <- methods
+		},
+		func() {
+			defer wg.Done()
+			wellKnown, err := utils.GetWellKnownReport(domain)
+			if err != nil {
+				errorCh <- fmt.Errorf("error: could not check well-known resources: %s", err)
+				return
+			}
+			resultCh <- wellKnown
+		},
+		func() {
+			defer wg.Done()
+			discovery, err := utils.GetDiscoveryReport(domain)
+			if err != nil {
+				errorCh <- fmt.Errorf("error: could not discover files: %s", err)
+				return
+			}
+			resultCh <- discovery
+		},
 		func() {
 			defer wg.Done()
 			subdomains, err := utils.GetSubdomains(domain)
@@ -431,6 +803,15 @@ func startFullScan() {
 			}
 			resultCh <- dnsSecCheck
 		},
+		func() {
+			defer wg.Done()
+			caaCheck, err := utils.GetCAAReport(domain)
+			if err != nil {
+				errorCh <- fmt.Errorf("error: could not check CAA records: %s", err)
+				return
+			}
+			resultCh <- caaCheck
+		},
 		func() {
 			defer wg.Done()
 			blacklistCheck, err := utils.CheckBlacklist(domain)
@@ -449,6 +830,42 @@ func startFullScan() {
 			}
 			resultCh <- serverTech
 		},
+		func() {
+			defer wg.Done()
+			tlsScan, err := utils.GetTLSScanReport(domain)
+			if err != nil {
+				errorCh <- fmt.Errorf("error: could not scan TLS configuration: %s", err)
+				return
+			}
+			resultCh <- tlsScan
+		},
+		func() {
+			defer wg.Done()
+			tlsVulns, err := utils.GetTLSVulnerabilityReport(domain)
+			if err != nil {
+				errorCh <- fmt.Errorf("error: could not probe TLS vulnerabilities: %s", err)
+				return
+			}
+			resultCh <- tlsVulns
+		},
+		func() {
+			defer wg.Done()
+			tlsServices, err := utils.GetTLSServicesReport(domain)
+			if err != nil {
+				errorCh <- fmt.Errorf("error: could not scan TLS services: %s", err)
+				return
+			}
+			resultCh <- tlsServices
+		},
+		func() {
+			defer wg.Done()
+			mailServers, err := utils.CheckMailServers(domain, false)
+			if err != nil {
+				errorCh <- fmt.Errorf("error: could not check mail servers: %s", err)
+				return
+			}
+			resultCh <- mailServers
+		},
 	}
 
 	for _, scanFunc := range scanFunctions {
@@ -95,12 +95,12 @@ var resolver = &net.Resolver{
 	},
 }
 
-// CheckBlacklist, belirtilen domain ve IP adreslerinin kara listede olup olmadığını kontrol eder
+// CheckBlacklist, belirtilen domain, IP, CIDR blok veya IP aralığının adreslerinin kara listede olup olmadığını kontrol eder
 func CheckBlacklist(domain string) (string, error) {
 	var results []string
 
 	// IP adresleri için kara liste kontrolü yap
-	ips, err := net.LookupIP(domain)
+	ips, err := ResolveTargets(domain)
 	if err != nil {
 		return "", fmt.Errorf("error resolving domain %s: %v", domain, err)
 	}
@@ -113,10 +113,6 @@ func CheckBlacklist(domain string) (string, error) {
 	concurrencyLimit := make(chan struct{}, 10) // Adjust the limit as needed
 
 	for _, ip := range ips {
-		// Sadece IPv4 adresleri üzerinde çalışalım
-		if ip.To4() == nil {
-			continue
-		}
 		ip := ip.String() // Capture loop variable
 		for name, service := range DNSBL {
 			name, service := name, service // Capture loop variables
@@ -149,7 +145,11 @@ func CheckBlacklist(domain string) (string, error) {
 	}
 
 	if len(results) == 0 {
-		return fmt.Sprintf("\n%s\n%s", color.New(color.FgYellow, color.Bold).Sprint("Blacklist Check:"), "No IP addresses are listed in any known blacklists"), nil
+		checked := make([]string, len(ips))
+		for i, ip := range ips {
+			checked[i] = ip.String()
+		}
+		return fmt.Sprintf("\n%s\n%s (checked %s)", color.New(color.FgYellow, color.Bold).Sprint("Blacklist Check:"), "No IP addresses are listed in any known blacklists", strings.Join(checked, ", ")), nil
 	}
 
 	if len(errChan) > 0 {
@@ -164,6 +164,7 @@ func CheckBlacklist(domain string) (string, error) {
 
 func checkBlacklistService(item, service string) (bool, error) {
 	query := fmt.Sprintf("%s.%s", reverseIP(item), service)
+	waitScanRate()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	_, err := resolver.LookupIP(ctx, "ip", query)
@@ -176,7 +177,16 @@ func checkBlacklistService(item, service string) (bool, error) {
 	return false, err
 }
 
+// reverseIP returns the DNSBL query name of an address: reversed octets for IPv4, reversed nibbles for IPv6
 func reverseIP(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		const hex = "0123456789abcdef"
+		nibbles := make([]string, 0, 32)
+		for i := len(parsed) - 1; i >= 0; i-- {
+			nibbles = append(nibbles, string(hex[parsed[i]&0x0f]), string(hex[parsed[i]>>4]))
+		}
+		return strings.Join(nibbles, ".")
+	}
 	parts := strings.Split(ip, ".")
 	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
 		parts[i], parts[j] = parts[j], parts[i]
@@ -0,0 +1,338 @@
+package utils
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/miekg/dns"
+	"github.com/olekukonko/tablewriter"
+)
+
+// caaIssuerNames maps the issuer domain names used in CAA records to names found in the issuer of certificates of that CA
+var caaIssuerNames = map[string][]string{
+	"letsencrypt.org":      {"Let's Encrypt", "ISRG"},
+	"pki.goog":             {"Google Trust Services"},
+	"digicert.com":         {"DigiCert", "Thawte", "GeoTrust", "RapidSSL", "Symantec", "Encryption Everywhere"},
+	"symantec.com":         {"Symantec", "DigiCert"},
+	"thawte.com":           {"Thawte", "DigiCert"},
+	"geotrust.com":         {"GeoTrust", "DigiCert"},
+	"rapidssl.com":         {"RapidSSL", "DigiCert"},
+	"sectigo.com":          {"Sectigo", "COMODO"},
+	"comodoca.com":         {"COMODO", "Sectigo"},
+	"comodo.com":           {"COMODO", "Sectigo"},
+	"usertrust.com":        {"USERTrust", "Sectigo"},
+	"zerossl.com":          {"ZeroSSL"},
+	"amazon.com":           {"Amazon"},
+	"amazontrust.com":      {"Amazon"},
+	"awstrust.com":         {"Amazon"},
+	"amazonaws.com":        {"Amazon"},
+	"globalsign.com":       {"GlobalSign"},
+	"godaddy.com":          {"GoDaddy", "Starfield"},
+	"starfieldtech.com":    {"Starfield", "GoDaddy"},
+	"entrust.net":          {"Entrust"},
+	"affirmtrust.com":      {"AffirmTrust", "Entrust"},
+	"buypass.com":          {"Buypass"},
+	"buypass.no":           {"Buypass"},
+	"ssl.com":              {"SSL.com", "SSL Corporation"},
+	"identrust.com":        {"IdenTrust"},
+	"certum.pl":            {"Certum", "Unizeto", "Asseco"},
+	"certum.eu":            {"Certum", "Unizeto", "Asseco"},
+	"harica.gr":            {"HARICA", "Hellenic Academic"},
+	"actalis.it":           {"Actalis"},
+	"quovadisglobal.com":   {"QuoVadis"},
+	"microsoft.com":        {"Microsoft"},
+	"apple.com":            {"Apple"},
+	"cloudflare.com":       {"Cloudflare"},
+	"telesec.de":           {"T-Systems", "Telekom", "TeleSec"},
+	"trust-provider.com":   {"Trust Provider", "Sectigo"},
+	"e-tugra.com":          {"E-Tugra"},
+	"turktrust.com.tr":     {"TURKTRUST"},
+	"kamusm.gov.tr":        {"Kamu Sertifikasyon", "TUBITAK"},
+	"swisssign.com":        {"SwissSign"},
+	"secom.co.jp":          {"SECOM"},
+	"trustwave.com":        {"Trustwave", "SecureTrust"},
+	"networksolutions.com": {"Network Solutions"},
+}
+
+// CAAIssuer is a parsed issue or issuewild property value (RFC 8659 4.2)
+type CAAIssuer struct {
+	Domain     string // empty when the record forbids issuance
+	Parameters map[string]string
+}
+
+// CAARecordSet is the relevant CAA record set of a domain
+type CAARecordSet struct {
+	Domain    string // name the records were found at while climbing the tree
+	Records   []*dns.CAA
+	Issue     []CAAIssuer
+	IssueWild []CAAIssuer
+	IODEF     []string
+	// UnknownCritical lists tags with the critical flag that are not understood, no CA may issue then
+	UnknownCritical []string
+}
+
+// LookupCAA climbs from the domain towards the root and returns the first non-empty CAA record set (RFC 8659 3)
+func LookupCAA(domain string) (*CAARecordSet, error) {
+	config, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil {
+		return nil, fmt.Errorf("error reading resolv.conf: %v", err)
+	}
+	c := dns.Client{Timeout: 5 * time.Second}
+
+	labels := dns.SplitDomainName(domain)
+	for i := range labels {
+		name := dns.Fqdn(strings.Join(labels[i:], "."))
+		m := new(dns.Msg)
+		m.SetQuestion(name, dns.TypeCAA)
+		m.RecursionDesired = true
+
+		r, _, err := c.Exchange(m, net.JoinHostPort(config.Servers[0], config.Port))
+		if err != nil {
+			return nil, fmt.Errorf("error querying CAA records for %s: %v", name, err)
+		}
+		// A failed lookup is not the same as an empty record set, CAs must refuse to issue in that case
+		if r.Rcode != dns.RcodeSuccess && r.Rcode != dns.RcodeNameError {
+			return nil, fmt.Errorf("CAA lookup for %s failed with %s", name, dns.RcodeToString[r.Rcode])
+		}
+
+		// Answers for an alias carry the owner name of the CNAME target, so they are collected regardless of owner
+		var records []*dns.CAA
+		for _, answer := range r.Answer {
+			if caa, ok := answer.(*dns.CAA); ok {
+				records = append(records, caa)
+			}
+		}
+		if len(records) > 0 {
+			return parseCAARecords(strings.TrimSuffix(name, "."), records), nil
+		}
+	}
+	return &CAARecordSet{}, nil
+}
+
+func parseCAARecords(domain string, records []*dns.CAA) *CAARecordSet {
+	set := &CAARecordSet{Domain: domain, Records: records}
+	for _, record := range records {
+		switch strings.ToLower(record.Tag) {
+		case "issue":
+			set.Issue = append(set.Issue, ParseCAAIssuer(record.Value))
+		case "issuewild":
+			set.IssueWild = append(set.IssueWild, ParseCAAIssuer(record.Value))
+		case "iodef":
+			set.IODEF = append(set.IODEF, record.Value)
+		default:
+			if record.Flag&128 != 0 {
+				set.UnknownCritical = append(set.UnknownCritical, record.Tag)
+			}
+		}
+	}
+	return set
+}
+
+// ParseCAAIssuer parses "ca.example; accounturi=https://...; validationmethods=dns-01,http-01"
+func ParseCAAIssuer(value string) CAAIssuer {
+	parts := strings.Split(value, ";")
+	issuer := CAAIssuer{Domain: strings.ToLower(strings.TrimSpace(parts[0])), Parameters: map[string]string{}}
+	for _, part := range parts[1:] {
+		key, val, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found || key == "" {
+			continue
+		}
+		issuer.Parameters[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(val)
+	}
+	return issuer
+}
+
+func (issuer CAAIssuer) String() string {
+	if issuer.Domain == "" {
+		return "no CA allowed"
+	}
+	var params []string
+	for key, value := range issuer.Parameters {
+		params = append(params, key+"="+value)
+	}
+	sort.Strings(params)
+	if len(params) == 0 {
+		return issuer.Domain
+	}
+	return issuer.Domain + " (" + strings.Join(params, ", ") + ")"
+}
+
+// caaDomainsForCertificate returns the CAA issuer domains whose names appear in the certificate issuer
+func caaDomainsForCertificate(cert *x509.Certificate) []string {
+	issuer := strings.ToLower(strings.Join(append(append([]string{}, cert.Issuer.Organization...), cert.Issuer.CommonName), " "))
+	var domains []string
+	for domain, names := range caaIssuerNames {
+		for _, name := range names {
+			if strings.Contains(issuer, strings.ToLower(name)) {
+				domains = append(domains, domain)
+				break
+			}
+		}
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// CheckCAAConsistency compares the CAA record set of a domain with the certificate served for it and returns the
+// findings. Only certificate names the record set applies to are checked.
+func CheckCAAConsistency(domain string, set *CAARecordSet, cert *x509.Certificate) []string {
+	var findings []string
+	if len(set.Records) == 0 {
+		return []string{color.YellowString("No CAA records, any CA may issue certificates for this domain")}
+	}
+	if len(set.UnknownCritical) > 0 {
+		findings = append(findings, color.RedString("Unknown critical CAA tags %s, no CA may issue certificates", strings.Join(set.UnknownCritical, ", ")))
+	}
+	if len(set.IODEF) == 0 {
+		findings = append(findings, color.YellowString("No iodef property, CAs cannot report refused issuance requests"))
+	}
+	for _, iodef := range set.IODEF {
+		if !strings.HasPrefix(iodef, "mailto:") && !strings.HasPrefix(iodef, "https://") && !strings.HasPrefix(iodef, "http://") {
+			findings = append(findings, color.YellowString("Invalid iodef URL %s", iodef))
+		}
+	}
+	for _, issuer := range append(append([]CAAIssuer{}, set.Issue...), set.IssueWild...) {
+		if methods, ok := issuer.Parameters["validationmethods"]; ok {
+			for _, method := range strings.Split(methods, ",") {
+				switch strings.TrimSpace(method) {
+				case "http-01", "dns-01", "tls-alpn-01", "dns-account-01":
+				default:
+					if !strings.HasPrefix(strings.TrimSpace(method), "ca-") {
+						findings = append(findings, color.YellowString("Unknown validation method %s for %s", method, issuer.Domain))
+					}
+				}
+			}
+		}
+	}
+
+	if cert == nil {
+		return findings
+	}
+
+	names := cert.DNSNames
+	if len(names) == 0 && cert.Subject.CommonName != "" {
+		names = []string{cert.Subject.CommonName}
+	}
+	var plainNames, wildcardNames, otherNames []string
+	for _, name := range names {
+		if !caaSetCovers(domain, set.Domain, name) {
+			otherNames = append(otherNames, name)
+		} else if strings.HasPrefix(name, "*.") {
+			wildcardNames = append(wildcardNames, name)
+		} else {
+			plainNames = append(plainNames, name)
+		}
+	}
+
+	if len(otherNames) > 0 {
+		findings = append(findings, color.YellowString("Not checked, the CAA records of %s do not apply to %s", domain, strings.Join(otherNames, ", ")))
+	}
+
+	// issue governs the other names, issuewild governs wildcard names and issue applies to them when it is absent (RFC 8659 4.3)
+	type caaCheck struct {
+		names    []string
+		relevant []CAAIssuer
+		property string
+	}
+	checks := []caaCheck{{plainNames, set.Issue, "issue"}}
+	if len(wildcardNames) > 0 {
+		if len(set.IssueWild) > 0 {
+			checks = append(checks, caaCheck{wildcardNames, set.IssueWild, "issuewild"})
+		} else {
+			findings = append(findings, color.YellowString("Wildcard certificate but no issuewild property, the issue entries also allow wildcards"))
+			checks = append(checks, caaCheck{wildcardNames, set.Issue, "issue"})
+		}
+	}
+
+	issuerDomains := caaDomainsForCertificate(cert)
+	for _, check := range checks {
+		if len(check.names) == 0 {
+			continue
+		}
+		nameList := strings.Join(check.names, ", ")
+		if len(check.relevant) == 0 {
+			findings = append(findings, color.YellowString("No %s property, any CA may issue for %s", check.property, nameList))
+			continue
+		}
+		if len(issuerDomains) == 0 {
+			findings = append(findings, color.YellowString("Issuer %q is not a known CA, authorization of %s cannot be checked", cert.Issuer.String(), nameList))
+			continue
+		}
+		authorizedBy := ""
+		for _, allowed := range check.relevant {
+			for _, domain := range issuerDomains {
+				if allowed.Domain == domain {
+					authorizedBy = domain
+				}
+			}
+		}
+		if authorizedBy != "" {
+			findings = append(findings, color.GreenString("Certificate issuer %s is authorized by the %s property (%s) for %s", cert.Issuer.CommonName, check.property, authorizedBy, nameList))
+		} else {
+			findings = append(findings, color.RedString("Certificate issuer %s (%s) is not authorized by the current %s property for %s", cert.Issuer.CommonName, strings.Join(issuerDomains, ", "), check.property, nameList))
+		}
+	}
+	return findings
+}
+
+// caaSetCovers tells whether the record set found at setDomain while climbing from domain applies to a certificate
+// name. That holds for names at or below the domain, unless they have records of their own, and for the names
+// between the domain and setDomain, whose lookups came back empty. Wildcards are checked at their base name.
+func caaSetCovers(domain, setDomain, name string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	setDomain = strings.ToLower(strings.TrimSuffix(setDomain, "."))
+	base := strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(name, "*."), "."))
+	below := func(name, parent string) bool {
+		return name == parent || strings.HasSuffix(name, "."+parent)
+	}
+	return below(base, domain) || (below(domain, base) && below(base, setDomain))
+}
+
+// GetCAAReport fetches the CAA records of a domain and checks them against the certificate served on port 443
+func GetCAAReport(domain string) (string, error) {
+	set, err := LookupCAA(domain)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if set.Domain != "" && set.Domain != strings.TrimSuffix(domain, ".") {
+		sb.WriteString(color.New(color.FgYellow, color.Bold).Sprintf("\nCAA Records (inherited from %s):\n\n", set.Domain))
+	} else {
+		sb.WriteString(color.New(color.FgYellow, color.Bold).Sprint("\nCAA Records:\n\n"))
+	}
+
+	if len(set.Records) > 0 {
+		table := tablewriter.NewWriter(&sb)
+		table.SetHeader([]string{"Flags", "Tag", "Value"})
+		table.SetBorder(false)
+		table.SetAutoWrapText(false)
+		for _, record := range set.Records {
+			value := record.Value
+			if tag := strings.ToLower(record.Tag); tag == "issue" || tag == "issuewild" {
+				value = ParseCAAIssuer(record.Value).String()
+			}
+			table.Append([]string{fmt.Sprint(record.Flag), record.Tag, value})
+		}
+		table.Render()
+	}
+
+	var cert *x509.Certificate
+	if state, err := fetchTLSState(TLSTarget{Host: domain, Port: "443", ServerName: domain}); err == nil {
+		cert = state.PeerCertificates[0]
+		sb.WriteString(fmt.Sprintf("\n%s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Certificate Issuer:"), cert.Issuer))
+	} else {
+		sb.WriteString(fmt.Sprintf("\n%s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Certificate Issuer:"), color.RedString("could not fetch certificate: %v", err)))
+	}
+
+	sb.WriteString(color.New(color.FgYellow, color.Bold).Sprint("\nCAA Findings:\n"))
+	for _, finding := range CheckCAAConsistency(domain, set, cert) {
+		sb.WriteString("  - " + finding + "\n")
+	}
+	return sb.String(), nil
+}
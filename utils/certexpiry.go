@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Expiry states of a monitored certificate, ordered from worst to best
+const (
+	CertStatusExpired  = "EXPIRED"
+	CertStatusCritical = "CRITICAL"
+	CertStatusWarning  = "WARNING"
+	CertStatusError    = "ERROR"
+	CertStatusOK       = "OK"
+)
+
+// Exit codes of the certs mode, following the Nagios plugin convention
+const (
+	CertExitOK       = 0
+	CertExitWarning  = 1
+	CertExitCritical = 2
+	CertExitUnknown  = 3
+)
+
+// CertExpiryResult is the expiry state of the certificate served by one target
+type CertExpiryResult struct {
+	Target      TLSTarget
+	Certificate *x509.Certificate
+	DaysLeft    int
+	Status      string
+	Err         error
+}
+
+// ParseCertTarget parses a "host[:port] [sni]" entry, the port defaults to 443 and the SNI to the host
+func ParseCertTarget(entry string) (TLSTarget, error) {
+	fields := strings.Fields(entry)
+	if len(fields) == 0 || len(fields) > 2 {
+		return TLSTarget{}, fmt.Errorf("invalid entry %q, expected host[:port] [sni]", entry)
+	}
+
+	host, port := fields[0], 443
+	if h, p, err := net.SplitHostPort(fields[0]); err == nil {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 || n > 65535 {
+			return TLSTarget{}, fmt.Errorf("invalid port in %q", entry)
+		}
+		host, port = h, n
+	}
+
+	target := NewTLSTarget(host, port)
+	if len(fields) == 2 {
+		target.ServerName = fields[1]
+	}
+	return target, nil
+}
+
+// ParseCertTargets reads one entry per line, ignoring blank lines and # comments
+func ParseCertTargets(r io.Reader) ([]TLSTarget, error) {
+	var targets []TLSTarget
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		entry := scanner.Text()
+		if i := strings.Index(entry, "#"); i >= 0 {
+			entry = entry[:i]
+		}
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		target, err := ParseCertTarget(entry)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		targets = append(targets, target)
+	}
+	return targets, scanner.Err()
+}
+
+// LoadCertTargets reads the entries of a domain list file
+func LoadCertTargets(path string) ([]TLSTarget, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseCertTargets(file)
+}
+
+// CheckCertificateExpiry fetches the certificate of every target and returns the results sorted by days remaining
+func CheckCertificateExpiry(targets []TLSTarget) []CertExpiryResult {
+	results := make([]CertExpiryResult, len(targets))
+
+	var wg sync.WaitGroup
+	concurrencyLimit := make(chan struct{}, 20)
+	for i, target := range targets {
+		wg.Add(1)
+		concurrencyLimit <- struct{}{}
+		go func(i int, target TLSTarget) {
+			defer wg.Done()
+			defer func() { <-concurrencyLimit }()
+			results[i] = checkCertificateExpiry(target)
+		}(i, target)
+	}
+	wg.Wait()
+
+	// Failed lookups come first since nothing is known about their expiry
+	sort.SliceStable(results, func(i, j int) bool {
+		if (results[i].Err != nil) != (results[j].Err != nil) {
+			return results[i].Err != nil
+		}
+		return results[i].DaysLeft < results[j].DaysLeft
+	})
+	return results
+}
+
+func checkCertificateExpiry(target TLSTarget) CertExpiryResult {
+	result := CertExpiryResult{Target: target}
+	state, err := fetchTLSState(target)
+	if err != nil {
+		result.Status = CertStatusError
+		result.Err = err
+		return result
+	}
+
+	result.Certificate = state.PeerCertificates[0]
+	result.DaysLeft = DaysUntilExpiry(result.Certificate)
+	switch {
+	case time.Now().After(result.Certificate.NotAfter):
+		result.Status = CertStatusExpired
+	case result.DaysLeft <= CertExpiryCriticalDays:
+		result.Status = CertStatusCritical
+	case result.DaysLeft <= CertExpiryWarnDays:
+		result.Status = CertStatusWarning
+	default:
+		result.Status = CertStatusOK
+	}
+	return result
+}
+
+// CertExpiryExitCode returns 2 when a certificate is critical or expired, 1 on warnings, 3 when only lookups failed and 0 otherwise
+func CertExpiryExitCode(results []CertExpiryResult) int {
+	code := CertExitOK
+	for _, result := range results {
+		switch result.Status {
+		case CertStatusExpired, CertStatusCritical:
+			return CertExitCritical
+		case CertStatusWarning:
+			code = CertExitWarning
+		case CertStatusError:
+			if code == CertExitOK {
+				code = CertExitUnknown
+			}
+		}
+	}
+	return code
+}
+
+// GetCertExpiryReport checks the certificates of the targets and returns the report with the matching exit code
+func GetCertExpiryReport(targets []TLSTarget) (string, int, error) {
+	if len(targets) == 0 {
+		return "", CertExitUnknown, fmt.Errorf("no domains given")
+	}
+	results := CheckCertificateExpiry(targets)
+	return FormatCertExpiryResults(results), CertExpiryExitCode(results), nil
+}
+
+// FormatCertExpiryResults renders the expiry results as a table with a summary line
+func FormatCertExpiryResults(results []CertExpiryResult) string {
+	var sb strings.Builder
+	sb.WriteString(color.New(color.FgYellow, color.Bold).Sprintf("\nCertificate Expiry (warning %d days, critical %d days):\n\n", CertExpiryWarnDays, CertExpiryCriticalDays))
+
+	table := tablewriter.NewWriter(&sb)
+	table.SetHeader([]string{"Target", "SNI", "Common Name", "Expires", "Days Left", "Status"})
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+
+	counts := map[string]int{}
+	for _, result := range results {
+		counts[result.Status]++
+		if result.Err != nil {
+			table.Append([]string{result.Target.String(), result.Target.ServerName, "-", "-", "-", color.RedString("%s: %v", result.Status, result.Err)})
+			continue
+		}
+
+		status := color.GreenString(result.Status)
+		switch result.Status {
+		case CertStatusExpired, CertStatusCritical:
+			status = color.RedString(result.Status)
+		case CertStatusWarning:
+			status = color.YellowString(result.Status)
+		}
+		table.Append([]string{
+			result.Target.String(),
+			result.Target.ServerName,
+			result.Certificate.Subject.CommonName,
+			result.Certificate.NotAfter.Format("2006-01-02"),
+			strconv.Itoa(result.DaysLeft),
+			status,
+		})
+	}
+	table.Render()
+
+	sb.WriteString(fmt.Sprintf("\n%d certificates: %d expired, %d critical, %d warning, %d ok, %d errors\n",
+		len(results), counts[CertStatusExpired], counts[CertStatusCritical], counts[CertStatusWarning], counts[CertStatusOK], counts[CertStatusError]))
+	return sb.String()
+}
@@ -0,0 +1,331 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// CABundlePath points to a PEM file with trusted CA certificates, the system roots are used when it is empty
+var CABundlePath string
+
+// CertExpiryWarnDays and CertExpiryCriticalDays are the thresholds used to highlight certificates close to expiry
+var (
+	CertExpiryWarnDays     = 30
+	CertExpiryCriticalDays = 7
+)
+
+// oidSCTList is the X.509 extension carrying embedded Signed Certificate Timestamps (RFC 6962)
+var oidSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// ChainReport describes the result of verifying a presented certificate chain
+type ChainReport struct {
+	Presented            []*x509.Certificate
+	Verified             []*x509.Certificate
+	VerifyErr            error
+	HostnameErr          error
+	MissingIntermediates bool
+}
+
+// SignedCertificateTimestamp is a parsed SCT from a certificate or TLS handshake
+type SignedCertificateTimestamp struct {
+	LogID     string
+	Timestamp time.Time
+	Source    string
+}
+
+// fetchTLSState connects to a TLS service without verification so that invalid certificates can still be inspected
+func fetchTLSState(target TLSTarget) (tls.ConnectionState, error) {
+	conn, err := target.dialTLS(&tls.Config{
+		ServerName:         target.ServerName,
+		InsecureSkipVerify: true,
+	}, 10*time.Second)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return state, fmt.Errorf("no certificates found")
+	}
+	return state, nil
+}
+
+// loadRootPool returns the custom CA bundle when configured, otherwise nil so the system roots are used
+func loadRootPool() (*x509.CertPool, error) {
+	if CABundlePath == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(CABundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read CA bundle: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", CABundlePath)
+	}
+	return pool, nil
+}
+
+// VerifyCertificateChain verifies the presented chain against the trusted roots and the expected hostname
+func VerifyCertificateChain(presented []*x509.Certificate, hostname string) ChainReport {
+	report := ChainReport{Presented: presented}
+	if len(presented) == 0 {
+		report.VerifyErr = fmt.Errorf("no certificates presented")
+		return report
+	}
+
+	roots, err := loadRootPool()
+	if err != nil {
+		report.VerifyErr = err
+		return report
+	}
+
+	leaf := presented[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range presented[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	chains, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	if err != nil {
+		// A chain that only verifies with the issuer fetched from the AIA URL means the server omits intermediates
+		var unknownAuthority x509.UnknownAuthorityError
+		if errors.As(err, &unknownAuthority) {
+			if issuer := fetchAIAIssuer(leaf); issuer != nil {
+				intermediates.AddCert(issuer)
+				if chains, err2 := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err2 == nil {
+					report.MissingIntermediates = true
+					report.Verified = chains[0]
+				}
+			}
+		}
+		report.VerifyErr = err
+	} else {
+		report.Verified = chains[0]
+	}
+
+	if hostname != "" {
+		report.HostnameErr = leaf.VerifyHostname(hostname)
+	}
+	return report
+}
+
+// fetchAIAIssuer downloads the issuing certificate referenced by the Authority Information Access extension
+func fetchAIAIssuer(cert *x509.Certificate) *x509.Certificate {
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, url := range cert.IssuingCertificateURL {
+		resp, err := client.Get(url)
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		resp.Body.Close()
+		if err != nil {
+			continue
+		}
+		if block, _ := pem.Decode(data); block != nil {
+			data = block.Bytes
+		}
+		if issuer, err := x509.ParseCertificate(data); err == nil {
+			return issuer
+		}
+	}
+	return nil
+}
+
+// ParseEmbeddedSCTs extracts the Signed Certificate Timestamps embedded in a certificate
+func ParseEmbeddedSCTs(cert *x509.Certificate) []SignedCertificateTimestamp {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidSCTList) {
+			continue
+		}
+		var list []byte
+		if _, err := asn1.Unmarshal(ext.Value, &list); err != nil {
+			return nil
+		}
+		return parseSCTList(list, "certificate")
+	}
+	return nil
+}
+
+// parseSCTList decodes a TLS encoded SignedCertificateTimestampList
+func parseSCTList(data []byte, source string) []SignedCertificateTimestamp {
+	var scts []SignedCertificateTimestamp
+	if len(data) < 2 {
+		return nil
+	}
+	data = data[2:]
+	for len(data) >= 2 {
+		length := int(binary.BigEndian.Uint16(data))
+		data = data[2:]
+		if length > len(data) {
+			break
+		}
+		if sct, ok := parseSCT(data[:length], source); ok {
+			scts = append(scts, sct)
+		}
+		data = data[length:]
+	}
+	return scts
+}
+
+// parseSCT decodes the version, log ID and timestamp of a single SCT
+func parseSCT(data []byte, source string) (SignedCertificateTimestamp, bool) {
+	// version(1) || log_id(32) || timestamp(8)
+	if len(data) < 41 {
+		return SignedCertificateTimestamp{}, false
+	}
+	millis := int64(binary.BigEndian.Uint64(data[33:41]))
+	return SignedCertificateTimestamp{
+		LogID:     base64.StdEncoding.EncodeToString(data[1:33]),
+		Timestamp: time.UnixMilli(millis).UTC(),
+		Source:    source,
+	}, true
+}
+
+// describePublicKey returns the key algorithm and size of a certificate
+func describePublicKey(cert *x509.Certificate) (string, int) {
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return "RSA", pub.N.BitLen()
+	case *ecdsa.PublicKey:
+		return "ECDSA " + pub.Curve.Params().Name, pub.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return "Ed25519", 256
+	default:
+		return cert.PublicKeyAlgorithm.String(), 0
+	}
+}
+
+// CertificateFingerprint returns the SHA-256 fingerprint of a certificate in colon separated hex
+func CertificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return colonHex(sum[:])
+}
+
+func colonHex(data []byte) string {
+	parts := make([]string, len(data))
+	for i, b := range data {
+		parts[i] = strings.ToUpper(hex.EncodeToString([]byte{b}))
+	}
+	return strings.Join(parts, ":")
+}
+
+// DaysUntilExpiry returns the number of full days left before the certificate expires. It is rounded down, so it
+// is negative as soon as the certificate has expired, -1 during the first day after NotAfter.
+func DaysUntilExpiry(cert *x509.Certificate) int {
+	return int(math.Floor(time.Until(cert.NotAfter).Hours() / 24))
+}
+
+// formatExpiry colors the remaining validity according to the warning thresholds
+func formatExpiry(days int) string {
+	switch {
+	case days < 0:
+		return color.RedString("Expired %d days ago", -days)
+	case days <= CertExpiryCriticalDays:
+		return color.RedString("%d days (critical)", days)
+	case days <= CertExpiryWarnDays:
+		return color.YellowString("%d days (warning)", days)
+	default:
+		return color.GreenString("%d days", days)
+	}
+}
+
+// formatCertificateDetails formats the extended certificate fields shown in the SSL report
+func formatCertificateDetails(cert *x509.Certificate, stapledSCTs [][]byte) string {
+	var sb strings.Builder
+
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	if len(sans) == 0 {
+		sans = []string{"None"}
+	}
+
+	keyType, keySize := describePublicKey(cert)
+	spki := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+
+	sb.WriteString(fmt.Sprintf("%s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Subject Alternative Names:"), strings.Join(sans, ", ")))
+	sb.WriteString(fmt.Sprintf("%s %s %d bits\n", color.New(color.FgYellow, color.Bold).Sprint("Key:"), keyType, keySize))
+	sb.WriteString(fmt.Sprintf("%s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Signature Algorithm:"), cert.SignatureAlgorithm))
+	sb.WriteString(fmt.Sprintf("%s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Serial Number:"), colonHex(cert.SerialNumber.Bytes())))
+	sb.WriteString(fmt.Sprintf("%s %s\n", color.New(color.FgYellow, color.Bold).Sprint("SHA-256 Fingerprint:"), CertificateFingerprint(cert)))
+	sb.WriteString(fmt.Sprintf("%s %s\n", color.New(color.FgYellow, color.Bold).Sprint("SHA-256 SPKI Fingerprint:"), colonHex(spki[:])))
+	sb.WriteString(fmt.Sprintf("%s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Expires In:"), formatExpiry(DaysUntilExpiry(cert))))
+
+	scts := ParseEmbeddedSCTs(cert)
+	for _, raw := range stapledSCTs {
+		if sct, ok := parseSCT(raw, "TLS extension"); ok {
+			scts = append(scts, sct)
+		}
+	}
+	if len(scts) == 0 {
+		sb.WriteString(fmt.Sprintf("%s %s\n", color.New(color.FgYellow, color.Bold).Sprint("SCTs:"), color.RedString("None")))
+	} else {
+		sb.WriteString(color.New(color.FgYellow, color.Bold).Sprintf("SCTs (%d):\n", len(scts)))
+		for _, sct := range scts {
+			sb.WriteString(fmt.Sprintf("  %s %s (%s)\n", sct.LogID, sct.Timestamp.Format(time.RFC3339), sct.Source))
+		}
+	}
+
+	return sb.String()
+}
+
+// formatChainReport formats the presented chain and the verification results
+func formatChainReport(report ChainReport) string {
+	var sb strings.Builder
+
+	sb.WriteString(color.New(color.FgYellow, color.Bold).Sprint("Presented Chain:\n"))
+	for i, cert := range report.Presented {
+		sb.WriteString(fmt.Sprintf("  %d: %s (issuer: %s)\n", i, cert.Subject, cert.Issuer))
+	}
+
+	if report.VerifyErr != nil {
+		sb.WriteString(fmt.Sprintf("%s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Chain Validation:"), color.RedString("Failed (%v)", report.VerifyErr)))
+	} else {
+		sb.WriteString(fmt.Sprintf("%s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Chain Validation:"), color.GreenString("Trusted")))
+	}
+	if report.MissingIntermediates {
+		sb.WriteString(fmt.Sprintf("%s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Missing Intermediates:"), color.RedString("Yes, the chain only validates with the issuer fetched via AIA")))
+	}
+	if len(report.Verified) > 0 {
+		sb.WriteString(color.New(color.FgYellow, color.Bold).Sprint("Trusted Path:\n"))
+		for i, cert := range report.Verified {
+			sb.WriteString(fmt.Sprintf("  %d: %s\n", i, cert.Subject))
+		}
+	}
+
+	if report.HostnameErr != nil {
+		sb.WriteString(fmt.Sprintf("%s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Hostname Match:"), color.RedString("No (%v)", report.HostnameErr)))
+	} else {
+		sb.WriteString(fmt.Sprintf("%s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Hostname Match:"), color.GreenString("Yes")))
+	}
+
+	return sb.String()
+}
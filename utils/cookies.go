@@ -0,0 +1,308 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+// sessionCookieMaxAge is the longest lifetime accepted for a cookie that looks like a session cookie
+const sessionCookieMaxAge = 30 * 24 * time.Hour
+
+// sessionCookiePattern matches names that usually carry a session or authentication token
+var sessionCookiePattern = regexp.MustCompile(`(?i)sess|sid$|^sid|auth|token|jwt|login|remember`)
+
+// frameworkCookies maps well-known cookie names, or name prefixes ending in *, to the technology that sets them
+var frameworkCookies = map[string]string{
+	"PHPSESSID":                   "PHP",
+	"JSESSIONID":                  "Java (Servlet container)",
+	"ASP.NET_SessionId":           "ASP.NET",
+	"ASPSESSIONID*":               "Classic ASP (IIS)",
+	".AspNetCore.*":               "ASP.NET Core",
+	".ASPXAUTH":                   "ASP.NET Forms Authentication",
+	"laravel_session":             "Laravel (PHP)",
+	"ci_session":                  "CodeIgniter (PHP)",
+	"CAKEPHP":                     "CakePHP",
+	"symfony":                     "Symfony (PHP)",
+	"connect.sid":                 "Express (Node.js)",
+	"koa.sess":                    "Koa (Node.js)",
+	"rack.session":                "Ruby Rack",
+	"_session_id":                 "Ruby on Rails",
+	"sessionid":                   "Django (Python)",
+	"csrftoken":                   "Django (Python)",
+	"CFID":                        "Adobe ColdFusion",
+	"CFTOKEN":                     "Adobe ColdFusion",
+	"wordpress_*":                 "WordPress",
+	"wp-settings-*":               "WordPress",
+	"PrestaShop-*":                "PrestaShop",
+	"frontend":                    "Magento",
+	"OCSESSID":                    "OpenCart",
+	"MoodleSession":               "Moodle",
+	"JSESSIONIDSSO":               "Java (JBoss/WildFly SSO)",
+	"SESS*":                       "Drupal",
+	"SSESS*":                      "Drupal",
+	"BIGipServer*":                "F5 BIG-IP load balancer",
+	"AWSALB":                      "AWS Application Load Balancer",
+	"AWSELB":                      "AWS Classic Load Balancer",
+	"ARRAffinity":                 "Azure App Service",
+	"__cf_bm":                     "Cloudflare",
+	"incap_ses_*":                 "Imperva Incapsula",
+	"visid_incap_*":               "Imperva Incapsula",
+	"citrix_ns_id":                "Citrix NetScaler",
+	"NSC_*":                       "Citrix NetScaler",
+	"X-Mapping-*":                 "Riverbed Stingray",
+	"TS01*":                       "F5 BIG-IP ASM",
+	"shopify_y":                   "Shopify",
+	"_shopify_s":                  "Shopify",
+	"JSESSIONID.*":                "Jenkins",
+	"grafana_session":             "Grafana",
+	"PLAY_SESSION":                "Play Framework",
+	"_gitlab_session":             "GitLab",
+	"phpMyAdmin":                  "phpMyAdmin",
+	"roundcube_sessid":            "Roundcube",
+	"SERVERID":                    "HAProxy",
+	"ROUTEID":                     "Apache mod_proxy_balancer",
+	"XSRF-TOKEN":                  "Laravel or Angular",
+	"__RequestVerificationToken*": "ASP.NET MVC",
+	"SESSION":                     "Spring Session (Java)",
+	"pma_lang":                    "phpMyAdmin",
+}
+
+// CookieResult is the analysis of one Set-Cookie header of the redirect chain
+type CookieResult struct {
+	Cookie     *http.Cookie
+	SetBy      string
+	Issues     []string
+	Technology string
+	Leak       string // internal information decoded from the value
+}
+
+// CookieTechnology returns the technology a cookie name reveals, if it is a well-known one
+func CookieTechnology(name string) string {
+	if technology, ok := frameworkCookies[name]; ok {
+		return technology
+	}
+	// Longer prefixes are more specific
+	best := ""
+	for pattern := range frameworkCookies {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if ok && strings.HasPrefix(name, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best != "" {
+		return frameworkCookies[best+"*"]
+	}
+	return ""
+}
+
+// DecodeBIGIPCookie decodes the backend address of a F5 BIG-IP persistence cookie in the default IPv4 encoding
+func DecodeBIGIPCookie(value string) (string, bool) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+	ip, err1 := strconv.ParseUint(parts[0], 10, 32)
+	port, err2 := strconv.ParseUint(parts[1], 10, 16)
+	if err1 != nil || err2 != nil {
+		return "", false
+	}
+	port = port>>8 | (port&0xff)<<8
+	return fmt.Sprintf("%d.%d.%d.%d:%d", ip&0xff, ip>>8&0xff, ip>>16&0xff, ip>>24, port), true
+}
+
+// AnalyzeCookies checks every cookie set by the responses of one or more redirect chains
+func AnalyzeCookies(chain []*http.Response) []CookieResult {
+	var results []CookieResult
+	seen := map[string]bool{}
+	for _, resp := range chain {
+		if resp.Request == nil {
+			continue
+		}
+		for _, cookie := range resp.Cookies() {
+			// Chains for http:// and https:// usually end at the same page
+			key := resp.Request.URL.String() + "\x00" + cookie.Raw
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			results = append(results, analyzeCookie(cookie, resp))
+		}
+	}
+	return results
+}
+
+func analyzeCookie(cookie *http.Cookie, resp *http.Response) CookieResult {
+	requestURL := resp.Request.URL
+	host := requestURL.Hostname()
+	secureOrigin := requestURL.Scheme == "https"
+	result := CookieResult{Cookie: cookie, SetBy: requestURL.Host + requestURL.Path, Technology: CookieTechnology(cookie.Name)}
+	issue := func(format string, args ...interface{}) {
+		result.Issues = append(result.Issues, fmt.Sprintf(format, args...))
+	}
+
+	// A max-age in the past or an expiry in the past deletes the cookie, there is nothing to check
+	if cookie.MaxAge < 0 || (!cookie.Expires.IsZero() && cookie.Expires.Before(time.Now())) {
+		return result
+	}
+	sessionLike := sessionCookiePattern.MatchString(cookie.Name) || isFrameworkSessionCookie(cookie.Name)
+
+	if !cookie.Secure {
+		issue("Secure missing, the cookie is sent over plain HTTP")
+	} else if !secureOrigin {
+		issue("Secure cookie set over HTTP, browsers reject it")
+	}
+	if !cookie.HttpOnly {
+		if sessionLike {
+			issue("HttpOnly missing on a session cookie, scripts can steal it")
+		} else {
+			issue("HttpOnly missing, scripts can read the cookie")
+		}
+	}
+	switch cookie.SameSite {
+	case http.SameSiteNoneMode:
+		if !cookie.Secure {
+			issue("SameSite=None without Secure, browsers reject the cookie")
+		} else {
+			issue("SameSite=None, the cookie is sent on cross-site requests (CSRF)")
+		}
+	case http.SameSiteLaxMode, http.SameSiteStrictMode:
+	default:
+		issue("SameSite missing or invalid, browsers fall back to Lax")
+	}
+
+	domain := strings.TrimPrefix(strings.ToLower(cookie.Domain), ".")
+	switch {
+	case strings.HasPrefix(cookie.Name, "__Host-"):
+		if !cookie.Secure || !secureOrigin || domain != "" || cookie.Path != "/" {
+			issue("__Host- prefix requires Secure, HTTPS, Path=/ and no Domain, browsers reject the cookie")
+		}
+	case strings.HasPrefix(cookie.Name, "__Secure-"):
+		if !cookie.Secure || !secureOrigin {
+			issue("__Secure- prefix requires Secure and HTTPS, browsers reject the cookie")
+		}
+	}
+
+	if domain != "" {
+		if host != domain && !strings.HasSuffix(host, "."+domain) {
+			issue("Domain=%s does not match %s, browsers reject the cookie", domain, host)
+		} else if host != domain {
+			issue("Domain=%s shares the cookie with every subdomain of %s", domain, domain)
+		} else {
+			issue("Domain=%s also sends the cookie to all subdomains, omit Domain to keep it host-only", domain)
+		}
+	}
+	if dir := path.Dir(requestURL.Path); !sessionLike && cookie.Path == "/" && dir != "/" && dir != "." && requestURL.Path != "" {
+		issue("Path=/ shares the cookie with the whole site although it was set by %s", requestURL.Path)
+	}
+
+	if sessionLike {
+		lifetime := time.Duration(cookie.MaxAge) * time.Second
+		if cookie.MaxAge == 0 && !cookie.Expires.IsZero() {
+			lifetime = time.Until(cookie.Expires)
+		}
+		if lifetime > sessionCookieMaxAge {
+			issue("Session cookie lives %d days, limit it to the session or a few hours", int(lifetime.Hours()/24))
+		}
+	}
+
+	if result.Technology != "" {
+		issue("Name reveals %s", result.Technology)
+	}
+	if strings.HasPrefix(cookie.Name, "BIGipServer") {
+		if backend, ok := DecodeBIGIPCookie(cookie.Value); ok {
+			result.Leak = backend
+			issue("Value leaks the internal backend address %s", backend)
+		}
+	}
+	return result
+}
+
+func isFrameworkSessionCookie(name string) bool {
+	switch name {
+	case "PHPSESSID", "JSESSIONID", "ASP.NET_SessionId", ".ASPXAUTH", "laravel_session", "ci_session", "CAKEPHP", "symfony", "connect.sid", "rack.session", "_session_id", "sessionid", "CFID", "CFTOKEN", "OCSESSID", "MoodleSession", "PLAY_SESSION", "SESSION", "_gitlab_session", "grafana_session", "frontend":
+		return true
+	}
+	return strings.HasPrefix(name, "ASPSESSIONID") || strings.HasPrefix(name, ".AspNetCore.Session") || strings.HasPrefix(name, "SESS") || strings.HasPrefix(name, "SSESS") || strings.HasPrefix(name, "wordpress_logged_in")
+}
+
+// FormatCookieReport renders the cookies of the redirect chain with their attributes and issues
+func FormatCookieReport(results []CookieResult) string {
+	var sb strings.Builder
+	sb.WriteString(color.New(color.FgYellow, color.Bold).Sprint("\nCookies:\n"))
+	if len(results) == 0 {
+		sb.WriteString("No cookies set by the page or its redirects\n")
+		return sb.String()
+	}
+
+	table := tablewriter.NewWriter(&sb)
+	table.SetHeader([]string{"Cookie", "Set By", "Attributes", "Issues"})
+	table.SetBorder(false)
+	table.SetRowLine(true)
+	table.SetAutoWrapText(false)
+
+	var technologies []string
+	seen := map[string]bool{}
+	for _, result := range results {
+		cookie := result.Cookie
+		attributes := []string{attributeFlag("Secure", cookie.Secure), attributeFlag("HttpOnly", cookie.HttpOnly), "SameSite=" + sameSiteName(cookie.SameSite)}
+		if cookie.Domain != "" {
+			attributes = append(attributes, "Domain="+cookie.Domain)
+		}
+		if cookie.Path != "" {
+			attributes = append(attributes, "Path="+cookie.Path)
+		}
+		switch {
+		case cookie.MaxAge > 0:
+			attributes = append(attributes, fmt.Sprintf("Max-Age=%d", cookie.MaxAge))
+		case !cookie.Expires.IsZero():
+			attributes = append(attributes, "Expires="+cookie.Expires.Format("2006-01-02"))
+		default:
+			attributes = append(attributes, "Session")
+		}
+
+		issues := color.GreenString("None")
+		if len(result.Issues) > 0 {
+			issues = color.RedString(strings.Join(result.Issues, "\n"))
+		}
+		table.Append([]string{cookie.Name, result.SetBy, strings.Join(attributes, "\n"), issues})
+
+		if result.Technology != "" && !seen[result.Technology] {
+			seen[result.Technology] = true
+			technologies = append(technologies, fmt.Sprintf("%s (%s)", result.Technology, cookie.Name))
+		}
+	}
+	table.Render()
+
+	if len(technologies) > 0 {
+		sb.WriteString(fmt.Sprintf("%s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Technologies revealed by cookie names:"), strings.Join(technologies, ", ")))
+	}
+	return sb.String()
+}
+
+func attributeFlag(name string, set bool) string {
+	if set {
+		return color.GreenString(name)
+	}
+	return color.RedString("no " + name)
+}
+
+func sameSiteName(mode http.SameSite) string {
+	switch mode {
+	case http.SameSiteLaxMode:
+		return "Lax"
+	case http.SameSiteStrictMode:
+		return "Strict"
+	case http.SameSiteNoneMode:
+		return "None"
+	default:
+		return color.RedString("unset")
+	}
+}
@@ -0,0 +1,262 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"golang.org/x/net/html"
+)
+
+// maxCORSEndpoints limits how many discovered URLs are tested
+const maxCORSEndpoints = 10
+
+// corsAttackerDomain is the attacker controlled site used in crafted origins
+const corsAttackerDomain = "dominfo-cors.example"
+
+// staticExtensions are skipped when discovering endpoints, CORS on assets is rarely interesting
+var staticExtensions = map[string]bool{
+	".css": true, ".js": true, ".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true,
+	".ico": true, ".woff": true, ".woff2": true, ".ttf": true, ".eot": true, ".webp": true, ".mp4": true, ".pdf": true,
+}
+
+// CORSTest is one crafted Origin sent to an endpoint and what the server answered
+type CORSTest struct {
+	Endpoint         string
+	Name             string
+	Origin           string
+	Preflight        bool
+	AllowOrigin      string
+	AllowCredentials bool
+	AllowMethods     string
+	AllowHeaders     string
+	Vary             string
+	Severity         string
+	Finding          string
+}
+
+// corsOrigins returns the crafted origins for a host: an arbitrary site, null, a suffix and a prefix trick
+// and a subdomain over plain HTTP, which a network attacker can impersonate
+func corsOrigins(scheme, host string) [][2]string {
+	return [][2]string{
+		{"Arbitrary origin", "https://" + corsAttackerDomain},
+		{"null origin", "null"},
+		// Defeats checks like strings.HasPrefix(origin, "https://example.com")
+		{"Suffix trick", scheme + "://" + host + "." + corsAttackerDomain},
+		// Defeats checks like strings.HasSuffix(origin, "example.com")
+		{"Prefix trick", scheme + "://dominfo" + host},
+		{"Plain HTTP subdomain", "http://dominfo." + host},
+	}
+}
+
+// DiscoverCORSEndpoints returns the landing page, its redirects and the same-host links of the page
+func DiscoverCORSEndpoints(domain string) ([]string, error) {
+	chain, err := FetchRedirectChain("https://" + domain + "/")
+	if len(chain) == 0 {
+		chain, err = FetchRedirectChain("http://" + domain + "/")
+	}
+	if len(chain) == 0 {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var endpoints []string
+	add := func(u *url.URL) {
+		u.Fragment = ""
+		if len(endpoints) >= maxCORSEndpoints || seen[u.String()] || staticExtensions[strings.ToLower(path.Ext(u.Path))] {
+			return
+		}
+		seen[u.String()] = true
+		endpoints = append(endpoints, u.String())
+	}
+	for _, resp := range chain {
+		add(resp.Request.URL)
+	}
+
+	final := chain[len(chain)-1]
+	for _, link := range pageLinks(final.Body) {
+		target, err := final.Request.URL.Parse(link)
+		if err != nil || target.Host != final.Request.URL.Host || (target.Scheme != "http" && target.Scheme != "https") {
+			continue
+		}
+		add(target)
+	}
+	return endpoints, nil
+}
+
+// pageLinks collects href, src and action attributes of an HTML page
+func pageLinks(body io.Reader) []string {
+	var links []string
+	tokenizer := html.NewTokenizer(body)
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return links
+		case html.StartTagToken, html.SelfClosingTagToken:
+			for _, attr := range tokenizer.Token().Attr {
+				if attr.Key == "href" || attr.Key == "src" || attr.Key == "action" {
+					links = append(links, attr.Val)
+				}
+			}
+		}
+	}
+}
+
+// TestCORS sends the crafted origins as simple requests and as preflights to an endpoint
+func TestCORS(endpoint string) []CORSTest {
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return nil
+	}
+	client := newRedirectClient()
+
+	var results []CORSTest
+	for _, origin := range corsOrigins(target.Scheme, target.Hostname()) {
+		for _, preflight := range []bool{false, true} {
+			method := http.MethodGet
+			if preflight {
+				method = http.MethodOptions
+			}
+			req, err := http.NewRequest(method, endpoint, nil)
+			if err != nil {
+				continue
+			}
+			req.Header.Set("Origin", origin[1])
+			if preflight {
+				req.Header.Set("Access-Control-Request-Method", "PUT")
+				req.Header.Set("Access-Control-Request-Headers", "authorization, x-requested-with")
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				continue
+			}
+			resp.Body.Close()
+
+			test := CORSTest{
+				Endpoint:         endpoint,
+				Name:             origin[0],
+				Origin:           origin[1],
+				Preflight:        preflight,
+				AllowOrigin:      resp.Header.Get("Access-Control-Allow-Origin"),
+				AllowCredentials: strings.EqualFold(strings.TrimSpace(resp.Header.Get("Access-Control-Allow-Credentials")), "true"),
+				AllowMethods:     resp.Header.Get("Access-Control-Allow-Methods"),
+				AllowHeaders:     resp.Header.Get("Access-Control-Allow-Headers"),
+				Vary:             strings.Join(resp.Header.Values("Vary"), ", "),
+			}
+			classifyCORSTest(&test)
+			results = append(results, test)
+		}
+	}
+	return results
+}
+
+// classifyCORSTest rates what the crafted origin is allowed to do
+func classifyCORSTest(test *CORSTest) {
+	allowOrigin := strings.TrimSpace(test.AllowOrigin)
+	reflected := allowOrigin == test.Origin
+	varyOrigin := strings.Contains(strings.ToLower(test.Vary), "origin")
+
+	switch {
+	case allowOrigin == "":
+		test.Severity, test.Finding = SeverityInfo, "Origin not allowed"
+		return
+	case reflected && test.AllowCredentials:
+		test.Severity, test.Finding = SeverityHigh, fmt.Sprintf("%s allowed with credentials, any page on it can read authenticated responses", test.Origin)
+	case reflected:
+		test.Severity, test.Finding = SeverityMedium, fmt.Sprintf("%s allowed, it can read unauthenticated responses", test.Origin)
+	case allowOrigin == "*" && test.AllowCredentials:
+		test.Severity, test.Finding = SeverityLow, "Wildcard with credentials, browsers refuse it but the intent is unsafe"
+	case allowOrigin == "*":
+		test.Severity, test.Finding = SeverityInfo, "Wildcard origin, public resource"
+	default:
+		test.Severity, test.Finding = SeverityInfo, "Fixed origin "+allowOrigin
+	}
+
+	if reflected && !varyOrigin {
+		test.Finding += "\nVary: Origin missing, caches can serve the reflected header to other sites"
+	}
+	if test.Preflight && reflected {
+		methods := strings.ToUpper(test.AllowMethods)
+		for _, method := range []string{"PUT", "DELETE", "PATCH", "*"} {
+			if strings.Contains(methods, method) {
+				test.Finding += "\nPreflight allows " + test.AllowMethods
+				break
+			}
+		}
+		if strings.TrimSpace(test.AllowHeaders) == "*" || strings.Contains(strings.ToLower(test.AllowHeaders), "authorization") {
+			test.Finding += "\nPreflight allows the Authorization header"
+		}
+	}
+}
+
+// GetCORSReport tests the landing page and the discovered endpoints of a domain for CORS misconfigurations
+func GetCORSReport(domain string) (string, error) {
+	endpoints, err := DiscoverCORSEndpoints(domain)
+	if err != nil {
+		return "", fmt.Errorf("could not discover endpoints: %w", err)
+	}
+
+	results := make([][]CORSTest, len(endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func(i int, endpoint string) {
+			defer wg.Done()
+			results[i] = TestCORS(endpoint)
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	var sb strings.Builder
+	sb.WriteString(color.New(color.FgYellow, color.Bold).Sprintf("\nCORS Misconfiguration Check for %s\n\n", domain))
+
+	table := tablewriter.NewWriter(&sb)
+	table.SetHeader([]string{"Endpoint", "Test", "Request", "Allow-Origin", "Credentials", "Result"})
+	table.SetBorder(false)
+	table.SetRowLine(true)
+	table.SetAutoWrapText(false)
+
+	vulnerable := 0
+	for _, endpointResults := range results {
+		for _, test := range endpointResults {
+			// Only answers that allow the crafted origin are worth a row
+			if test.AllowOrigin == "" {
+				continue
+			}
+			request := "GET"
+			if test.Preflight {
+				request = "OPTIONS"
+			}
+			severity := color.GreenString(test.Severity)
+			switch test.Severity {
+			case SeverityHigh:
+				severity = color.RedString(test.Severity)
+				vulnerable++
+			case SeverityMedium:
+				severity = color.YellowString(test.Severity)
+				vulnerable++
+			case SeverityLow:
+				severity = color.CyanString(test.Severity)
+			}
+			table.Append([]string{test.Endpoint, test.Name, request, test.AllowOrigin, fmt.Sprintf("%t", test.AllowCredentials), severity + " " + test.Finding})
+		}
+	}
+	if table.NumLines() == 0 {
+		sb.WriteString(fmt.Sprintf("Tested %d endpoints, none allowed a crafted origin\n", len(endpoints)))
+		return sb.String(), nil
+	}
+	table.Render()
+
+	if vulnerable > 0 {
+		sb.WriteString(color.RedString("\n%d responses allow an untrusted origin\n", vulnerable))
+	} else {
+		sb.WriteString(color.GreenString("\nNo untrusted origin is allowed\n"))
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,514 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	"golang.org/x/net/html"
+)
+
+// Severities of policy findings and the points each one costs
+const (
+	SeverityHigh   = "High"
+	SeverityMedium = "Medium"
+	SeverityLow    = "Low"
+	SeverityInfo   = "Info"
+)
+
+var severityPenalty = map[string]int{SeverityHigh: 25, SeverityMedium: 10, SeverityLow: 5}
+
+// metaIgnoredDirectives are not supported when a policy is delivered with <meta http-equiv>
+var metaIgnoredDirectives = map[string]bool{"frame-ancestors": true, "report-uri": true, "report-to": true, "sandbox": true}
+
+// CSPPolicy is a single Content-Security-Policy delivered by a header or a <meta> element
+type CSPPolicy struct {
+	Source     string // header, report-only header or meta
+	Raw        string
+	ReportOnly bool
+	Directives map[string][]string
+	Order      []string
+	Duplicates []string // repeated directives, only the first one is used by browsers
+}
+
+// CSPFinding is a problem or remark about a policy together with the change that fixes it
+type CSPFinding struct {
+	Severity string
+	Message  string
+	Fix      string
+}
+
+// CSPReport is the graded analysis of all policies of a page
+type CSPReport struct {
+	Policies []CSPPolicy
+	Findings []CSPFinding
+	Score    int
+	Grade    string
+}
+
+// ParseCSP splits a serialized policy into directives (CSP3 2.2.1), directive names are case-insensitive
+func ParseCSP(raw, source string, reportOnly bool) CSPPolicy {
+	policy := CSPPolicy{Source: source, Raw: raw, ReportOnly: reportOnly, Directives: map[string][]string{}}
+	for _, token := range strings.Split(raw, ";") {
+		fields := strings.Fields(token)
+		if len(fields) == 0 {
+			continue
+		}
+		name := strings.ToLower(fields[0])
+		if _, ok := policy.Directives[name]; ok {
+			policy.Duplicates = append(policy.Duplicates, name)
+			continue
+		}
+		var values []string
+		for _, value := range fields[1:] {
+			// Keywords are case-insensitive, hosts keep their spelling
+			if strings.HasPrefix(value, "'") {
+				value = strings.ToLower(value)
+			}
+			values = append(values, value)
+		}
+		policy.Directives[name] = values
+		policy.Order = append(policy.Order, name)
+	}
+	return policy
+}
+
+// effective returns the sources that apply to a fetch directive, falling back to default-src
+func (p CSPPolicy) effective(directive string) ([]string, string, bool) {
+	if values, ok := p.Directives[directive]; ok {
+		return values, directive, true
+	}
+	if directive == "script-src-elem" || directive == "script-src-attr" {
+		if values, ok := p.Directives["script-src"]; ok {
+			return values, "script-src", true
+		}
+	}
+	if values, ok := p.Directives["default-src"]; ok {
+		return values, "default-src", true
+	}
+	return nil, "", false
+}
+
+func hasSource(values []string, match func(string) bool) bool {
+	for _, value := range values {
+		if match(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func isNonceOrHash(value string) bool {
+	return strings.HasPrefix(value, "'nonce-") || strings.HasPrefix(value, "'sha256-") || strings.HasPrefix(value, "'sha384-") || strings.HasPrefix(value, "'sha512-")
+}
+
+// CollectCSPPolicies gathers the enforced and report-only header policies and the <meta http-equiv> policies of a response body
+func CollectCSPPolicies(header http.Header, body io.Reader) []CSPPolicy {
+	var policies []CSPPolicy
+	for _, raw := range header.Values("Content-Security-Policy") {
+		// Several policies may also be joined with commas in one header field
+		for _, part := range strings.Split(raw, ",") {
+			if strings.TrimSpace(part) != "" {
+				policies = append(policies, ParseCSP(strings.TrimSpace(part), "header", false))
+			}
+		}
+	}
+	for _, raw := range header.Values("Content-Security-Policy-Report-Only") {
+		for _, part := range strings.Split(raw, ",") {
+			if strings.TrimSpace(part) != "" {
+				policies = append(policies, ParseCSP(strings.TrimSpace(part), "report-only header", true))
+			}
+		}
+	}
+	if body != nil {
+		for _, raw := range metaCSPValues(body) {
+			policies = append(policies, ParseCSP(raw, "meta", false))
+		}
+	}
+	return policies
+}
+
+// metaCSPValues returns the content of <meta http-equiv="Content-Security-Policy"> elements
+func metaCSPValues(body io.Reader) []string {
+	var values []string
+	tokenizer := html.NewTokenizer(io.LimitReader(body, 2<<20))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return values
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.Data != "meta" {
+				continue
+			}
+			var httpEquiv, content string
+			for _, attr := range token.Attr {
+				switch strings.ToLower(attr.Key) {
+				case "http-equiv":
+					httpEquiv = attr.Val
+				case "content":
+					content = attr.Val
+				}
+			}
+			if strings.EqualFold(httpEquiv, "Content-Security-Policy") && content != "" {
+				values = append(values, content)
+			}
+		}
+	}
+}
+
+// AnalyzeCSP grades the policies of a page, enforced policies are combined since a resource must pass all of them
+func AnalyzeCSP(policies []CSPPolicy) CSPReport {
+	report := CSPReport{Policies: policies}
+	add := func(severity, message, fix string) {
+		report.Findings = append(report.Findings, CSPFinding{Severity: severity, Message: message, Fix: fix})
+	}
+
+	var enforced []CSPPolicy
+	for _, policy := range policies {
+		if !policy.ReportOnly {
+			enforced = append(enforced, policy)
+		}
+	}
+
+	switch {
+	case len(policies) == 0:
+		add(SeverityHigh, "No Content-Security-Policy", "Start with default-src 'self'; object-src 'none'; base-uri 'none'; frame-ancestors 'self' and add the sources the site needs")
+		report.Score, report.Grade = 0, "F"
+		return report
+	case len(enforced) == 0:
+		add(SeverityHigh, "Only a report-only policy is delivered, nothing is enforced", "Send the tested policy as Content-Security-Policy once the reports are clean")
+	case len(enforced) > 1:
+		add(SeverityInfo, fmt.Sprintf("%d enforced policies, a resource must be allowed by every one of them", len(enforced)), "Merge the policies into one header to keep them maintainable")
+		checkConflictingPolicies(enforced, add)
+	}
+
+	for _, policy := range policies {
+		for _, duplicate := range policy.Duplicates {
+			add(SeverityLow, fmt.Sprintf("Directive %s repeated in the %s policy, later occurrences are ignored", duplicate, policy.Source), "Merge the values into the first "+duplicate+" directive")
+		}
+		if policy.Source == "meta" {
+			for _, directive := range policy.Order {
+				if metaIgnoredDirectives[directive] {
+					add(SeverityMedium, directive+" is ignored in a <meta> policy", "Deliver "+directive+" in the Content-Security-Policy header")
+				}
+			}
+		}
+	}
+
+	// The combined enforced policies are graded, report-only policies are graded when nothing is enforced
+	graded := enforced
+	if len(graded) == 0 {
+		graded = policies
+	}
+	analyzeCSPPolicy(mergeCSPPolicies(graded), add)
+
+	report.Score = 100
+	for _, finding := range report.Findings {
+		report.Score -= severityPenalty[finding.Severity]
+	}
+	if report.Score < 0 {
+		report.Score = 0
+	}
+	report.Grade = gradeForScore(report.Score)
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return severityRank(report.Findings[i].Severity) < severityRank(report.Findings[j].Severity)
+	})
+	return report
+}
+
+// mergeCSPPolicies returns the combined effect of the enforced policies. A resource must be allowed by every
+// policy, so each source directive keeps the sources allowed by all policies that restrict it (fetch directives
+// fall back to default-src), other directives are kept from any policy.
+func mergeCSPPolicies(policies []CSPPolicy) CSPPolicy {
+	merged := CSPPolicy{Source: "combined", Directives: map[string][]string{}}
+	usable := func(policy CSPPolicy, name string) bool {
+		return !(policy.Source == "meta" && metaIgnoredDirectives[name])
+	}
+	for _, policy := range policies {
+		for _, name := range policy.Order {
+			if _, ok := merged.Directives[name]; ok || !usable(policy, name) {
+				continue
+			}
+			merged.Order = append(merged.Order, name)
+			merged.Directives[name] = policy.Directives[name]
+		}
+	}
+
+	for _, name := range merged.Order {
+		if !cspSourceDirectives[name] && !strings.HasSuffix(name, "-src") {
+			continue
+		}
+		var lists [][]string
+		for _, policy := range policies {
+			values, ok := policy.Directives[name]
+			if !ok && name != "default-src" && strings.HasSuffix(name, "-src") {
+				values, _, ok = policy.effective(name)
+			}
+			if ok && usable(policy, name) {
+				lists = append(lists, values)
+			}
+		}
+		merged.Directives[name] = intersectCSPSources(lists)
+	}
+	return merged
+}
+
+// cspSourceDirectives take source lists but do not fall back to default-src
+var cspSourceDirectives = map[string]bool{"base-uri": true, "form-action": true, "frame-ancestors": true}
+
+// intersectCSPSources returns the sources of the lists that every list allows, 'none' when nothing is left
+func intersectCSPSources(lists [][]string) []string {
+	var sources []string
+	seen := map[string]bool{}
+	for _, list := range lists {
+		for _, value := range list {
+			key := strings.ToLower(value)
+			if value == "'none'" || seen[key] {
+				continue
+			}
+			allowed := true
+			for _, other := range lists {
+				if !allowsCSPSource(other, value) {
+					allowed = false
+					break
+				}
+			}
+			if allowed {
+				seen[key] = true
+				sources = append(sources, value)
+			}
+		}
+	}
+	if len(sources) == 0 {
+		return []string{"'none'"}
+	}
+	return sources
+}
+
+// allowsCSPSource tells whether a source list allows everything a single source expression allows
+func allowsCSPSource(list []string, source string) bool {
+	lower := strings.ToLower(source)
+	isKeyword := strings.HasPrefix(source, "'")
+	scheme, _, hasScheme := strings.Cut(lower, ":")
+	for _, value := range list {
+		value = strings.ToLower(value)
+		switch {
+		case value == lower:
+			return true
+		case isKeyword:
+			// Keywords, nonces and hashes are only allowed by themselves
+		case value == "*":
+			// * matches hosts and network schemes, but not data:, blob: and filesystem:
+			if !hasScheme || (scheme != "data" && scheme != "blob" && scheme != "filesystem") {
+				return true
+			}
+		case strings.HasSuffix(value, ":") && hasScheme && value == scheme+":":
+			return true
+		case strings.HasPrefix(value, "*.") && strings.HasSuffix(hostOfCSPSource(lower), value[1:]):
+			return true
+		}
+	}
+	return false
+}
+
+// hostOfCSPSource returns the host of a host source such as https://cdn.example.com:443/path
+func hostOfCSPSource(source string) string {
+	if _, rest, ok := strings.Cut(source, "://"); ok {
+		source = rest
+	}
+	source, _, _ = strings.Cut(source, "/")
+	source, _, _ = strings.Cut(source, ":")
+	return source
+}
+
+// checkConflictingPolicies reports directives that allow a keyword in one enforced policy and forbid it in another
+func checkConflictingPolicies(policies []CSPPolicy, add func(severity, message, fix string)) {
+	for _, keyword := range []string{"'unsafe-inline'", "'unsafe-eval'", "'strict-dynamic'"} {
+		var allows, denies []string
+		for _, policy := range policies {
+			values, _, ok := policy.effective("script-src")
+			if !ok {
+				continue
+			}
+			if hasSource(values, func(v string) bool { return v == keyword }) {
+				allows = append(allows, policy.Source)
+			} else {
+				denies = append(denies, policy.Source)
+			}
+		}
+		if len(allows) > 0 && len(denies) > 0 {
+			add(SeverityLow, fmt.Sprintf("Conflicting script-src: %s allowed by the %s policy but not by the %s policy", keyword, strings.Join(allows, ", "), strings.Join(denies, ", ")), "Remove the conflicting policy so that the intended one is the only one applied")
+		}
+	}
+}
+
+func analyzeCSPPolicy(policy CSPPolicy, add func(severity, message, fix string)) {
+	scripts, scriptDirective, hasScripts := policy.effective("script-src")
+	if !hasScripts {
+		add(SeverityHigh, "No script-src or default-src, scripts from any origin are allowed", "Add script-src 'self' or a nonce based policy: script-src 'nonce-{random}' 'strict-dynamic'")
+	} else {
+		nonceOrHash := hasSource(scripts, isNonceOrHash)
+		strictDynamic := hasSource(scripts, func(v string) bool { return v == "'strict-dynamic'" })
+
+		if hasSource(scripts, func(v string) bool { return v == "'unsafe-inline'" }) {
+			if nonceOrHash {
+				add(SeverityInfo, scriptDirective+" has 'unsafe-inline' next to nonces or hashes, CSP2 browsers ignore it and it only serves old browsers", "")
+			} else {
+				add(SeverityHigh, scriptDirective+" allows 'unsafe-inline', inline scripts and event handlers run and XSS is not mitigated", "Replace 'unsafe-inline' with nonces ('nonce-{random}') or hashes ('sha256-...') of the inline scripts")
+			}
+		}
+		if hasSource(scripts, func(v string) bool { return v == "'unsafe-eval'" }) {
+			add(SeverityMedium, scriptDirective+" allows 'unsafe-eval', eval() and new Function() are permitted", "Remove 'unsafe-eval' and replace eval based code, or use 'wasm-unsafe-eval' if only WebAssembly needs it")
+		}
+		if !strictDynamic {
+			if hasSource(scripts, func(v string) bool { return v == "*" }) {
+				add(SeverityHigh, scriptDirective+" allows scripts from any host (*)", "Replace * with the exact hosts scripts are loaded from")
+			}
+			for _, scheme := range []string{"https:", "http:", "data:", "blob:"} {
+				if hasSource(scripts, func(v string) bool { return strings.EqualFold(v, scheme) }) {
+					add(SeverityHigh, fmt.Sprintf("%s allows the scheme source %s, scripts can be loaded from any such URL", scriptDirective, scheme), "Remove "+scheme+" from "+scriptDirective+" and list the exact hosts")
+				}
+			}
+			if hasSource(scripts, func(v string) bool { return strings.Contains(v, "*.") }) {
+				add(SeverityLow, scriptDirective+" uses wildcard host sources, any subdomain may serve scripts", "List the exact script hosts instead of *.domain wildcards")
+			}
+		}
+		if nonceOrHash {
+			add(SeverityInfo, scriptDirective+" uses nonces or hashes", "")
+			if strictDynamic {
+				add(SeverityInfo, scriptDirective+" uses 'strict-dynamic', host allowlists are ignored by modern browsers", "")
+			}
+		}
+	}
+
+	objects, objectDirective, hasObjects := policy.effective("object-src")
+	if !hasObjects || !(len(objects) == 1 && objects[0] == "'none'") {
+		if !hasObjects {
+			add(SeverityMedium, "object-src is missing and there is no default-src, plugins can load from any origin", "Add object-src 'none'")
+		} else if hasSource(objects, func(v string) bool {
+			return v == "*" || strings.EqualFold(v, "data:") || strings.EqualFold(v, "https:") || strings.EqualFold(v, "http:")
+		}) {
+			add(SeverityMedium, objectDirective+" allows plugin content from wildcard or data: sources", "Add object-src 'none'")
+		} else if objectDirective == "default-src" {
+			add(SeverityLow, "object-src is missing and falls back to default-src", "Add object-src 'none'")
+		}
+	}
+
+	if _, ok := policy.Directives["base-uri"]; !ok {
+		add(SeverityMedium, "base-uri is missing, injected <base> tags can redirect relative script URLs", "Add base-uri 'none' or base-uri 'self'")
+	}
+	if _, ok := policy.Directives["frame-ancestors"]; !ok {
+		add(SeverityMedium, "frame-ancestors is missing, the page can be framed (clickjacking)", "Add frame-ancestors 'none' or frame-ancestors 'self'")
+	} else if hasSource(policy.Directives["frame-ancestors"], func(v string) bool { return v == "*" || strings.EqualFold(v, "https:") }) {
+		add(SeverityMedium, "frame-ancestors allows any origin to frame the page", "Restrict frame-ancestors to 'self' or the exact origins")
+	}
+
+	for _, directive := range []string{"default-src", "style-src", "img-src", "connect-src", "frame-src", "form-action"} {
+		values, ok := policy.Directives[directive]
+		if !ok {
+			continue
+		}
+		if hasSource(values, func(v string) bool { return v == "*" }) {
+			add(SeverityLow, directive+" allows any host (*)", "Replace * in "+directive+" with the hosts in use")
+		}
+		if directive != "img-src" && hasSource(values, func(v string) bool { return strings.EqualFold(v, "data:") }) {
+			add(SeverityLow, directive+" allows data: URLs", "Remove data: from "+directive)
+		}
+	}
+	if styles, ok := policy.Directives["style-src"]; ok && hasSource(styles, func(v string) bool { return v == "'unsafe-inline'" }) && !hasSource(styles, isNonceOrHash) {
+		add(SeverityLow, "style-src allows 'unsafe-inline'", "Move inline styles to stylesheets or use nonces for <style> elements")
+	}
+
+	_, reportURI := policy.Directives["report-uri"]
+	_, reportTo := policy.Directives["report-to"]
+	if !reportURI && !reportTo {
+		add(SeverityLow, "No report-uri or report-to, violations are not reported", "Add report-to (with a Reporting-Endpoints header) and report-uri for older browsers")
+	}
+	if _, ok := policy.Directives["upgrade-insecure-requests"]; ok {
+		add(SeverityInfo, "upgrade-insecure-requests is set", "")
+	}
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case SeverityHigh:
+		return 0
+	case SeverityMedium:
+		return 1
+	case SeverityLow:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// gradeForScore maps a 0-100 score to a letter grade
+func gradeForScore(score int) string {
+	switch {
+	case score >= 90:
+		return "A"
+	case score >= 80:
+		return "B"
+	case score >= 70:
+		return "C"
+	case score >= 60:
+		return "D"
+	case score >= 50:
+		return "E"
+	default:
+		return "F"
+	}
+}
+
+// colorGrade colors a letter grade the same way in every report
+func colorGrade(grade string) string {
+	switch grade {
+	case "A", "A+":
+		return color.GreenString(grade)
+	case "B", "C":
+		return color.YellowString(grade)
+	default:
+		return color.RedString(grade)
+	}
+}
+
+// FormatCSPReport renders the policies and the findings with their fixes
+func FormatCSPReport(report CSPReport) string {
+	var sb strings.Builder
+	sb.WriteString(color.New(color.FgYellow, color.Bold).Sprint("\nContent-Security-Policy Analysis:\n"))
+	sb.WriteString(fmt.Sprintf("%s %s (score %d)\n", color.New(color.FgYellow, color.Bold).Sprint("Grade:"), colorGrade(report.Grade), report.Score))
+
+	for _, policy := range report.Policies {
+		sb.WriteString(color.New(color.FgYellow, color.Bold).Sprintf("\nPolicy (%s):\n", policy.Source))
+		for _, name := range policy.Order {
+			sb.WriteString(fmt.Sprintf("  %s %s\n", color.CyanString(name), strings.Join(policy.Directives[name], " ")))
+		}
+	}
+
+	sb.WriteString(color.New(color.FgYellow, color.Bold).Sprint("\nFindings:\n"))
+	if len(report.Findings) == 0 {
+		sb.WriteString(color.GreenString("  No issues found\n"))
+	}
+	for _, finding := range report.Findings {
+		severity := finding.Severity
+		switch severity {
+		case SeverityHigh:
+			severity = color.RedString(severity)
+		case SeverityMedium:
+			severity = color.YellowString(severity)
+		case SeverityLow:
+			severity = color.CyanString(severity)
+		default:
+			severity = color.GreenString(severity)
+		}
+		sb.WriteString(fmt.Sprintf("  [%s] %s\n", severity, finding.Message))
+		if finding.Fix != "" {
+			sb.WriteString(fmt.Sprintf("         Fix: %s\n", finding.Fix))
+		}
+	}
+	return sb.String()
+}
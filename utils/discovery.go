@@ -0,0 +1,389 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Content discovery settings, set from the command line
+var (
+	DiscoveryWordlist    string // file with extra paths, one per line
+	DiscoveryConcurrency = 10   // requests in flight at the same time
+	DiscoveryRate        = 20.0 // requests per second, 0 disables the limit
+)
+
+// discoveryPath is a path worth probing; Signature, when set, must match the body for a 200 to count
+type discoveryPath struct {
+	Path      string
+	Category  string
+	Severity  string
+	Signature *bodySignature
+}
+
+// bodySignature identifies a file by a magic byte prefix or by a pattern in its content
+type bodySignature struct {
+	prefix  []byte
+	pattern *regexp.Regexp
+}
+
+func sig(pattern string) *bodySignature {
+	return &bodySignature{pattern: regexp.MustCompile(pattern)}
+}
+
+func magic(prefix string) *bodySignature {
+	return &bodySignature{prefix: []byte(prefix)}
+}
+
+func (s *bodySignature) match(body []byte) bool {
+	if s.prefix != nil {
+		return bytes.HasPrefix(body, s.prefix)
+	}
+	return s.pattern.Match(bytes.TrimLeft(body, "\ufeff \r\n\t"))
+}
+
+func (s *bodySignature) String() string {
+	if s.prefix != nil {
+		return fmt.Sprintf("file signature %q", s.prefix)
+	}
+	return s.pattern.String()
+}
+
+// discoveryPaths is the curated list of high-signal paths
+var discoveryPaths = []discoveryPath{
+	{"/.git/HEAD", "Source control", SeverityHigh, sig(`^ref: refs/|^[0-9a-f]{40}`)},
+	{"/.git/config", "Source control", SeverityHigh, sig(`\[core\]`)},
+	{"/.svn/entries", "Source control", SeverityHigh, sig(`^\d+\s`)},
+	{"/.svn/wc.db", "Source control", SeverityHigh, magic("SQLite format 3")},
+	{"/.hg/requires", "Source control", SeverityHigh, sig(`revlogv1|store`)},
+	{"/.env", "Secrets", SeverityHigh, sig(`(?m)^[A-Z][A-Z0-9_]*=`)},
+	{"/.env.local", "Secrets", SeverityHigh, sig(`(?m)^[A-Z][A-Z0-9_]*=`)},
+	{"/.env.production", "Secrets", SeverityHigh, sig(`(?m)^[A-Z][A-Z0-9_]*=`)},
+	{"/config.php.bak", "Secrets", SeverityHigh, sig(`<\?php`)},
+	{"/wp-config.php.bak", "Secrets", SeverityHigh, sig(`DB_PASSWORD`)},
+	{"/wp-config.php~", "Secrets", SeverityHigh, sig(`DB_PASSWORD`)},
+	{"/.aws/credentials", "Secrets", SeverityHigh, sig(`aws_access_key_id`)},
+	{"/.npmrc", "Secrets", SeverityMedium, sig(`registry|_auth`)},
+	{"/.htpasswd", "Secrets", SeverityHigh, sig(`(?m)^[^:\s]+:\$?[A-Za-z0-9./$]+`)},
+	{"/web.config", "Configuration", SeverityMedium, sig(`<configuration`)},
+	{"/.htaccess", "Configuration", SeverityLow, sig(`(?i)rewrite|deny|allow|options`)},
+	{"/.DS_Store", "Directory listing", SeverityMedium, magic("\x00\x00\x00\x01Bud1")},
+	{"/server-status", "Server information", SeverityMedium, sig(`Apache Server Status`)},
+	{"/server-info", "Server information", SeverityMedium, sig(`Apache Server Information`)},
+	{"/nginx_status", "Server information", SeverityLow, sig(`Active connections`)},
+	{"/phpinfo.php", "Server information", SeverityHigh, sig(`phpinfo\(\)|PHP Version`)},
+	{"/info.php", "Server information", SeverityHigh, sig(`phpinfo\(\)|PHP Version`)},
+	{"/elmah.axd", "Server information", SeverityHigh, sig(`Error Log`)},
+	{"/trace.axd", "Server information", SeverityHigh, sig(`Application Trace`)},
+	{"/backup.zip", "Backup", SeverityHigh, magic("PK\x03\x04")},
+	{"/backup.tar.gz", "Backup", SeverityHigh, magic("\x1f\x8b")},
+	{"/site.zip", "Backup", SeverityHigh, magic("PK\x03\x04")},
+	{"/www.zip", "Backup", SeverityHigh, magic("PK\x03\x04")},
+	{"/backup.sql", "Backup", SeverityHigh, sig(`(?i)CREATE TABLE|INSERT INTO`)},
+	{"/dump.sql", "Backup", SeverityHigh, sig(`(?i)CREATE TABLE|INSERT INTO`)},
+	{"/database.sql", "Backup", SeverityHigh, sig(`(?i)CREATE TABLE|INSERT INTO`)},
+	{"/actuator", "Spring Boot actuator", SeverityMedium, sig(`"_links"`)},
+	{"/actuator/env", "Spring Boot actuator", SeverityHigh, sig(`propertySources|activeProfiles`)},
+	{"/actuator/heapdump", "Spring Boot actuator", SeverityHigh, magic("JAVA PROFILE")},
+	{"/actuator/mappings", "Spring Boot actuator", SeverityMedium, sig(`dispatcherServlet|mappings`)},
+	{"/swagger-ui.html", "API documentation", SeverityLow, sig(`(?i)swagger`)},
+	{"/swagger-ui/", "API documentation", SeverityLow, sig(`(?i)swagger`)},
+	{"/swagger.json", "API documentation", SeverityLow, sig(`"swagger"`)},
+	{"/v2/api-docs", "API documentation", SeverityLow, sig(`"swagger"`)},
+	{"/v3/api-docs", "API documentation", SeverityLow, sig(`"openapi"`)},
+	{"/openapi.json", "API documentation", SeverityLow, sig(`"openapi"`)},
+	{"/graphql", "API documentation", SeverityLow, sig(`(?i)graphql|"errors"`)},
+	{"/admin/", "Admin panel", SeverityMedium, nil},
+	{"/administrator/", "Admin panel", SeverityMedium, nil},
+	{"/wp-admin/", "Admin panel", SeverityLow, nil},
+	{"/wp-login.php", "Admin panel", SeverityLow, sig(`(?i)wordpress|user_login`)},
+	{"/phpmyadmin/", "Admin panel", SeverityHigh, sig(`(?i)phpMyAdmin`)},
+	{"/adminer.php", "Admin panel", SeverityHigh, sig(`(?i)adminer`)},
+	{"/manager/html", "Admin panel", SeverityHigh, nil},
+	{"/jenkins/", "Admin panel", SeverityMedium, sig(`(?i)jenkins`)},
+	{"/console/", "Admin panel", SeverityMedium, nil},
+	{"/_profiler/", "Debug tool", SeverityHigh, sig(`(?i)symfony profiler`)},
+	{"/debug/pprof/", "Debug tool", SeverityHigh, sig(`(?i)profile descriptions|goroutine`)},
+	{"/.vscode/sftp.json", "Secrets", SeverityHigh, sig(`"password"|"host"`)},
+	{"/crossdomain.xml", "Configuration", SeverityLow, sig(`allow-access-from domain="\*"`)},
+}
+
+// DiscoveryResult is a path that exists on the server
+type DiscoveryResult struct {
+	Path     string
+	Status   int
+	Size     int
+	Category string
+	Severity string
+	Evidence string
+}
+
+// softNotFound is the answer of the server for paths that do not exist
+type softNotFound struct {
+	Status   int
+	Size     int
+	Location string // same-host redirect target without the requested path
+}
+
+// matches reports whether a response looks like the baseline. The size is measured without the requested
+// path, which many not found pages echo, and may differ a little for pages with dynamic content.
+func (b softNotFound) matches(status, size int) bool {
+	if status != b.Status {
+		return false
+	}
+	diff := size - b.Size
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= 8 || diff*20 <= b.Size
+}
+
+// redirectWithoutPath is a same-host redirect target with the requested path removed, so that redirects that
+// only add a slash or carry the path in a query compare equal for every path
+func redirectWithoutPath(location, requestPath string) string {
+	if name := strings.Trim(requestPath, "/"); name != "" {
+		location = strings.ReplaceAll(location, name, "")
+	}
+	return location
+}
+
+// sizeWithoutPath is the body size with echoes of the requested path removed
+func sizeWithoutPath(body []byte, requestPath string) int {
+	return len(bytes.ReplaceAll(body, []byte(requestPath), nil))
+}
+
+// LoadDiscoveryWordlist reads extra paths from a file, lines starting with # are ignored
+func LoadDiscoveryWordlist(filename string) ([]discoveryPath, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var paths []discoveryPath
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, "/") {
+			line = "/" + line
+		}
+		paths = append(paths, discoveryPath{Path: line, Category: "Wordlist", Severity: SeverityLow})
+	}
+	return paths, scanner.Err()
+}
+
+// backupPaths adds archives named after the domain, e.g. example.com.zip and example.zip
+func backupPaths(domain string) []discoveryPath {
+	name := strings.Split(domain, ":")[0]
+	label := strings.SplitN(strings.TrimPrefix(name, "www."), ".", 2)[0]
+	var paths []discoveryPath
+	for _, base := range uniqueStrings([]string{name, label}) {
+		paths = append(paths,
+			discoveryPath{"/" + base + ".zip", "Backup", SeverityHigh, magic("PK\x03\x04")},
+			discoveryPath{"/" + base + ".tar.gz", "Backup", SeverityHigh, magic("\x1f\x8b")},
+			discoveryPath{"/" + base + ".sql", "Backup", SeverityHigh, sig(`(?i)CREATE TABLE|INSERT INTO`)},
+		)
+	}
+	return paths
+}
+
+// DiscoverPaths probes the paths with a concurrency and rate limit and returns the ones that exist
+func DiscoverPaths(baseURL string, paths []discoveryPath) ([]DiscoveryResult, error) {
+	client := newMethodClient()
+	// Redirects are not followed, fetch returns the target of a redirect to the same host
+	fetch := func(path string) (int, []byte, string, error) {
+		resp, err := client.Get(baseURL + path)
+		if err != nil {
+			return 0, nil, "", err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 256<<10))
+		location := ""
+		if target, err := resp.Location(); err == nil && target.Host == resp.Request.URL.Host {
+			location = target.RequestURI()
+		}
+		return resp.StatusCode, body, location, nil
+	}
+
+	// Random paths show how the server answers for missing files and folders
+	var baselines []softNotFound
+	for _, path := range []string{"/" + randomToken(), "/" + randomToken() + ".php", "/" + randomToken() + "/", "/." + randomToken()} {
+		status, body, location, err := fetch(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not request %s: %w", baseURL, err)
+		}
+		baselines = append(baselines, softNotFound{Status: status, Size: sizeWithoutPath(body, path), Location: redirectWithoutPath(location, path)})
+	}
+
+	var limiter <-chan time.Time
+	if DiscoveryRate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / DiscoveryRate))
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var results []DiscoveryResult
+	concurrencyLimit := make(chan struct{}, max(DiscoveryConcurrency, 1))
+
+	for _, candidate := range paths {
+		if limiter != nil {
+			<-limiter
+		}
+		wg.Add(1)
+		concurrencyLimit <- struct{}{} // Acquire a slot
+		go func(candidate discoveryPath) {
+			defer wg.Done()
+			defer func() { <-concurrencyLimit }() // Release the slot
+
+			status, body, location, err := fetch(candidate.Path)
+			if err != nil {
+				return
+			}
+			result, ok := classifyDiscovery(candidate, status, body, location, baselines)
+			if ok {
+				mu.Lock()
+				results = append(results, result)
+				mu.Unlock()
+			}
+		}(candidate)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Severity != results[j].Severity {
+			return severityRank(results[i].Severity) < severityRank(results[j].Severity)
+		}
+		return results[i].Path < results[j].Path
+	})
+	return results, nil
+}
+
+// classifyDiscovery decides whether a response proves that the path exists
+func classifyDiscovery(candidate discoveryPath, status int, body []byte, location string, baselines []softNotFound) (DiscoveryResult, bool) {
+	result := DiscoveryResult{Path: candidate.Path, Status: status, Size: len(body), Category: candidate.Category, Severity: candidate.Severity}
+	size := sizeWithoutPath(body, candidate.Path)
+
+	// Admin panels usually redirect to their login page, a redirect counts when missing paths go elsewhere
+	if status >= 300 && status < 400 {
+		if location == "" {
+			return result, false
+		}
+		target := redirectWithoutPath(location, candidate.Path)
+		for _, baseline := range baselines {
+			if baseline.Status == status && baseline.Location == target {
+				return result, false
+			}
+		}
+		result.Evidence = "Redirects to " + location
+		if result.Severity == SeverityHigh {
+			result.Severity = SeverityLow
+		} else {
+			result.Severity = SeverityInfo
+		}
+		return result, true
+	}
+
+	if status == http.StatusOK && candidate.Signature != nil {
+		// Soft not found pages often echo the requested path, which would satisfy name based patterns
+		if candidate.Signature.pattern != nil {
+			for _, baseline := range baselines {
+				if baseline.matches(status, size) {
+					return result, false
+				}
+			}
+			body = bytes.ReplaceAll(body, []byte(candidate.Path), nil)
+			body = bytes.ReplaceAll(body, []byte(strings.Trim(path.Base(candidate.Path), "/")), nil)
+		}
+		if candidate.Signature.match(body) {
+			result.Evidence = "Content matches " + candidate.Signature.String()
+			return result, true
+		}
+		return result, false
+	}
+	for _, baseline := range baselines {
+		if baseline.matches(status, size) {
+			return result, false
+		}
+	}
+
+	switch {
+	case status == http.StatusOK:
+		result.Evidence = "Differs from the not found response"
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		result.Evidence = "Exists but access is denied"
+		if result.Severity == SeverityHigh {
+			result.Severity = SeverityLow
+		} else {
+			result.Severity = SeverityInfo
+		}
+	default:
+		return result, false
+	}
+	return result, true
+}
+
+// GetDiscoveryReport probes the curated paths and the custom wordlist on a domain
+func GetDiscoveryReport(domain string) (string, error) {
+	baseURL, err := CheckURL(domain)
+	if err != nil {
+		return "", err
+	}
+
+	paths := append(append([]discoveryPath{}, discoveryPaths...), backupPaths(domain)...)
+	if DiscoveryWordlist != "" {
+		custom, err := LoadDiscoveryWordlist(DiscoveryWordlist)
+		if err != nil {
+			return "", fmt.Errorf("could not read wordlist %s: %w", DiscoveryWordlist, err)
+		}
+		paths = append(paths, custom...)
+	}
+
+	results, err := DiscoverPaths(baseURL, paths)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(color.New(color.FgYellow, color.Bold).Sprintf("\nSensitive Files and Exposed Paths for %s\n\n", baseURL))
+	if len(results) == 0 {
+		sb.WriteString(color.GreenString("None of the %d probed paths were found\n", len(paths)))
+		return sb.String(), nil
+	}
+
+	table := tablewriter.NewWriter(&sb)
+	table.SetHeader([]string{"Path", "Status", "Size", "Category", "Severity", "Evidence"})
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	for _, result := range results {
+		severity := result.Severity
+		switch severity {
+		case SeverityHigh:
+			severity = color.RedString(severity)
+		case SeverityMedium:
+			severity = color.YellowString(severity)
+		case SeverityLow:
+			severity = color.CyanString(severity)
+		}
+		table.Append([]string{result.Path, fmt.Sprintf("%d", result.Status), fmt.Sprintf("%d", result.Size), result.Category, severity, result.Evidence})
+	}
+	table.Render()
+	sb.WriteString(fmt.Sprintf("%d of %d probed paths found\n", len(results), len(paths)))
+	return sb.String(), nil
+}
@@ -1,7 +1,10 @@
 package utils
 
 import (
+	"bytes"
+	"context"
 	"net"
+	"sort"
 	"strings"
 	"time"
 
@@ -14,6 +17,43 @@ func IsValidDomain(domain string) bool {
 	return err == nil
 }
 
+// ResolveAddresses returns every IPv4 and IPv6 address of a host, IPv4 first, or the host itself when it is an IP
+func ResolveAddresses(host string) ([]net.IP, error) {
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var addresses []net.IP
+	for _, ip := range ips {
+		if !seen[ip.String()] {
+			seen[ip.String()] = true
+			addresses = append(addresses, ip)
+		}
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		if v4i, v4j := addresses[i].To4() != nil, addresses[j].To4() != nil; v4i != v4j {
+			return v4i
+		}
+		return bytes.Compare(addresses[i].To16(), addresses[j].To16()) < 0
+	})
+	return addresses, nil
+}
+
+// AddressFamily returns IPv4 or IPv6
+func AddressFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return "IPv4"
+	}
+	return "IPv6"
+}
+
 // GetDNSRecords fetches DNS records for a domain
 func GetDNSRecords(domain string) (string, error) {
 	recordTypes := []uint16{
@@ -0,0 +1,312 @@
+package utils
+
+import (
+	"crypto/md5"
+	"crypto/tls"
+	_ "embed"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultFavicons maps products to the Shodan hashes of their default favicon
+//
+//go:embed favicons.json
+var defaultFavicons []byte
+
+// FaviconDBPath is an extra favicon database, its products replace built-in ones with the same name
+var FaviconDBPath string
+
+// maxFaviconSize limits the icons that are downloaded
+const maxFaviconSize = 1 << 20
+
+// FaviconSignature holds the hashes that identify a product, html are structure hashes of its pages
+type FaviconSignature struct {
+	MMH3 []int32  `json:"mmh3"`
+	MD5  []string `json:"md5"`
+	HTML []string `json:"html"`
+}
+
+// Favicon is a downloaded icon with its hashes
+type Favicon struct {
+	URL      string
+	Size     int
+	MMH3     int32 // Shodan http.favicon.hash
+	MD5      string
+	Products []string
+}
+
+// PageFingerprint holds the hashes of a page that identify a product when the headers reveal nothing
+type PageFingerprint struct {
+	Title         string
+	Generator     string
+	HTMLHash      int32 // Shodan http.html_hash
+	StructureHash string
+	Favicons      []Favicon
+	Products      []string // products matched by the structure hash
+}
+
+var (
+	faviconOnce sync.Once
+	faviconDB   map[string]FaviconSignature
+	faviconErr  error
+)
+
+// FaviconDB returns the built-in favicon database merged with FaviconDBPath, it is loaded once
+func FaviconDB() (map[string]FaviconSignature, error) {
+	faviconOnce.Do(func() {
+		faviconDB = map[string]FaviconSignature{}
+		if faviconErr = json.Unmarshal(defaultFavicons, &faviconDB); faviconErr != nil {
+			return
+		}
+		if FaviconDBPath != "" {
+			data, err := os.ReadFile(FaviconDBPath)
+			if err != nil {
+				faviconErr = fmt.Errorf("could not read favicon database: %w", err)
+				return
+			}
+			if err := json.Unmarshal(data, &faviconDB); err != nil {
+				faviconErr = fmt.Errorf("%s: %w", FaviconDBPath, err)
+			}
+		}
+	})
+	return faviconDB, faviconErr
+}
+
+// Murmur3 is the 32-bit x86 MurmurHash3 with seed 0 as a signed integer, like the mmh3 Python module
+func Murmur3(data []byte) int32 {
+	const c1, c2 = 0xcc9e2d51, 0x1b873593
+	var h uint32
+	n := len(data) / 4
+	for i := 0; i < n; i++ {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	var k uint32
+	tail := data[n*4:]
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return int32(h)
+}
+
+// ShodanFaviconHash hashes an icon like Shodan does: MurmurHash3 of the base64 encoding with a newline every
+// 76 characters and at the end, which is what Python's base64.encodebytes produces
+func ShodanFaviconHash(data []byte) int32 {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var sb strings.Builder
+	for len(encoded) > 76 {
+		sb.WriteString(encoded[:76] + "\n")
+		encoded = encoded[76:]
+	}
+	sb.WriteString(encoded + "\n")
+	return Murmur3([]byte(sb.String()))
+}
+
+// HTMLStructureHash hashes the sequence of tags of a page, it stays the same when only text, tokens or
+// timestamps change, so pages rendered by the same product template share it
+func HTMLStructureHash(tags []string) string {
+	sum := md5.Sum([]byte(strings.Join(tags, " ")))
+	return hex.EncodeToString(sum[:])
+}
+
+// faviconURLs returns the icons declared by the page and /favicon.ico
+func faviconURLs(page FingerprintPage) []string {
+	base, err := url.Parse(page.URL)
+	if err != nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var urls []string
+	for _, href := range append(page.Icons, "/favicon.ico") {
+		if strings.HasPrefix(href, "data:") {
+			if !seen[href] {
+				seen[href] = true
+				urls = append(urls, href)
+			}
+			continue
+		}
+		target, err := base.Parse(href)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || seen[target.String()] {
+			continue
+		}
+		seen[target.String()] = true
+		urls = append(urls, target.String())
+	}
+	return urls
+}
+
+// fetchFavicon downloads an icon or decodes a data: URI. Error pages served instead of the icon are rejected.
+func fetchFavicon(client *http.Client, rawURL string) ([]byte, error) {
+	if data, ok := strings.CutPrefix(rawURL, "data:"); ok {
+		meta, payload, _ := strings.Cut(data, ",")
+		if !strings.HasSuffix(meta, ";base64") {
+			return []byte(payload), nil
+		}
+		return base64.StdEncoding.DecodeString(payload)
+	}
+
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFaviconSize))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) == 0 || strings.Contains(resp.Header.Get("Content-Type"), "text/html") {
+		return nil, fmt.Errorf("not an icon")
+	}
+	return body, nil
+}
+
+// FingerprintHashes fetches the favicons of a page and computes its hashes, matching them against the favicon database
+func FingerprintHashes(page FingerprintPage) (PageFingerprint, error) {
+	db, err := FaviconDB()
+	if err != nil {
+		return PageFingerprint{}, err
+	}
+	result := PageFingerprint{
+		Title:         page.Title,
+		HTMLHash:      Murmur3([]byte(page.HTML)),
+		StructureHash: HTMLStructureHash(page.Tags),
+	}
+	if generators := page.Meta["generator"]; len(generators) > 0 {
+		result.Generator = generators[0]
+	}
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	for _, iconURL := range faviconURLs(page) {
+		data, err := fetchFavicon(client, iconURL)
+		if err != nil {
+			continue
+		}
+		sum := md5.Sum(data)
+		favicon := Favicon{URL: iconURL, Size: len(data), MMH3: ShodanFaviconHash(data), MD5: hex.EncodeToString(sum[:])}
+		if len(favicon.URL) > 80 {
+			favicon.URL = favicon.URL[:77] + "..."
+		}
+		for product, signature := range db {
+			if signature.matches(favicon) {
+				favicon.Products = append(favicon.Products, product)
+			}
+		}
+		sort.Strings(favicon.Products)
+		result.Favicons = append(result.Favicons, favicon)
+	}
+
+	for product, signature := range db {
+		for _, hash := range signature.HTML {
+			if strings.EqualFold(hash, result.StructureHash) {
+				result.Products = append(result.Products, product)
+			}
+		}
+	}
+	sort.Strings(result.Products)
+	return result, nil
+}
+
+func (s FaviconSignature) matches(favicon Favicon) bool {
+	for _, hash := range s.MMH3 {
+		if hash == favicon.MMH3 {
+			return true
+		}
+	}
+	for _, hash := range s.MD5 {
+		if strings.EqualFold(hash, favicon.MD5) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddProduct adds a product identified outside the rules, the rules file provides its categories and CPE when it knows the name
+func (db *FingerprintDB) AddProduct(detected []DetectedTechnology, name, evidence string) []DetectedTechnology {
+	for i := range detected {
+		if detected[i].Name == name {
+			detected[i].Evidence = append(detected[i].Evidence, evidence)
+			return detected
+		}
+	}
+	product := DetectedTechnology{Name: name, Confidence: 100, Evidence: []string{evidence}}
+	if technology, ok := db.Technologies[name]; ok {
+		product.Categories, product.Website, product.CPE = technology.Categories, technology.Website, technology.CPE
+	}
+	detected = append(detected, product)
+	sort.Slice(detected, func(i, j int) bool {
+		return detected[i].Name < detected[j].Name
+	})
+	return detected
+}
+
+// FormatPageFingerprint lists the title, generator, hashes and favicons of a page
+func FormatPageFingerprint(fingerprint PageFingerprint) string {
+	var lines []string
+	if fingerprint.Title != "" {
+		lines = append(lines, "Title: "+fingerprint.Title)
+	}
+	if fingerprint.Generator != "" {
+		lines = append(lines, "Generator: "+fingerprint.Generator)
+	}
+	lines = append(lines, fmt.Sprintf("HTML Hash: %d (Shodan http.html_hash)", fingerprint.HTMLHash))
+	structure := "Structure Hash: " + fingerprint.StructureHash
+	if len(fingerprint.Products) > 0 {
+		structure += " -> " + strings.Join(fingerprint.Products, ", ")
+	}
+	lines = append(lines, structure)
+	if len(fingerprint.Favicons) == 0 {
+		lines = append(lines, "Favicon: not found")
+	}
+	for _, favicon := range fingerprint.Favicons {
+		line := fmt.Sprintf("Favicon: %s (%d bytes) mmh3 %d, md5 %s, Shodan query http.favicon.hash:%d", favicon.URL, favicon.Size, favicon.MMH3, favicon.MD5, favicon.MMH3)
+		if len(favicon.Products) > 0 {
+			line += " -> " + strings.Join(favicon.Products, ", ")
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,478 @@
+package utils
+
+import (
+	"crypto/tls"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// defaultTechnologies are the built-in fingerprints in the Wappalyzer format
+//
+//go:embed technologies.json
+var defaultTechnologies []byte
+
+// TechRulesPath is an extra rules file in the Wappalyzer format, its technologies replace built-in ones with the same name
+var TechRulesPath string
+
+// stringList accepts the string or array of strings the Wappalyzer format allows for every pattern
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = stringList{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// technologyRule is one technology as written in the rules file, keys the engine cannot evaluate (dom, css, dns...) are ignored
+type technologyRule struct {
+	Cats      []int                 `json:"cats"`
+	CPE       string                `json:"cpe"`
+	Website   string                `json:"website"`
+	Headers   map[string]stringList `json:"headers"`
+	Cookies   map[string]stringList `json:"cookies"`
+	Meta      map[string]stringList `json:"meta"`
+	JS        map[string]stringList `json:"js"`
+	ScriptSrc stringList            `json:"scriptSrc"`
+	Scripts   stringList            `json:"scripts"`
+	HTML      stringList            `json:"html"`
+	URL       stringList            `json:"url"`
+	Implies   stringList            `json:"implies"`
+	Excludes  stringList            `json:"excludes"`
+}
+
+// techPattern is a compiled pattern with the version template and confidence given after \; in the rules file
+type techPattern struct {
+	Regex      *regexp.Regexp
+	Version    string
+	Confidence int
+}
+
+// jsGlobal is a JavaScript property chain such as jQuery.fn.jquery, found by the assignment in inline scripts
+type jsGlobal struct {
+	Chain    string
+	Regex    *regexp.Regexp
+	Patterns []techPattern
+}
+
+// Technology is a compiled fingerprint
+type Technology struct {
+	Name       string
+	Categories []string
+	Website    string
+	CPE        string
+	Headers    map[string][]techPattern // lowercase header names
+	Cookies    map[string][]techPattern // names ending in * are prefixes
+	Meta       map[string][]techPattern // lowercase meta names
+	JS         []jsGlobal
+	ScriptSrc  []techPattern
+	Scripts    []techPattern
+	HTML       []techPattern
+	URL        []techPattern
+	Implies    []string
+	Excludes   []string
+}
+
+// FingerprintDB holds the technologies loaded from the rules files
+type FingerprintDB struct {
+	Technologies map[string]*Technology
+	Categories   map[int]string
+	Skipped      int // patterns that do not compile with RE2, mostly lookarounds
+}
+
+// FingerprintPage is what the engine matches the rules against
+type FingerprintPage struct {
+	URL       string
+	Headers   http.Header
+	Cookies   map[string]string
+	Meta      map[string][]string
+	ScriptSrc []string
+	Scripts   []string // inline script contents
+	HTML      string
+	Title     string
+	Icons     []string // href of the link rel=icon tags
+	Tags      []string // start tag names in document order, the structure of the page
+}
+
+// DetectedTechnology is a technology found on a page
+type DetectedTechnology struct {
+	Name       string
+	Version    string
+	Confidence int
+	Categories []string
+	Website    string
+	CPE        string
+	Evidence   []string
+}
+
+var (
+	fingerprintOnce sync.Once
+	fingerprintDB   *FingerprintDB
+	fingerprintErr  error
+)
+
+// Fingerprints returns the built-in rules merged with TechRulesPath, they are loaded once
+func Fingerprints() (*FingerprintDB, error) {
+	fingerprintOnce.Do(func() {
+		fingerprintDB = &FingerprintDB{Technologies: map[string]*Technology{}, Categories: map[int]string{}}
+		if fingerprintErr = fingerprintDB.Load(defaultTechnologies); fingerprintErr != nil {
+			return
+		}
+		if TechRulesPath != "" {
+			data, err := os.ReadFile(TechRulesPath)
+			if err != nil {
+				fingerprintErr = fmt.Errorf("could not read technology rules: %w", err)
+				return
+			}
+			if err := fingerprintDB.Load(data); err != nil {
+				fingerprintErr = fmt.Errorf("%s: %w", TechRulesPath, err)
+			}
+		}
+	})
+	return fingerprintDB, fingerprintErr
+}
+
+// Load adds the technologies of a rules file. Both the full file with "categories" and "technologies" and the
+// per-letter files of the Wappalyzer repository, which only map names to technologies and use the categories loaded before, are accepted.
+func (db *FingerprintDB) Load(data []byte) error {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return fmt.Errorf("invalid rules file: %w", err)
+	}
+	rawTechnologies := data
+	if technologies, ok := top["technologies"]; ok {
+		rawTechnologies = technologies
+		if rawCategories, ok := top["categories"]; ok {
+			var named map[string]struct {
+				Name string `json:"name"`
+			}
+			if err := json.Unmarshal(rawCategories, &named); err != nil {
+				return fmt.Errorf("invalid categories: %w", err)
+			}
+			for id, category := range named {
+				if n, err := strconv.Atoi(id); err == nil {
+					db.Categories[n] = category.Name
+				}
+			}
+		}
+	}
+
+	var rules map[string]technologyRule
+	if err := json.Unmarshal(rawTechnologies, &rules); err != nil {
+		return fmt.Errorf("invalid technologies: %w", err)
+	}
+	for name, rule := range rules {
+		db.Technologies[name] = db.compile(name, rule)
+	}
+	return nil
+}
+
+func (db *FingerprintDB) compile(name string, rule technologyRule) *Technology {
+	technology := &Technology{
+		Name:      name,
+		Website:   rule.Website,
+		CPE:       rule.CPE,
+		Headers:   map[string][]techPattern{},
+		Cookies:   map[string][]techPattern{},
+		Meta:      map[string][]techPattern{},
+		ScriptSrc: db.patterns(rule.ScriptSrc),
+		Scripts:   db.patterns(rule.Scripts),
+		HTML:      db.patterns(rule.HTML),
+		URL:       db.patterns(rule.URL),
+	}
+	for _, id := range rule.Cats {
+		if category, ok := db.Categories[id]; ok {
+			technology.Categories = append(technology.Categories, category)
+		}
+	}
+	for header, patterns := range rule.Headers {
+		technology.Headers[strings.ToLower(header)] = db.patterns(patterns)
+	}
+	for cookie, patterns := range rule.Cookies {
+		technology.Cookies[cookie] = db.patterns(patterns)
+	}
+	for meta, patterns := range rule.Meta {
+		technology.Meta[strings.ToLower(meta)] = db.patterns(patterns)
+	}
+	for chain, patterns := range rule.JS {
+		// The chain must not be part of a longer name, an assigned string or number literal is its value
+		global := jsGlobal{Chain: chain, Patterns: db.patterns(patterns)}
+		global.Regex = regexp.MustCompile(`(?:^|[^\w$.])(?:window\.)?` + regexp.QuoteMeta(chain) + `\b(?:\s*=\s*(?:["']([^"'\n]*)["']|([\w.\-]+)))?`)
+		technology.JS = append(technology.JS, global)
+	}
+	// Implied and excluded names may carry a confidence, which is ignored
+	for _, implied := range rule.Implies {
+		technology.Implies = append(technology.Implies, strings.SplitN(implied, `\;`, 2)[0])
+	}
+	for _, excluded := range rule.Excludes {
+		technology.Excludes = append(technology.Excludes, strings.SplitN(excluded, `\;`, 2)[0])
+	}
+	return technology
+}
+
+// patterns compiles Wappalyzer patterns like "nginx(?:/([\d.]+))?\;version:\1\;confidence:50", matching is case-insensitive
+func (db *FingerprintDB) patterns(raw []string) []techPattern {
+	var compiled []techPattern
+	for _, value := range raw {
+		parts := strings.Split(value, `\;`)
+		regex, err := regexp.Compile("(?i)" + parts[0])
+		if err != nil {
+			db.Skipped++
+			continue
+		}
+		pattern := techPattern{Regex: regex, Confidence: 100}
+		for _, part := range parts[1:] {
+			key, val, _ := strings.Cut(part, ":")
+			switch key {
+			case "version":
+				pattern.Version = val
+			case "confidence":
+				if n, err := strconv.Atoi(val); err == nil {
+					pattern.Confidence = n
+				}
+			}
+		}
+		compiled = append(compiled, pattern)
+	}
+	return compiled
+}
+
+// versionTernary matches the \1?yes:no form of version templates
+var versionTernary = regexp.MustCompile(`\\(\d+)\?([^:]*):(.*)$`)
+
+// match tests a value and resolves the version template with the captured groups
+func (p techPattern) match(value string) (string, bool) {
+	groups := p.Regex.FindStringSubmatch(value)
+	if groups == nil {
+		return "", false
+	}
+	version := p.Version
+	if m := versionTernary.FindStringSubmatch(version); m != nil {
+		index, _ := strconv.Atoi(m[1])
+		replacement := m[3]
+		if index < len(groups) && groups[index] != "" {
+			replacement = m[2]
+		}
+		version = strings.Replace(version, m[0], replacement, 1)
+	}
+	// Higher group numbers first so \1 does not eat the start of \10
+	for i := len(groups) - 1; i >= 1; i-- {
+		version = strings.ReplaceAll(version, `\`+strconv.Itoa(i), groups[i])
+	}
+	return strings.TrimSpace(version), true
+}
+
+// Analyze matches every technology against a page and adds the implied ones
+func (db *FingerprintDB) Analyze(page FingerprintPage) []DetectedTechnology {
+	detected := map[string]*DetectedTechnology{}
+	found := func(technology *Technology, pattern techPattern, value, evidence string) {
+		version, ok := pattern.match(value)
+		if !ok {
+			return
+		}
+		result, ok := detected[technology.Name]
+		if !ok {
+			result = &DetectedTechnology{Name: technology.Name, Categories: technology.Categories, Website: technology.Website, CPE: technology.CPE}
+			detected[technology.Name] = result
+		}
+		result.Confidence = min(100, result.Confidence+pattern.Confidence)
+		// The longest version is the most precise one
+		if len(version) > len(result.Version) {
+			result.Version = version
+		}
+		for _, e := range result.Evidence {
+			if e == evidence {
+				return
+			}
+		}
+		result.Evidence = append(result.Evidence, evidence)
+	}
+	matchAll := func(technology *Technology, patterns []techPattern, values []string, evidence string) {
+		for _, pattern := range patterns {
+			for _, value := range values {
+				found(technology, pattern, value, evidence)
+			}
+		}
+	}
+
+	for _, technology := range db.Technologies {
+		for header, patterns := range technology.Headers {
+			if values := page.Headers.Values(header); len(values) > 0 {
+				matchAll(technology, patterns, values, "header "+http.CanonicalHeaderKey(header))
+			}
+		}
+		for name, patterns := range technology.Cookies {
+			for cookie, value := range page.Cookies {
+				prefix, isPrefix := strings.CutSuffix(name, "*")
+				if cookie == name || (isPrefix && strings.HasPrefix(cookie, prefix)) {
+					matchAll(technology, patterns, []string{value}, "cookie "+cookie)
+				}
+			}
+		}
+		for name, patterns := range technology.Meta {
+			matchAll(technology, patterns, page.Meta[name], "meta "+name)
+		}
+		for _, global := range technology.JS {
+			for _, script := range page.Scripts {
+				m := global.Regex.FindStringSubmatch(script)
+				if m == nil {
+					continue
+				}
+				matchAll(technology, global.Patterns, []string{m[1] + m[2]}, "js "+global.Chain)
+				break
+			}
+		}
+		matchAll(technology, technology.ScriptSrc, page.ScriptSrc, "script src")
+		matchAll(technology, technology.Scripts, page.Scripts, "inline script")
+		matchAll(technology, technology.HTML, []string{page.HTML}, "html")
+		matchAll(technology, technology.URL, []string{page.URL}, "url")
+	}
+
+	// Implied technologies can imply others in turn
+	for changed := true; changed; {
+		changed = false
+		for name := range detected {
+			for _, implied := range db.Technologies[name].Implies {
+				technology, ok := db.Technologies[implied]
+				if _, seen := detected[implied]; seen || !ok {
+					continue
+				}
+				detected[implied] = &DetectedTechnology{Name: implied, Confidence: detected[name].Confidence, Categories: technology.Categories, Website: technology.Website, CPE: technology.CPE, Evidence: []string{"implied by " + name}}
+				changed = true
+			}
+		}
+	}
+	for name := range detected {
+		for _, excluded := range db.Technologies[name].Excludes {
+			delete(detected, excluded)
+		}
+	}
+
+	results := make([]DetectedTechnology, 0, len(detected))
+	for _, result := range detected {
+		results = append(results, *result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+// ParseFingerprintPage extracts the meta tags, script sources and inline scripts of an HTML body
+func ParseFingerprintPage(rawURL string, header http.Header, cookies map[string]string, body []byte) FingerprintPage {
+	page := FingerprintPage{URL: rawURL, Headers: header, Cookies: cookies, Meta: map[string][]string{}, HTML: string(body)}
+	tokenizer := html.NewTokenizer(strings.NewReader(page.HTML))
+	inScript, inTitle := false, false
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			page.Title = strings.Join(strings.Fields(page.Title), " ")
+			return page
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			page.Tags = append(page.Tags, token.Data)
+			attrs := map[string]string{}
+			for _, attr := range token.Attr {
+				attrs[strings.ToLower(attr.Key)] = attr.Val
+			}
+			switch token.Data {
+			case "title":
+				inTitle = token.Type == html.StartTagToken && page.Title == ""
+			case "link":
+				// rel="icon", "shortcut icon", "apple-touch-icon" and "mask-icon"
+				if strings.Contains(strings.ToLower(attrs["rel"]), "icon") && attrs["href"] != "" {
+					page.Icons = append(page.Icons, attrs["href"])
+				}
+			case "meta":
+				name := attrs["name"]
+				if name == "" {
+					name = attrs["property"]
+				}
+				if name != "" {
+					page.Meta[strings.ToLower(name)] = append(page.Meta[strings.ToLower(name)], attrs["content"])
+				}
+			case "script":
+				if src := attrs["src"]; src != "" {
+					page.ScriptSrc = append(page.ScriptSrc, src)
+				}
+				inScript = token.Type == html.StartTagToken
+			}
+		case html.TextToken:
+			if inScript {
+				page.Scripts = append(page.Scripts, string(tokenizer.Text()))
+			}
+			if inTitle {
+				page.Title += string(tokenizer.Text())
+			}
+		case html.EndTagToken:
+			inScript, inTitle = false, false
+		}
+	}
+}
+
+// FetchFingerprintPage requests the landing page over HTTP and then HTTPS, the cookies of every redirect are kept
+func FetchFingerprintPage(domain string) (FingerprintPage, error) {
+	cookies := map[string]string{}
+	client := &http.Client{
+		Timeout: 15 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			// req.Response is the redirect that led to this request
+			for _, cookie := range req.Response.Cookies() {
+				cookies[cookie.Name] = cookie.Value
+			}
+			return nil
+		},
+	}
+
+	resp, err := client.Get("http://" + domain)
+	if err != nil {
+		resp, err = client.Get("https://" + domain)
+		if err != nil {
+			return FingerprintPage{}, fmt.Errorf("could not make request to the domain using both HTTP and HTTPS: %w", err)
+		}
+	}
+	defer resp.Body.Close()
+	for _, cookie := range resp.Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	return ParseFingerprintPage(resp.Request.URL.String(), resp.Header, cookies, body), nil
+}
+
+// DetectTechnologies fingerprints the landing page of a domain
+func DetectTechnologies(domain string) ([]DetectedTechnology, FingerprintPage, error) {
+	db, err := Fingerprints()
+	if err != nil {
+		return nil, FingerprintPage{}, err
+	}
+	page, err := FetchFingerprintPage(domain)
+	if err != nil {
+		return nil, page, err
+	}
+	return db.Analyze(page), page, nil
+}
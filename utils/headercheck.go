@@ -0,0 +1,292 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Results of validating a security header value
+const (
+	HeaderOK         = "OK"
+	HeaderWeak       = "Weak"
+	HeaderInvalid    = "Invalid"
+	HeaderMissing    = "Not Found"
+	HeaderDeprecated = "Deprecated"
+)
+
+// HeaderCheck is the verdict for one header with a note explaining it
+type HeaderCheck struct {
+	Status string
+	Note   string
+}
+
+// securityHeader describes a header, its recommended value and how much it counts towards the grade
+type securityHeader struct {
+	Name       string
+	Suggestion string
+	Weight     int
+	Validate   func(value string) HeaderCheck
+}
+
+// securityHeaders is the ordered list of checked headers; Content-Security-Policy is graded separately
+var securityHeaders = []securityHeader{
+	{"Content-Security-Policy", "default-src 'self'; object-src 'none'; base-uri 'none'; frame-ancestors 'self'", 25, nil},
+	{"Strict-Transport-Security", "max-age=31536000; includeSubDomains; preload", 20, ValidateHSTS},
+	{"X-Frame-Options", "DENY or SAMEORIGIN", 15, ValidateXFrameOptions},
+	{"X-Content-Type-Options", "nosniff", 10, ValidateXContentTypeOptions},
+	{"Referrer-Policy", "strict-origin-when-cross-origin or no-referrer", 10, ValidateReferrerPolicy},
+	{"Permissions-Policy", "camera=(), microphone=(), geolocation=()", 5, ValidatePermissionsPolicy},
+	{"Cross-Origin-Opener-Policy", "same-origin", 5, ValidateCOOP},
+	{"Cross-Origin-Resource-Policy", "same-origin or same-site", 5, ValidateCORP},
+	{"Cross-Origin-Embedder-Policy", "require-corp or credentialless", 0, ValidateCOEP},
+	{"X-XSS-Protection", "0 or remove the header", 0, ValidateXXSSProtection},
+	{"Feature-Policy", "remove, use Permissions-Policy", 0, ValidateFeaturePolicy},
+}
+
+// hstsPreloadMinAge is the max-age required by the HSTS preload list
+const hstsPreloadMinAge = 31536000
+
+// ValidateHSTS checks the max-age and the preload list requirements of Strict-Transport-Security (RFC 6797)
+func ValidateHSTS(value string) HeaderCheck {
+	maxAge := -1
+	var includeSubDomains, preload bool
+	seen := map[string]bool{}
+	for _, directive := range strings.Split(value, ";") {
+		directive = strings.TrimSpace(directive)
+		if directive == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(directive, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if seen[name] {
+			return HeaderCheck{HeaderInvalid, "Directive " + name + " is repeated, the header is ignored"}
+		}
+		seen[name] = true
+		switch name {
+		case "max-age":
+			age, err := strconv.Atoi(strings.Trim(strings.TrimSpace(arg), `"`))
+			if err != nil || age < 0 {
+				return HeaderCheck{HeaderInvalid, "max-age is not a number"}
+			}
+			maxAge = age
+		case "includesubdomains":
+			includeSubDomains = true
+		case "preload":
+			preload = true
+		}
+	}
+
+	switch {
+	case maxAge < 0:
+		return HeaderCheck{HeaderInvalid, "max-age is missing, the header is ignored"}
+	case maxAge == 0:
+		return HeaderCheck{HeaderInvalid, "max-age=0 removes the HSTS policy"}
+	case maxAge < 15768000:
+		return HeaderCheck{HeaderWeak, fmt.Sprintf("max-age=%d is shorter than 180 days", maxAge)}
+	}
+
+	var missing []string
+	if maxAge < hstsPreloadMinAge {
+		missing = append(missing, "max-age of one year")
+	}
+	if !includeSubDomains {
+		missing = append(missing, "includeSubDomains")
+	}
+	switch {
+	case preload && len(missing) > 0:
+		return HeaderCheck{HeaderWeak, "preload is set but the preload list also requires " + strings.Join(missing, " and ")}
+	case preload:
+		return HeaderCheck{HeaderOK, "Eligible for the HSTS preload list"}
+	case !includeSubDomains:
+		return HeaderCheck{HeaderOK, "Subdomains are not covered, add includeSubDomains"}
+	default:
+		return HeaderCheck{HeaderOK, "Add preload to be eligible for the HSTS preload list"}
+	}
+}
+
+// ValidateXFrameOptions accepts only DENY and SAMEORIGIN, ALLOW-FROM is not supported by current browsers
+func ValidateXFrameOptions(value string) HeaderCheck {
+	var options []string
+	for _, option := range strings.Split(value, ",") {
+		options = append(options, strings.ToUpper(strings.TrimSpace(option)))
+	}
+	for _, option := range options[1:] {
+		if option != options[0] {
+			return HeaderCheck{HeaderInvalid, "Conflicting values, browsers ignore the header"}
+		}
+	}
+	switch {
+	case options[0] == "DENY" || options[0] == "SAMEORIGIN":
+		return HeaderCheck{HeaderOK, ""}
+	case strings.HasPrefix(options[0], "ALLOW-FROM"):
+		return HeaderCheck{HeaderInvalid, "ALLOW-FROM is ignored by browsers, use CSP frame-ancestors"}
+	default:
+		return HeaderCheck{HeaderInvalid, "Unknown value, use DENY or SAMEORIGIN"}
+	}
+}
+
+// ValidateXContentTypeOptions only accepts nosniff
+func ValidateXContentTypeOptions(value string) HeaderCheck {
+	if strings.EqualFold(strings.TrimSpace(value), "nosniff") {
+		return HeaderCheck{HeaderOK, ""}
+	}
+	return HeaderCheck{HeaderInvalid, "The only valid value is nosniff"}
+}
+
+var referrerPolicies = map[string]string{
+	"no-referrer":                     HeaderOK,
+	"same-origin":                     HeaderOK,
+	"strict-origin":                   HeaderOK,
+	"strict-origin-when-cross-origin": HeaderOK,
+	"origin":                          HeaderWeak,
+	"origin-when-cross-origin":        HeaderWeak,
+	"no-referrer-when-downgrade":      HeaderWeak,
+	"unsafe-url":                      HeaderWeak,
+}
+
+// ValidateReferrerPolicy checks the policy tokens, browsers apply the last one they recognize
+func ValidateReferrerPolicy(value string) HeaderCheck {
+	var effective string
+	var unknown []string
+	for _, token := range strings.Split(value, ",") {
+		token = strings.ToLower(strings.TrimSpace(token))
+		if token == "" {
+			continue
+		}
+		if _, ok := referrerPolicies[token]; ok {
+			effective = token
+		} else {
+			unknown = append(unknown, token)
+		}
+	}
+	switch {
+	case effective == "":
+		return HeaderCheck{HeaderInvalid, "No valid policy token, the browser default is used"}
+	case referrerPolicies[effective] == HeaderWeak:
+		return HeaderCheck{HeaderWeak, effective + " leaks full URLs or origins to other sites"}
+	case len(unknown) > 0:
+		return HeaderCheck{HeaderOK, "Unknown tokens ignored: " + strings.Join(unknown, ", ")}
+	default:
+		return HeaderCheck{HeaderOK, ""}
+	}
+}
+
+var (
+	permissionsFeature = regexp.MustCompile(`^[a-z*][a-z0-9_\-.*]*$`)
+	permissionsOrigin  = regexp.MustCompile(`^"[^"]*"$`)
+)
+
+// ValidatePermissionsPolicy checks the structured field dictionary syntax, e.g. camera=(), geolocation=(self "https://maps.example")
+func ValidatePermissionsPolicy(value string) HeaderCheck {
+	var anyOrigin []string
+	for _, member := range strings.Split(value, ",") {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue
+		}
+		// Parameters such as ;report-to=endpoint follow the allowlist
+		member, _, _ = strings.Cut(member, ";")
+		feature, allowlist, ok := strings.Cut(member, "=")
+		if !ok {
+			if strings.ContainsAny(member, "' ") {
+				return HeaderCheck{HeaderInvalid, "Feature-Policy syntax used, write feature=(allowlist)"}
+			}
+			return HeaderCheck{HeaderInvalid, "Missing allowlist for " + member}
+		}
+		feature = strings.TrimSpace(feature)
+		allowlist = strings.TrimSpace(allowlist)
+		if !permissionsFeature.MatchString(feature) {
+			return HeaderCheck{HeaderInvalid, "Invalid feature name " + feature}
+		}
+		if !validPermissionsAllowlist(allowlist) {
+			return HeaderCheck{HeaderInvalid, fmt.Sprintf("Invalid allowlist %s for %s", allowlist, feature)}
+		}
+		if allowlist == "*" || strings.HasPrefix(allowlist, "(") && hasSource(strings.Fields(strings.Trim(allowlist, "()")), func(v string) bool { return v == "*" }) {
+			anyOrigin = append(anyOrigin, feature)
+		}
+	}
+	if len(anyOrigin) > 0 {
+		return HeaderCheck{HeaderWeak, "Allowed for every origin: " + strings.Join(anyOrigin, ", ")}
+	}
+	return HeaderCheck{HeaderOK, ""}
+}
+
+func validPermissionsAllowlist(allowlist string) bool {
+	if allowlist == "*" || allowlist == "self" || permissionsOrigin.MatchString(allowlist) {
+		return true
+	}
+	if !strings.HasPrefix(allowlist, "(") || !strings.HasSuffix(allowlist, ")") {
+		return false
+	}
+	for _, item := range strings.Fields(allowlist[1 : len(allowlist)-1]) {
+		if item != "*" && item != "self" && item != "src" && !permissionsOrigin.MatchString(item) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateCOOP checks Cross-Origin-Opener-Policy
+func ValidateCOOP(value string) HeaderCheck {
+	switch strings.TrimSpace(strings.Split(value, ";")[0]) {
+	case "same-origin", "noopener-allow-popups":
+		return HeaderCheck{HeaderOK, ""}
+	case "same-origin-allow-popups":
+		return HeaderCheck{HeaderOK, "Popups opened by the page keep a reference to it"}
+	case "unsafe-none":
+		return HeaderCheck{HeaderWeak, "unsafe-none does not isolate the browsing context"}
+	default:
+		return HeaderCheck{HeaderInvalid, "Unknown value, use same-origin"}
+	}
+}
+
+// ValidateCOEP checks Cross-Origin-Embedder-Policy
+func ValidateCOEP(value string) HeaderCheck {
+	switch strings.TrimSpace(strings.Split(value, ";")[0]) {
+	case "require-corp", "credentialless":
+		return HeaderCheck{HeaderOK, ""}
+	case "unsafe-none":
+		return HeaderCheck{HeaderWeak, "unsafe-none does not restrict embedded resources"}
+	default:
+		return HeaderCheck{HeaderInvalid, "Unknown value, use require-corp or credentialless"}
+	}
+}
+
+// ValidateCORP checks Cross-Origin-Resource-Policy
+func ValidateCORP(value string) HeaderCheck {
+	switch strings.TrimSpace(value) {
+	case "same-origin", "same-site":
+		return HeaderCheck{HeaderOK, ""}
+	case "cross-origin":
+		return HeaderCheck{HeaderWeak, "cross-origin lets any site load the resource"}
+	default:
+		return HeaderCheck{HeaderInvalid, "Unknown value, use same-origin or same-site"}
+	}
+}
+
+// ValidateXXSSProtection flags the legacy XSS auditor, enabling it can introduce cross-site leaks
+func ValidateXXSSProtection(value string) HeaderCheck {
+	if strings.TrimSpace(value) == "0" {
+		return HeaderCheck{HeaderOK, "Auditor disabled, the header can be removed"}
+	}
+	return HeaderCheck{HeaderDeprecated, "The XSS auditor was removed from browsers and enabling it caused leaks, send 0 or remove the header"}
+}
+
+// ValidateFeaturePolicy flags the header replaced by Permissions-Policy
+func ValidateFeaturePolicy(value string) HeaderCheck {
+	return HeaderCheck{HeaderDeprecated, "Replaced by Permissions-Policy"}
+}
+
+// headerScore is the share of the header weight earned by a verdict
+func headerScore(status string) float64 {
+	switch status {
+	case HeaderOK:
+		return 1
+	case HeaderWeak:
+		return 0.5
+	default:
+		return 0
+	}
+}
@@ -9,11 +9,13 @@ import (
 	"github.com/olekukonko/tablewriter"
 )
 
-// CheckURL tries to get a response from both http and https and returns the URL that works
+// CheckURL tries to get a response from both http and https and returns the URL that works.
+// Redirects are not followed, so a scheme only counts when the server itself answers on it.
 func CheckURL(domain string) (string, error) {
+	client := newRedirectClient()
 	urls := []string{"https://" + domain, "http://" + domain}
 	for _, url := range urls {
-		resp, err := http.Get(url)
+		resp, err := client.Get(url)
 		if err == nil {
 			resp.Body.Close()
 			return url, nil
@@ -24,29 +26,19 @@ func CheckURL(domain string) (string, error) {
 
 // GetSecurityHeadersInfo fetches security headers information for a domain
 func GetSecurityHeadersInfo(domain string) (string, error) {
-	url, err := CheckURL(domain)
-	if err != nil {
-		return "", err
+	redirects := AnalyzeRedirects(domain)
+	// The headers of the page reached over HTTPS are checked, plain HTTP is the fallback
+	chain := redirects.HTTPS.Responses
+	if len(chain) == 0 {
+		chain = redirects.HTTP.Responses
 	}
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	securityHeaders := map[string]string{
-		"Content-Security-Policy":   "default-src 'self'",
-		"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
-		"X-Content-Type-Options":    "nosniff",
-		"X-Frame-Options":           "DENY or SAMEORIGIN",
-		"X-XSS-Protection":          "1; mode=block",
-		"Referrer-Policy":           "no-referrer",
-		"Feature-Policy":            "geolocation 'none'; microphone 'none'",
-		"Permissions-Policy":        "fullscreen=(), geolocation=()",
+	if len(chain) == 0 {
+		return "", fmt.Errorf("invalid domain: %s", domain)
 	}
+	resp := chain[len(chain)-1]
 
 	var sb strings.Builder
+	sb.WriteString(FormatRedirectReport(redirects))
 
 	// Add colored header
 	sb.WriteString(color.New(color.FgYellow, color.Bold).Sprintf("\nSecurity Headers for %s\n\n", domain))
@@ -61,15 +53,95 @@ func GetSecurityHeadersInfo(domain string) (string, error) {
 	table.SetColMinWidth(2, 25)
 	table.SetColMinWidth(3, 35)
 
-	for header, suggestionValue := range securityHeaders {
-		value := resp.Header.Get(header)
-		if value == "" {
-			table.Append([]string{header, color.RedString("Not Found"), "", suggestionValue})
+	// Policies can also be set with <meta http-equiv>, so the page body is parsed too
+	cspReport := AnalyzeCSP(CollectCSPPolicies(resp.Header, resp.Body))
+
+	var score, total float64
+	for _, header := range securityHeaders {
+		check, value := checkSecurityHeader(header, resp, cspReport)
+		total += float64(header.Weight)
+		if header.Name == "Content-Security-Policy" && check.Status != HeaderMissing {
+			score += float64(header.Weight) * float64(cspReport.Score) / 100
 		} else {
-			table.Append([]string{header, color.GreenString("Found"), value, ""})
+			score += float64(header.Weight) * headerScore(check.Status)
 		}
+		if header.Name == "X-XSS-Protection" && check.Status == HeaderDeprecated {
+			score -= 5
+		}
+
+		suggestion := check.Note
+		if check.Status != HeaderOK && check.Status != HeaderDeprecated {
+			suggestion = strings.TrimSpace(check.Note + "\nUse: " + header.Suggestion)
+		}
+		table.Append([]string{header.Name, colorHeaderStatus(check.Status), value, suggestion})
 	}
 
 	table.Render()
+
+	grade := gradeForScore(int(max(score, 0) * 100 / total))
+	sb.WriteString(fmt.Sprintf("\n%s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Security Headers Grade:"), colorGrade(grade)))
+	sb.WriteString(FormatCSPReport(cspReport))
+	sb.WriteString(FormatCookieReport(AnalyzeCookies(append(append([]*http.Response{}, redirects.HTTP.Responses...), redirects.HTTPS.Responses...))))
 	return sb.String(), nil
 }
+
+// checkSecurityHeader validates one header of the response and returns the verdict and the value to show
+func checkSecurityHeader(header securityHeader, resp *http.Response, cspReport CSPReport) (HeaderCheck, string) {
+	value := strings.Join(resp.Header.Values(header.Name), ", ")
+
+	switch header.Name {
+	case "Content-Security-Policy":
+		// The policy can also come from the report-only header or a <meta> element
+		if value == "" && len(cspReport.Policies) > 0 {
+			value = cspReport.Policies[0].Raw
+		}
+		if value == "" {
+			return HeaderCheck{HeaderMissing, ""}, ""
+		}
+		status := HeaderOK
+		if cspReport.Score < 50 {
+			status = HeaderInvalid
+		} else if cspReport.Score < 80 {
+			status = HeaderWeak
+		}
+		return HeaderCheck{status, fmt.Sprintf("Grade %s, see the analysis below", cspReport.Grade)}, value
+	case "X-XSS-Protection", "Feature-Policy", "Cross-Origin-Embedder-Policy":
+		if value == "" {
+			return HeaderCheck{HeaderOK, "Not set"}, ""
+		}
+	case "X-Frame-Options":
+		if value == "" && cspFrameAncestors(cspReport) {
+			return HeaderCheck{HeaderOK, "Not set, covered by CSP frame-ancestors"}, ""
+		}
+	case "Strict-Transport-Security":
+		if value != "" && resp.Request != nil && resp.Request.URL.Scheme != "https" {
+			return HeaderCheck{HeaderInvalid, "Sent over HTTP, browsers only accept HSTS over HTTPS"}, value
+		}
+	}
+
+	if value == "" {
+		return HeaderCheck{HeaderMissing, ""}, ""
+	}
+	return header.Validate(value), value
+}
+
+// cspFrameAncestors reports whether an enforced header policy restricts framing
+func cspFrameAncestors(report CSPReport) bool {
+	for _, policy := range report.Policies {
+		if _, ok := policy.Directives["frame-ancestors"]; ok && !policy.ReportOnly && policy.Source != "meta" {
+			return true
+		}
+	}
+	return false
+}
+
+func colorHeaderStatus(status string) string {
+	switch status {
+	case HeaderOK:
+		return color.GreenString(status)
+	case HeaderWeak, HeaderDeprecated:
+		return color.YellowString(status)
+	default:
+		return color.RedString(status)
+	}
+}
@@ -0,0 +1,558 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+// jarmTimeout bounds each of the ten JARM connections
+const jarmTimeout = 5 * time.Second
+
+// jarmEmpty is the hash of a server that answered none of the probes
+var jarmEmpty = strings.Repeat("0", 62)
+
+// jarmProbe is one of the ten ClientHellos of the JARM reference implementation
+type jarmProbe struct {
+	Version          string // TLS_1.1, TLS_1.2 or TLS_1.3
+	CipherList       string // ALL or NO1.3
+	CipherOrder      string // FORWARD, REVERSE, TOP_HALF, BOTTOM_HALF or MIDDLE_OUT
+	Grease           bool
+	RareALPN         bool
+	SupportedVersion string // 1.2_SUPPORT, 1.3_SUPPORT or NO_SUPPORT
+	ExtensionOrder   string // FORWARD or REVERSE, applied to ALPN and supported_versions
+}
+
+// jarmProbes are sent in this order, the order is part of the fingerprint
+var jarmProbes = []jarmProbe{
+	{"TLS_1.2", "ALL", "FORWARD", false, false, "1.2_SUPPORT", "REVERSE"},
+	{"TLS_1.2", "ALL", "REVERSE", false, false, "1.2_SUPPORT", "FORWARD"},
+	{"TLS_1.2", "ALL", "TOP_HALF", false, false, "NO_SUPPORT", "FORWARD"},
+	{"TLS_1.2", "ALL", "BOTTOM_HALF", false, true, "NO_SUPPORT", "FORWARD"},
+	{"TLS_1.2", "ALL", "MIDDLE_OUT", true, true, "NO_SUPPORT", "REVERSE"},
+	{"TLS_1.1", "ALL", "FORWARD", false, false, "NO_SUPPORT", "FORWARD"},
+	{"TLS_1.3", "ALL", "FORWARD", false, false, "1.3_SUPPORT", "REVERSE"},
+	{"TLS_1.3", "ALL", "REVERSE", false, false, "1.3_SUPPORT", "FORWARD"},
+	{"TLS_1.3", "NO1.3", "FORWARD", false, false, "1.3_SUPPORT", "FORWARD"},
+	{"TLS_1.3", "ALL", "MIDDLE_OUT", true, false, "1.3_SUPPORT", "REVERSE"},
+}
+
+// jarmCiphers is the ALL cipher list in the order JARM offers it
+var jarmCiphers = []uint16{
+	0x0016, 0x0033, 0x0067, 0xc09e, 0xc0a2, 0x009e, 0x0039, 0x006b, 0xc09f, 0xc0a3, 0x009f, 0x0045, 0x00be, 0x0088,
+	0x00c4, 0x009a, 0xc008, 0xc009, 0xc023, 0xc0ac, 0xc0ae, 0xc02b, 0xc00a, 0xc024, 0xc0ad, 0xc0af, 0xc02c, 0xc072,
+	0xc073, 0xcca9, 0x1302, 0x1301, 0xcc14, 0xc007, 0xc012, 0xc013, 0xc027, 0xc02f, 0xc014, 0xc028, 0xc030, 0xc060,
+	0xc061, 0xc076, 0xc077, 0xcca8, 0x1305, 0x1304, 0x1303, 0xcc13, 0xc011, 0x000a, 0x002f, 0x003c, 0xc09c, 0xc0a0,
+	0x009c, 0x0035, 0x003d, 0xc09d, 0xc0a1, 0x009d, 0x0041, 0x00ba, 0x0084, 0x00c0, 0x0007, 0x0004, 0x0005,
+}
+
+// jarmCipherBytes is the cipher list the reference implementation indexes ServerHello ciphers into. It is ordered
+// by value except for the TLS 1.3 suites, which come last, so it must not be sorted.
+var jarmCipherBytes = []uint16{
+	0x0004, 0x0005, 0x0007, 0x000a, 0x0016, 0x002f, 0x0033, 0x0035, 0x0039, 0x003c, 0x003d, 0x0041, 0x0045, 0x0067,
+	0x006b, 0x0084, 0x0088, 0x009a, 0x009c, 0x009d, 0x009e, 0x009f, 0x00ba, 0x00be, 0x00c0, 0x00c4, 0xc007, 0xc008,
+	0xc009, 0xc00a, 0xc011, 0xc012, 0xc013, 0xc014, 0xc023, 0xc024, 0xc027, 0xc028, 0xc02b, 0xc02c, 0xc02f, 0xc030,
+	0xc060, 0xc061, 0xc072, 0xc073, 0xc076, 0xc077, 0xc09c, 0xc09d, 0xc09e, 0xc09f, 0xc0a0, 0xc0a1, 0xc0a2, 0xc0a3,
+	0xc0ac, 0xc0ad, 0xc0ae, 0xc0af, 0xcc13, 0xcc14, 0xcca8, 0xcca9, 0x1301, 0x1302, 0x1303, 0x1304, 0x1305,
+}
+
+// jarmALPNs are the ALPN values from weakest to strongest, the rare list drops http/1.1 and h2
+var (
+	jarmALPNs     = []string{"http/0.9", "http/1.0", "http/1.1", "spdy/1", "spdy/2", "spdy/3", "h2", "h2c", "hq"}
+	jarmRareALPNs = []string{"http/0.9", "http/1.0", "spdy/1", "spdy/2", "spdy/3", "h2c", "hq"}
+)
+
+// JARMFingerprint sends the ten JARM probes and returns the 62 character fingerprint
+func JARMFingerprint(target TLSTarget) (string, error) {
+	raw := make([]string, len(jarmProbes))
+	var wg sync.WaitGroup
+	for i, probe := range jarmProbes {
+		wg.Add(1)
+		go func(i int, probe jarmProbe) {
+			defer wg.Done()
+			raw[i] = sendJARMProbe(target, probe)
+		}(i, probe)
+	}
+	wg.Wait()
+
+	hash := jarmHash(strings.Join(raw, ","))
+	if hash == jarmEmpty {
+		return hash, fmt.Errorf("no TLS response from %s", target)
+	}
+	return hash, nil
+}
+
+// sendJARMProbe returns "cipher|version|alpn|extensions" for one probe, or "|||" when the server did not answer with a ServerHello
+func sendJARMProbe(target TLSTarget, probe jarmProbe) string {
+	conn, err := target.dial(jarmTimeout)
+	if err != nil {
+		return "|||"
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(jarmTimeout))
+	if _, err := conn.Write(buildJARMPacket(target.ServerName, probe)); err != nil {
+		return "|||"
+	}
+
+	// The reference reads up to 1484 bytes; keep reading until the first record is complete
+	data := make([]byte, 0, 1484)
+	buf := make([]byte, 1484)
+	for len(data) < cap(data) {
+		n, err := conn.Read(buf[:cap(data)-len(data)])
+		data = append(data, buf[:n]...)
+		if len(data) >= 5 && len(data) >= 5+int(binary.BigEndian.Uint16(data[3:5])) {
+			break
+		}
+		if err != nil {
+			break
+		}
+	}
+	if len(data) == 0 {
+		return "|||"
+	}
+	return readJARMPacket(data)
+}
+
+// buildJARMPacket assembles the ClientHello record byte for byte like the reference implementation
+func buildJARMPacket(host string, probe jarmProbe) []byte {
+	recordVersion, helloVersion := uint16(versionTLS12), uint16(versionTLS12)
+	switch probe.Version {
+	case "TLS_1.3":
+		recordVersion = versionTLS10
+	case "TLS_1.1":
+		recordVersion, helloVersion = versionTLS11, versionTLS11
+	}
+
+	hello := appendUint16(nil, helloVersion)
+	hello = append(hello, randomBytes(32)...)
+	hello = append(hello, 32)
+	hello = append(hello, randomBytes(32)...)
+
+	ciphers := jarmCipherList(probe)
+	hello = appendUint16(hello, uint16(2*len(ciphers)))
+	for _, cipher := range ciphers {
+		hello = appendUint16(hello, cipher)
+	}
+	hello = append(hello, 1, 0)
+	hello = append(hello, jarmExtensions(host, probe)...)
+
+	handshake := wrapHandshake(handshakeTypeClientHello, hello)
+	record := []byte{recordTypeHandshake}
+	record = appendUint16(record, recordVersion)
+	record = appendUint16(record, uint16(len(handshake)))
+	return append(record, handshake...)
+}
+
+func jarmCipherList(probe jarmProbe) []uint16 {
+	var ciphers []uint16
+	for _, cipher := range jarmCiphers {
+		if probe.CipherList == "NO1.3" && cipher>>8 == 0x13 {
+			continue
+		}
+		ciphers = append(ciphers, cipher)
+	}
+	if probe.CipherOrder != "FORWARD" {
+		ciphers = jarmMung(ciphers, probe.CipherOrder)
+	}
+	if probe.Grease {
+		ciphers = append([]uint16{randomGrease()}, ciphers...)
+	}
+	return ciphers
+}
+
+func jarmExtensions(host string, probe jarmProbe) []byte {
+	var ext []byte
+	if probe.Grease {
+		ext = appendExtension(ext, randomGrease(), nil)
+	}
+
+	sni := appendUint16(nil, uint16(len(host)+3))
+	sni = append(sni, 0)
+	sni = appendUint16(sni, uint16(len(host)))
+	sni = append(sni, host...)
+	ext = appendExtension(ext, extServerName, sni)
+
+	ext = appendExtension(ext, 0x0017, nil)                     // extended_master_secret
+	ext = appendExtension(ext, 0x0001, []byte{1})               // max_fragment_length
+	ext = appendExtension(ext, extRenegotiationInfo, []byte{0}) // renegotiation_info
+	ext = appendExtension(ext, extSupportedGroups, []byte{0x00, 0x08, 0x00, 0x1d, 0x00, 0x17, 0x00, 0x18, 0x00, 0x19})
+	ext = appendExtension(ext, extECPointFormats, []byte{0x01, 0x00})
+	ext = appendExtension(ext, extSessionTicket, nil)
+
+	alpns := jarmALPNs
+	if probe.RareALPN {
+		alpns = jarmRareALPNs
+	}
+	if probe.ExtensionOrder != "FORWARD" {
+		alpns = jarmMung(alpns, probe.ExtensionOrder)
+	}
+	var alpnList []byte
+	for _, alpn := range alpns {
+		alpnList = append(alpnList, byte(len(alpn)))
+		alpnList = append(alpnList, alpn...)
+	}
+	ext = appendExtension(ext, extALPN, append(appendUint16(nil, uint16(len(alpnList))), alpnList...))
+
+	ext = appendExtension(ext, extSignatureAlgorithms, []byte{
+		0x00, 0x12, 0x04, 0x03, 0x08, 0x04, 0x04, 0x01, 0x05, 0x03, 0x08, 0x05, 0x05, 0x01, 0x08, 0x06, 0x06, 0x01, 0x02, 0x01,
+	})
+
+	var shares []byte
+	if probe.Grease {
+		shares = appendUint16(shares, randomGrease())
+		shares = append(shares, 0x00, 0x01, 0x00)
+	}
+	shares = appendUint16(shares, groupX25519)
+	shares = appendUint16(shares, 32)
+	shares = append(shares, randomBytes(32)...)
+	ext = appendExtension(ext, extKeyShare, append(appendUint16(nil, uint16(len(shares))), shares...))
+
+	ext = appendExtension(ext, extPSKModes, []byte{0x01, 0x01})
+
+	if probe.Version == "TLS_1.3" || probe.SupportedVersion == "1.2_SUPPORT" {
+		versions := []uint16{versionTLS10, versionTLS11, versionTLS12}
+		if probe.SupportedVersion != "1.2_SUPPORT" {
+			versions = append(versions, versionTLS13)
+		}
+		if probe.ExtensionOrder != "FORWARD" {
+			versions = jarmMung(versions, probe.ExtensionOrder)
+		}
+		var list []byte
+		if probe.Grease {
+			list = appendUint16(list, randomGrease())
+		}
+		for _, version := range versions {
+			list = appendUint16(list, version)
+		}
+		ext = appendExtension(ext, extSupportedVersions, append([]byte{byte(len(list))}, list...))
+	}
+
+	return append(appendUint16(nil, uint16(len(ext))), ext...)
+}
+
+// jarmMung reorders a list like the reference cipher_mung
+func jarmMung[T any](items []T, order string) []T {
+	n := len(items)
+	var out []T
+	switch order {
+	case "REVERSE":
+		for i := n - 1; i >= 0; i-- {
+			out = append(out, items[i])
+		}
+	case "BOTTOM_HALF":
+		if n%2 == 1 {
+			out = append(out, items[n/2+1:]...)
+		} else {
+			out = append(out, items[n/2:]...)
+		}
+	case "TOP_HALF":
+		// The top half gets the middle item of an odd list
+		if n%2 == 1 {
+			out = append(out, items[n/2])
+		}
+		out = append(out, jarmMung(jarmMung(items, "REVERSE"), "BOTTOM_HALF")...)
+	case "MIDDLE_OUT":
+		middle := n / 2
+		if n%2 == 1 {
+			out = append(out, items[middle])
+			for i := 1; i <= middle; i++ {
+				out = append(out, items[middle+i], items[middle-i])
+			}
+		} else {
+			for i := 1; i <= middle; i++ {
+				out = append(out, items[middle-1+i], items[middle-i])
+			}
+		}
+	default:
+		out = append(out, items...)
+	}
+	return out
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	io.ReadFull(rand.Reader, b)
+	return b
+}
+
+// randomGrease returns one of the sixteen GREASE values 0x0a0a to 0xfafa (RFC 8701)
+func randomGrease() uint16 {
+	i, _ := rand.Int(rand.Reader, big.NewInt(16))
+	b := uint16(i.Int64())<<4 | 0x0a
+	return b<<8 | b
+}
+
+// readJARMPacket extracts "cipher|version|alpn|extensions" from the raw server answer.
+// Malformed answers give "|||" where the reference implementation fails with an exception.
+func readJARMPacket(data []byte) string {
+	if len(data) < 44 || data[0] != recordTypeHandshake || data[5] != handshakeTypeServerHello {
+		return "|||"
+	}
+
+	serverHelloLength := int(binary.BigEndian.Uint16(data[3:5]))
+	counter := int(data[43])
+	cipher := pySlice(data, counter+44, counter+46)
+	version := pySlice(data, 9, 11)
+	extensions, ok := jarmExtensionInfo(data, counter, serverHelloLength)
+	if !ok {
+		return "|||"
+	}
+	return hex.EncodeToString(cipher) + "|" + hex.EncodeToString(version) + "|" + extensions
+}
+
+// jarmExtensionInfo returns "alpn|type-type-..." for the ServerHello extensions, or "|" when there are none
+func jarmExtensionInfo(data []byte, counter, serverHelloLength int) (string, bool) {
+	if counter+47 >= len(data) || data[counter+47] == handshakeTypeCertificate {
+		return "|", true
+	}
+	if string(pySlice(data, counter+50, counter+53)) == "\x0e\xac\x0b" || string(pySlice(data, 82, 85)) == "\x0f\xf0\x0b" {
+		return "|", true
+	}
+	if counter+42 >= serverHelloLength {
+		return "|", true
+	}
+
+	count := 49 + counter
+	length, ok := pyInt(pySlice(data, counter+47, counter+49))
+	if !ok {
+		return "", false
+	}
+	maximum := length + count - 1
+
+	var types []string
+	var values [][]byte
+	for count < maximum {
+		types = append(types, hex.EncodeToString(pySlice(data, count, count+2)))
+		extLength, ok := pyInt(pySlice(data, count+2, count+4))
+		if !ok {
+			return "", false
+		}
+		if extLength == 0 {
+			values = append(values, nil)
+		} else {
+			values = append(values, pySlice(data, count+4, count+4+extLength))
+		}
+		count += 4 + extLength
+	}
+
+	alpn := ""
+	for i, typ := range types {
+		if typ == "0010" {
+			if values[i] == nil {
+				return "", false
+			}
+			alpn = string(pySlice(values[i], 3, len(values[i])))
+			break
+		}
+	}
+	return alpn + "|" + strings.Join(types, "-"), true
+}
+
+// pyInt reads a big-endian number of any length, an empty slice is an error as in int("", 16)
+func pyInt(b []byte) (int, bool) {
+	if len(b) == 0 {
+		return 0, false
+	}
+	n := 0
+	for _, c := range b {
+		n = n<<8 | int(c)
+	}
+	return n, true
+}
+
+// pySlice slices like Python, clamping the bounds instead of panicking
+func pySlice(data []byte, start, end int) []byte {
+	if start > len(data) {
+		start = len(data)
+	}
+	if end > len(data) {
+		end = len(data)
+	}
+	if end < start {
+		end = start
+	}
+	return data[start:end]
+}
+
+// jarmHash turns the ten raw probe answers into the fuzzy hash: 30 characters of cipher and version codes followed by a truncated SHA-256 of the ALPNs and extensions
+func jarmHash(raw string) string {
+	if raw == strings.TrimSuffix(strings.Repeat("|||,", len(jarmProbes)), ",") {
+		return jarmEmpty
+	}
+
+	var fuzzy, alpnsAndExtensions strings.Builder
+	for _, handshake := range strings.Split(raw, ",") {
+		components := strings.Split(handshake, "|")
+		fuzzy.WriteString(jarmCipherByte(components[0]))
+		fuzzy.WriteString(jarmVersionByte(components[1]))
+		alpnsAndExtensions.WriteString(components[2])
+		alpnsAndExtensions.WriteString(components[3])
+	}
+	sum := sha256.Sum256([]byte(alpnsAndExtensions.String()))
+	return fuzzy.String() + hex.EncodeToString(sum[:])[:32]
+}
+
+// jarmCipherByte returns the 1-based position of the cipher in the reference JARM cipher list as two hex digits
+func jarmCipherByte(cipher string) string {
+	if cipher == "" {
+		return "00"
+	}
+	count := 1
+	for _, id := range jarmCipherBytes {
+		if fmt.Sprintf("%04x", id) == cipher {
+			break
+		}
+		count++
+	}
+	return fmt.Sprintf("%02x", count)
+}
+
+// jarmVersionByte maps the ServerHello version 0x0300 to 0x0305 to the letters a to f
+func jarmVersionByte(version string) string {
+	if len(version) < 4 || version[3] < '0' || version[3] > '5' {
+		return "0"
+	}
+	return string("abcdef"[version[3]-'0'])
+}
+
+// TLSHostFingerprint is the JARM and leaf certificate fingerprint of one host
+type TLSHostFingerprint struct {
+	Target          TLSTarget
+	JARM            string
+	CertFingerprint string
+	CertSubject     string
+	Err             error
+}
+
+// TLSCluster is a group of hosts sharing a JARM fingerprint or a certificate
+type TLSCluster struct {
+	Kind  string
+	Key   string
+	Label string
+	Hosts []string
+}
+
+// FingerprintTLSHosts collects the JARM and certificate fingerprint of every target
+func FingerprintTLSHosts(targets []TLSTarget) []TLSHostFingerprint {
+	results := make([]TLSHostFingerprint, len(targets))
+
+	var wg sync.WaitGroup
+	concurrencyLimit := make(chan struct{}, 10)
+	for i, target := range targets {
+		wg.Add(1)
+		concurrencyLimit <- struct{}{}
+		go func(i int, target TLSTarget) {
+			defer wg.Done()
+			defer func() { <-concurrencyLimit }()
+
+			result := TLSHostFingerprint{Target: target}
+			result.JARM, result.Err = JARMFingerprint(target)
+			if state, err := fetchTLSState(target); err == nil {
+				result.CertFingerprint = CertificateFingerprint(state.PeerCertificates[0])
+				result.CertSubject = state.PeerCertificates[0].Subject.CommonName
+			} else if result.Err == nil {
+				result.Err = err
+			}
+			results[i] = result
+		}(i, target)
+	}
+	wg.Wait()
+	return results
+}
+
+// ClusterTLSHosts groups hosts with identical JARM fingerprints or certificates, only groups with two or more hosts are returned
+func ClusterTLSHosts(fingerprints []TLSHostFingerprint) []TLSCluster {
+	byJARM := map[string][]string{}
+	byCert := map[string][]string{}
+	subjects := map[string]string{}
+	for _, fp := range fingerprints {
+		if fp.JARM != "" && fp.JARM != jarmEmpty {
+			byJARM[fp.JARM] = append(byJARM[fp.JARM], fp.Target.String())
+		}
+		if fp.CertFingerprint != "" {
+			byCert[fp.CertFingerprint] = append(byCert[fp.CertFingerprint], fp.Target.String())
+			subjects[fp.CertFingerprint] = fp.CertSubject
+		}
+	}
+
+	var clusters []TLSCluster
+	for key, hosts := range byJARM {
+		if len(hosts) > 1 {
+			clusters = append(clusters, TLSCluster{Kind: "JARM", Key: key, Hosts: hosts})
+		}
+	}
+	for key, hosts := range byCert {
+		if len(hosts) > 1 {
+			clusters = append(clusters, TLSCluster{Kind: "Certificate", Key: key, Label: subjects[key], Hosts: hosts})
+		}
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i].Hosts) != len(clusters[j].Hosts) {
+			return len(clusters[i].Hosts) > len(clusters[j].Hosts)
+		}
+		if clusters[i].Kind != clusters[j].Kind {
+			return clusters[i].Kind < clusters[j].Kind
+		}
+		return clusters[i].Key < clusters[j].Key
+	})
+	for _, cluster := range clusters {
+		sort.Strings(cluster.Hosts)
+	}
+	return clusters
+}
+
+// GetTLSFingerprintReport fingerprints the targets and lists the clusters of hosts sharing a TLS stack or certificate
+func GetTLSFingerprintReport(targets []TLSTarget) (string, error) {
+	if len(targets) == 0 {
+		return "", fmt.Errorf("no domains given")
+	}
+	fingerprints := FingerprintTLSHosts(targets)
+
+	var sb strings.Builder
+	sb.WriteString(color.New(color.FgYellow, color.Bold).Sprint("\nTLS Fingerprints:\n\n"))
+	table := tablewriter.NewWriter(&sb)
+	table.SetHeader([]string{"Target", "JARM", "Certificate (SHA-256)"})
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	for _, fp := range fingerprints {
+		jarm, cert := fp.JARM, fp.CertFingerprint
+		if fp.Err != nil && jarm == jarmEmpty {
+			jarm = color.RedString("%v", fp.Err)
+		}
+		if cert == "" {
+			cert = "-"
+		}
+		table.Append([]string{fp.Target.String(), jarm, cert})
+	}
+	table.Render()
+
+	clusters := ClusterTLSHosts(fingerprints)
+	sb.WriteString(color.New(color.FgYellow, color.Bold).Sprint("\nClusters:\n"))
+	if len(clusters) == 0 {
+		sb.WriteString("  No hosts share a JARM fingerprint or certificate\n")
+	}
+	for _, cluster := range clusters {
+		label := cluster.Key
+		if cluster.Label != "" {
+			label += " (" + cluster.Label + ")"
+		}
+		sb.WriteString(color.New(color.FgYellow, color.Bold).Sprintf("  %s %s:\n", cluster.Kind, label))
+		for _, host := range cluster.Hosts {
+			sb.WriteString("    - " + host + "\n")
+		}
+	}
+	return sb.String(), nil
+}
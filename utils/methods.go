@@ -0,0 +1,254 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+// methodPaths are tested in addition to the root when they exist, upload and WebDAV folders are the usual suspects
+var methodPaths = []string{"/uploads/", "/upload/", "/files/", "/webdav/", "/dav/", "/api/", "/admin/", "/images/", "/test/"}
+
+// testedMethods are sent after OPTIONS, DOMINFO stands for an arbitrary method the server should reject
+var testedMethods = []string{"TRACE", "PUT", "DELETE", "PATCH", "PROPFIND", "DOMINFO"}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?><propfind xmlns="DAV:"><prop><resourcetype/></prop></propfind>`
+
+// MethodResult is the outcome of the method tests on one path
+type MethodResult struct {
+	Path     string
+	Allow    string // Allow and Public headers of the OPTIONS answer
+	DAV      string
+	Statuses map[string]int
+	Findings []string
+}
+
+func newMethodClient() *http.Client {
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func randomToken() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// methodStatus names how the server handled a method from the status code
+func methodStatus(code int) string {
+	switch {
+	case code == 0:
+		return "error"
+	case code == http.StatusMethodNotAllowed || code == http.StatusNotImplemented:
+		return "not allowed"
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return "forbidden"
+	case code == http.StatusBadRequest:
+		return "rejected"
+	case code == http.StatusNotFound:
+		return "not found"
+	case code >= 300 && code < 400:
+		return "redirect"
+	case code >= 200 && code < 300:
+		return "allowed"
+	default:
+		return "other"
+	}
+}
+
+// TestHTTPMethods sends OPTIONS and the tested methods to a path. PUT, DELETE and PATCH only target a random
+// file name so nothing existing is modified, and a file created by PUT is deleted again.
+func TestHTTPMethods(client *http.Client, baseURL, path string) MethodResult {
+	result := MethodResult{Path: path, Statuses: map[string]int{}}
+	target := baseURL + path
+	probeFile := target
+	if strings.HasSuffix(probeFile, "/") {
+		probeFile += "dominfo-" + randomToken() + ".txt"
+	}
+
+	do := func(method, url string, body string, headers map[string]string) (*http.Response, []byte) {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			return nil, nil
+		}
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, nil
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return resp, data
+	}
+
+	if resp, _ := do(http.MethodOptions, target, "", nil); resp != nil {
+		result.Statuses["OPTIONS"] = resp.StatusCode
+		result.Allow = strings.Join(append(resp.Header.Values("Allow"), resp.Header.Values("Public")...), ", ")
+		result.DAV = resp.Header.Get("DAV")
+	}
+
+	for _, method := range testedMethods {
+		var resp *http.Response
+		var body []byte
+		switch method {
+		case "TRACE":
+			token := randomToken()
+			resp, body = do(method, target, "", map[string]string{"X-Dominfo-Trace": token})
+			if resp != nil && resp.StatusCode == http.StatusOK && strings.Contains(string(body), token) {
+				result.Findings = append(result.Findings, "TRACE echoes request headers (Cross-Site Tracing), disable TRACE")
+			}
+		case "PUT":
+			content := "dominfo method test " + randomToken()
+			resp, _ = do(method, probeFile, content, map[string]string{"Content-Type": "text/plain"})
+			if resp != nil && (resp.StatusCode == http.StatusCreated || resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNoContent) {
+				// A success status alone is not enough, catch-all handlers answer 200 to anything
+				if stored, data := do(http.MethodGet, probeFile, "", nil); stored != nil && stored.StatusCode == http.StatusOK && string(data) == content {
+					result.Findings = append(result.Findings, fmt.Sprintf("PUT created %s, anonymous file upload is possible", probeFile))
+				}
+				// The file may have been stored even when it cannot be read back, so it is always removed
+				do(http.MethodDelete, probeFile, "", nil)
+			}
+		case "DELETE", "PATCH":
+			// The random file name does not exist (or was just removed), so a 404 means the method reached the handler
+			resp, _ = do(method, probeFile, "", nil)
+		case "PROPFIND":
+			resp, body = do(method, target, propfindBody, map[string]string{"Depth": "0", "Content-Type": "application/xml"})
+			if resp != nil && resp.StatusCode == http.StatusMultiStatus {
+				result.Findings = append(result.Findings, "PROPFIND answered 207 Multi-Status, WebDAV is enabled")
+			}
+		default:
+			resp, body = do(method, target, "", nil)
+			if resp != nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				// Servers that treat unknown methods as GET answer the same, only a different answer is a finding.
+				// Pages with tokens or timestamps differ on every request, so the size is compared with a tolerance.
+				baseline, baselineBody := do(http.MethodGet, target, "", nil)
+				if baseline != nil && (softNotFound{Status: baseline.StatusCode, Size: sizeWithoutPath(baselineBody, path)}).matches(resp.StatusCode, sizeWithoutPath(body, path)) {
+					break
+				}
+				result.Findings = append(result.Findings, fmt.Sprintf("Arbitrary method %s accepted, access rules bound to methods may be bypassed (verb tampering)", method))
+			}
+		}
+		if resp != nil {
+			result.Statuses[method] = resp.StatusCode
+		}
+	}
+
+	if result.DAV != "" {
+		result.Findings = append(result.Findings, "DAV header advertises WebDAV ("+result.DAV+")")
+	}
+	var advertised []string
+	for _, method := range strings.Split(result.Allow, ",") {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		switch method {
+		case "TRACE", "TRACK", "PUT", "DELETE", "PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK", "CONNECT":
+			advertised = append(advertised, method)
+		}
+	}
+	if len(advertised) > 0 {
+		result.Findings = append(result.Findings, "OPTIONS advertises "+strings.Join(advertised, ", "))
+	}
+	return result
+}
+
+// GetHTTPMethodsReport enumerates the HTTP methods accepted on the root and common paths of a domain
+func GetHTTPMethodsReport(domain string) (string, error) {
+	baseURL, err := CheckURL(domain)
+	if err != nil {
+		return "", err
+	}
+	client := newMethodClient()
+
+	// Common paths are only tested when they exist
+	paths := []string{"/"}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, path := range methodPaths {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			resp, err := client.Get(baseURL + path)
+			if err != nil {
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNotFound {
+				mu.Lock()
+				paths = append(paths, path)
+				mu.Unlock()
+			}
+		}(path)
+	}
+	wg.Wait()
+	sort.Strings(paths)
+
+	results := make([]MethodResult, len(paths))
+	for i, path := range paths {
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			results[i] = TestHTTPMethods(client, baseURL, path)
+		}(i, path)
+	}
+	wg.Wait()
+
+	var sb strings.Builder
+	sb.WriteString(color.New(color.FgYellow, color.Bold).Sprintf("\nHTTP Methods for %s\n\n", baseURL))
+
+	table := tablewriter.NewWriter(&sb)
+	table.SetHeader(append([]string{"Path", "Allow"}, testedMethods...))
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	for _, result := range results {
+		row := []string{result.Path, result.Allow}
+		for _, method := range testedMethods {
+			code, ok := result.Statuses[method]
+			if !ok {
+				row = append(row, color.RedString("error"))
+				continue
+			}
+			cell := fmt.Sprintf("%d %s", code, methodStatus(code))
+			switch methodStatus(code) {
+			case "allowed":
+				cell = color.RedString(cell)
+			case "not found", "other":
+				cell = color.YellowString(cell)
+			default:
+				cell = color.GreenString(cell)
+			}
+			row = append(row, cell)
+		}
+		table.Append(row)
+	}
+	table.Render()
+
+	findings := 0
+	for _, result := range results {
+		for _, finding := range result.Findings {
+			sb.WriteString(color.RedString("  - %s: %s\n", result.Path, finding))
+			findings++
+		}
+	}
+	if findings == 0 {
+		sb.WriteString(color.GreenString("No dangerous methods are enabled\n"))
+	}
+	return sb.String(), nil
+}
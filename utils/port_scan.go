@@ -1,76 +1,391 @@
 package utils
 
 import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// defaultServices is the bundled port to service map in the nmap-services format
+//
+//go:embed services.txt
+var defaultServices []byte
+
+// Port scan settings, they are set from the command line
+var (
+	PortSpec        string // numbers, ranges and profile names, like 1-1024,8080,web
+	TopPorts        int    // the most frequent ports of the services file
+	ServicesFile    string // nmap-services file used instead of the bundled one
+	PortTimeout     = 500 * time.Millisecond
+	PortConcurrency = 100
+	PortRetries     = 0 // extra attempts for ports that time out, a refused connection is not retried
+)
+
+// portProfiles are named port sets that can be used in PortSpec, common is scanned when no ports are chosen
+var portProfiles = map[string][]int{
+	"common":       {21, 22, 25, 53, 80, 110, 143, 389, 443, 465, 587, 993, 995, 1433, 1521, 3306, 3389, 5432, 5900, 6379, 8000, 8080, 8443, 9200, 9300, 27017},
+	"web":          {80, 81, 443, 591, 593, 3000, 4443, 5000, 7001, 7002, 8000, 8008, 8080, 8081, 8088, 8443, 8880, 8888, 9000, 9090, 9443, 10000, 10443},
+	"db":           {1433, 1521, 3306, 5432, 5984, 6379, 7474, 8086, 9042, 9200, 9300, 11211, 27017, 27018, 28017, 50000},
+	"mail":         {25, 110, 143, 465, 587, 993, 995, 2525},
+	"remote-admin": {22, 23, 512, 513, 514, 2082, 2083, 2086, 2087, 2222, 3283, 3389, 4899, 5631, 5900, 5901, 5938, 5985, 5986, 8291, 8728, 10000},
+}
+
+// ServiceEntry is one line of a services file
+type ServiceEntry struct {
+	Name      string
+	Port      int
+	Protocol  string
+	Frequency float64
+}
+
+var (
+	servicesOnce sync.Once
+	services     []ServiceEntry
+	servicesErr  error
 )
 
+// ParseServices reads a services file in the nmap-services format, "name port/protocol [frequency] [# comment]"
+func ParseServices(r io.Reader) ([]ServiceEntry, error) {
+	var entries []ServiceEntry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected service and port/protocol", line)
+		}
+		portText, protocol, _ := strings.Cut(fields[1], "/")
+		port, err := strconv.Atoi(portText)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("line %d: invalid port %q", line, fields[1])
+		}
+		entry := ServiceEntry{Name: fields[0], Port: port, Protocol: strings.ToLower(protocol)}
+		if len(fields) > 2 {
+			entry.Frequency, _ = strconv.ParseFloat(fields[2], 64)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Services returns the entries of the services file, ServicesFile when set or the bundled one
+func Services() ([]ServiceEntry, error) {
+	servicesOnce.Do(func() {
+		data := defaultServices
+		if ServicesFile != "" {
+			if data, servicesErr = os.ReadFile(ServicesFile); servicesErr != nil {
+				servicesErr = fmt.Errorf("could not read services file: %w", servicesErr)
+				return
+			}
+		}
+		services, servicesErr = ParseServices(bytes.NewReader(data))
+	})
+	return services, servicesErr
+}
+
+// ServiceName returns the service usually running on a port
+func ServiceName(port int, protocol string) string {
+	entries, _ := Services()
+	for _, entry := range entries {
+		if entry.Port == port && entry.Protocol == protocol {
+			return entry.Name
+		}
+	}
+	return "unknown"
+}
+
+// TopPortsList returns the n most frequent ports of a protocol. Entries without a frequency, like the ones of the
+// bundled file, keep the order of the file. Asking for more ports than the services file lists is an error,
+// padding them with arbitrary ports would not be a frequency based selection.
+func TopPortsList(n int, protocol string) ([]int, error) {
+	entries, err := Services()
+	if err != nil {
+		return nil, err
+	}
+	var ranked []ServiceEntry
+	seen := map[int]bool{}
+	for _, entry := range entries {
+		if entry.Protocol == protocol && !seen[entry.Port] {
+			seen[entry.Port] = true
+			ranked = append(ranked, entry)
+		}
+	}
+	if n > len(ranked) {
+		return nil, fmt.Errorf("the services file ranks only %d %s ports, fewer than the %d asked for; use --services-file with an nmap-services file for more", len(ranked), protocol, n)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Frequency > ranked[j].Frequency
+	})
+
+	ports := make([]int, n)
+	for i, entry := range ranked[:n] {
+		ports[i] = entry.Port
+	}
+	return ports, nil
+}
+
+// ParsePortSpec parses a comma separated list of ports, ranges (1-1024, 60000- or - for all ports) and profile names
+func ParsePortSpec(spec string) ([]int, error) {
+	seen := map[int]bool{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		if profile, ok := portProfiles[item]; ok {
+			for _, port := range profile {
+				seen[port] = true
+			}
+			continue
+		}
+
+		low, high, isRange := strings.Cut(item, "-")
+		if !isRange {
+			high = low
+		}
+		first, last := 1, 65535
+		var err error
+		if low != "" {
+			if first, err = strconv.Atoi(low); err != nil {
+				return nil, fmt.Errorf("invalid port or profile %q, profiles are %s", item, strings.Join(PortProfiles(), ", "))
+			}
+		}
+		if high != "" {
+			if last, err = strconv.Atoi(high); err != nil {
+				return nil, fmt.Errorf("invalid port range %q", item)
+			}
+		}
+		if first < 1 || last > 65535 || first > last {
+			return nil, fmt.Errorf("invalid port range %q, ports go from 1 to 65535", item)
+		}
+		for port := first; port <= last; port++ {
+			seen[port] = true
+		}
+	}
+
+	ports := make([]int, 0, len(seen))
+	for port := range seen {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// PortProfiles returns the names of the port profiles
+func PortProfiles() []string {
+	var names []string
+	for name := range portProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SelectedPorts returns the ports chosen with PortSpec and TopPorts, both are combined, or the common profile
+func SelectedPorts() ([]int, error) {
+	if _, err := Services(); err != nil {
+		return nil, err
+	}
+	if PortSpec == "" && TopPorts <= 0 {
+		return ParsePortSpec("common")
+	}
+	ports, err := ParsePortSpec(PortSpec)
+	if err != nil {
+		return nil, err
+	}
+	if TopPorts > 0 {
+		top, err := TopPortsList(TopPorts, "tcp")
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, top...)
+		seen := map[int]bool{}
+		unique := ports[:0]
+		for _, port := range ports {
+			if !seen[port] {
+				seen[port] = true
+				unique = append(unique, port)
+			}
+		}
+		ports = unique
+		sort.Ints(ports)
+	}
+	if len(ports) == 0 {
+		return nil, errors.New("no ports selected")
+	}
+	return ports, nil
+}
+
+// dialPort tells whether a port accepts a connection, attempts that time out are retried PortRetries times
+func dialPort(protocol, hostname string, port int) bool {
+	address := net.JoinHostPort(hostname, strconv.Itoa(port))
+	for attempt := 0; attempt <= PortRetries; attempt++ {
+		waitScanRate()
+		conn, err := net.DialTimeout(protocol, address, PortTimeout)
+		if err == nil {
+			conn.Close()
+			return true
+		}
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			return false
+		}
+	}
+	return false
+}
+
 // ScanPort checks if a port is open on a given hostname
 func ScanPort(protocol, hostname string, port int, wg *sync.WaitGroup, results chan<- string, service string) {
 	defer wg.Done()
-	address := fmt.Sprintf("%s:%d", hostname, port)
-	conn, err := net.DialTimeout(protocol, address, 500*time.Millisecond)
-	if err == nil {
+	if dialPort(protocol, hostname, port) {
 		results <- fmt.Sprintf("%d (%s)", port, service)
-		conn.Close()
-	}
-}
-
-// PortScan scans common ports on a given hostname and returns their services
-func PortScan(hostname string) string {
-	ports := map[int]string{
-		21:    "FTP",
-		22:    "SSH",
-		25:    "SMTP",
-		53:    "DNS",
-		80:    "HTTP",
-		110:   "POP3",
-		143:   "IMAP",
-		389:   "LDAP",
-		443:   "HTTPS",
-		465:   "SMTPS",
-		587:   "SMTP",
-		993:   "IMAPS",
-		995:   "POP3S",
-		1433:  "MSSQL",
-		1521:  "Oracle DB",
-		3306:  "MySQL",
-		3389:  "RDP",
-		5432:  "PostgreSQL",
-		5900:  "VNC",
-		6379:  "Redis",
-		8000:  "HTTP-alt",
-		8080:  "HTTP-proxy",
-		8443:  "HTTPS-alt",
-		9200:  "Elasticsearch",
-		9300:  "Elasticsearch",
-		27017: "MongoDB",
 	}
+}
+
+// AddressScan holds the open ports and services of one address of a host
+type AddressScan struct {
+	IP       net.IP
+	Name     string // reverse DNS name
+	Open     []int
+	Services []ServiceInfo // empty when service detection is off
+	UDP      []UDPResult   // empty when the UDP scan is off
+}
 
+// ScanAddresses scans the ports on every IPv4 and IPv6 address of a host or every address of a network target
+func ScanAddresses(target string, ports []int) ([]AddressScan, error) {
+	addresses, err := ResolveTargets(target)
+	if err != nil {
+		return nil, err
+	}
+	network := IsNetworkTarget(target)
+	scans := make([]AddressScan, len(addresses))
+	forEachAddress(addresses, func(i int, ip net.IP) {
+		scan := AddressScan{IP: ip, Name: ReverseDNS(ip), Open: ScanPorts(ip.String(), ports)}
+		// Addresses of a network are identified by themselves in the TLS handshake, those of a domain by the domain
+		serverName := strings.Trim(target, "[]")
+		if network {
+			serverName = ip.String()
+		}
+		if ServiceDetection {
+			scan.Services = DetectServices(ip.String(), serverName, scan.Open)
+		}
+		if UDPScan {
+			scan.UDP = ScanUDP(ip.String())
+		}
+		scans[i] = scan
+	})
+	return scans, nil
+}
+
+// responsive tells whether an address has an open TCP port or an answering UDP service
+func (scan AddressScan) responsive() bool {
+	for _, result := range scan.UDP {
+		if result.State == UDPOpen {
+			return true
+		}
+	}
+	return len(scan.Open) > 0
+}
+
+// PortScan scans the selected ports on every address of a hostname or network target and identifies the
+// services on the open ones. Addresses of a network target that answer on no port are left out of the report.
+func PortScan(target string) string {
+	ports, err := SelectedPorts()
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	scans, err := ScanAddresses(target, ports)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+
+	var sb strings.Builder
+	network := IsNetworkTarget(target)
+	reported := 0
+	for _, scan := range scans {
+		if network && !scan.responsive() {
+			continue
+		}
+		if reported > 0 {
+			sb.WriteString("\n\n")
+		}
+		reported++
+		address := fmt.Sprintf("%s (%s)", scan.IP, AddressFamily(scan.IP))
+		if scan.Name != "" {
+			address = fmt.Sprintf("%s (%s, %s)", scan.IP, AddressFamily(scan.IP), scan.Name)
+		}
+		fmt.Fprintf(&sb, "Address: %s\n", address)
+		if len(scan.Services) > 0 {
+			table := tablewriter.NewWriter(&sb)
+			table.SetHeader([]string{"Port", "Service", "Version", "Info"})
+			table.SetAlignment(tablewriter.ALIGN_LEFT)
+			table.SetBorder(false)
+			table.SetAutoWrapText(false)
+			for _, service := range scan.Services {
+				table.Append([]string{strconv.Itoa(service.Port) + "/tcp", service.ServiceName(), service.VersionString(), service.Details()})
+			}
+			table.Render()
+		} else {
+			for _, port := range scan.Open {
+				fmt.Fprintf(&sb, "%d (%s)\n", port, ServiceName(port, "tcp"))
+			}
+		}
+		fmt.Fprintf(&sb, "\n%d of %d scanned ports are open", len(scan.Open), len(ports))
+		if len(scan.UDP) > 0 {
+			sb.WriteString("\n\n" + formatUDPResults(scan.UDP))
+		}
+	}
+	if network {
+		if reported > 0 {
+			sb.WriteString("\n\n")
+		}
+		fmt.Fprintf(&sb, "%d of %d scanned addresses answered", reported, len(scans))
+	}
+
+	return sb.String()
+}
+
+// ScanPorts returns the given ports that accept a TCP connection, in ascending order
+func ScanPorts(hostname string, ports []int) []int {
 	var wg sync.WaitGroup
-	results := make(chan string, len(ports))
+	results := make(chan int, len(ports))
 
-	concurrencyLimit := make(chan struct{}, 100) // Adjust the limit as needed
+	concurrencyLimit := make(chan struct{}, max(1, PortConcurrency))
 
-	for port, service := range ports {
+	for _, port := range ports {
 		wg.Add(1)
 		concurrencyLimit <- struct{}{} // Acquire a slot
-		go func(port int, service string) {
+		go func(port int) {
+			defer wg.Done()
 			defer func() { <-concurrencyLimit }() // Release the slot
-			ScanPort("tcp", hostname, port, &wg, results, service)
-		}(port, service)
+			if dialPort("tcp", hostname, port) {
+				results <- port
+			}
+		}(port)
 	}
 
 	wg.Wait()
 	close(results)
 
-	var openPorts []string
-	for result := range results {
-		openPorts = append(openPorts, result)
+	var openPorts []int
+	for port := range results {
+		openPorts = append(openPorts, port)
 	}
-
-	return strings.Join(openPorts, "\n")
+	sort.Ints(openPorts)
+	return openPorts
 }
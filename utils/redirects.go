@@ -0,0 +1,252 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+// maxRedirects and maxBodySize limit what FetchRedirectChain follows and keeps in memory
+const (
+	maxRedirects = 10
+	maxBodySize  = 2 << 20
+)
+
+// ErrRedirectLoop is returned when a redirect chain comes back to a URL it already visited
+var ErrRedirectLoop = errors.New("redirect loop")
+
+// openRedirectCanary is the external URL injected into redirect parameters, the .invalid TLD never resolves
+const openRedirectCanary = "https://dominfo-open-redirect.invalid/"
+
+// redirectParams are query parameter names commonly used to pass a redirect target
+var redirectParams = map[string]bool{
+	"url": true, "uri": true, "redirect": true, "redirect_url": true, "redirect_uri": true, "redirecturl": true,
+	"redir": true, "next": true, "return": true, "returnurl": true, "return_url": true, "returnto": true,
+	"return_to": true, "goto": true, "dest": true, "destination": true, "continue": true, "target": true,
+	"forward": true, "callback": true, "rurl": true, "r": true, "u": true, "to": true, "out": true, "view": true,
+}
+
+// RedirectChain is the sequence of responses seen when requesting a URL without following redirects automatically
+type RedirectChain struct {
+	Start     string
+	Responses []*http.Response
+	Err       error
+}
+
+// RedirectReport holds the chains for both schemes and the problems found in them
+type RedirectReport struct {
+	Domain        string
+	HTTP          RedirectChain
+	HTTPS         RedirectChain
+	Issues        []string
+	OpenRedirects []string // parameters confirmed to redirect to the canary URL
+}
+
+func newRedirectClient() *http.Client {
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// FetchRedirectChain requests a URL and follows its redirects one by one, returning every response of the chain.
+// The bodies are read up to maxBodySize and can be read again from the returned responses.
+func FetchRedirectChain(rawURL string) ([]*http.Response, error) {
+	client := newRedirectClient()
+	visited := map[string]bool{}
+
+	var chain []*http.Response
+	for len(chain) <= maxRedirects {
+		visited[rawURL] = true
+		resp, err := client.Get(rawURL)
+		if err != nil {
+			return chain, err
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		chain = append(chain, resp)
+
+		location := resp.Header.Get("Location")
+		if resp.StatusCode < 300 || resp.StatusCode > 399 || location == "" {
+			return chain, nil
+		}
+		next, err := resp.Request.URL.Parse(location)
+		if err != nil {
+			return chain, fmt.Errorf("invalid redirect location %q: %w", location, err)
+		}
+		rawURL = next.String()
+		if visited[rawURL] {
+			return chain, fmt.Errorf("%w back to %s", ErrRedirectLoop, rawURL)
+		}
+	}
+	return chain, fmt.Errorf("stopped after %d redirects", maxRedirects)
+}
+
+// AnalyzeRedirects records the redirect chains of http:// and https:// and checks how HTTPS is enforced
+func AnalyzeRedirects(domain string) RedirectReport {
+	report := RedirectReport{Domain: domain}
+	for _, chain := range []*RedirectChain{&report.HTTP, &report.HTTPS} {
+		scheme := "http"
+		if chain == &report.HTTPS {
+			scheme = "https"
+		}
+		chain.Start = scheme + "://" + domain + "/"
+		chain.Responses, chain.Err = FetchRedirectChain(chain.Start)
+	}
+	issue := func(format string, args ...interface{}) {
+		report.Issues = append(report.Issues, fmt.Sprintf(format, args...))
+	}
+
+	for _, chain := range []RedirectChain{report.HTTP, report.HTTPS} {
+		if errors.Is(chain.Err, ErrRedirectLoop) {
+			issue("Redirect loop starting at %s", chain.Start)
+		}
+		// A hop from HTTPS back to HTTP exposes the request and any cookies without Secure
+		for i := 1; i < len(chain.Responses); i++ {
+			from, to := chain.Responses[i-1].Request.URL, chain.Responses[i].Request.URL
+			if from.Scheme == "https" && to.Scheme == "http" {
+				issue("Downgrade from %s to %s", from, to)
+			}
+		}
+	}
+
+	if len(report.HTTP.Responses) > 0 {
+		first := report.HTTP.Responses[0]
+		final := report.HTTP.Responses[len(report.HTTP.Responses)-1].Request.URL
+		next := redirectTarget(first)
+		switch {
+		case final.Scheme != "https":
+			issue("HTTP is not redirected to HTTPS")
+		case next == nil || next.Scheme != "https" || !strings.EqualFold(next.Hostname(), domain):
+			// The HSTS preload list requires the first redirect to stay on the host so that its HSTS header is seen
+			issue("The first HTTP redirect does not go to https://%s, required for HSTS preload", domain)
+		}
+		if next != nil && next.Scheme == "https" && (first.StatusCode == http.StatusFound || first.StatusCode == http.StatusSeeOther || first.StatusCode == http.StatusTemporaryRedirect) {
+			issue("HTTP to HTTPS redirect uses the temporary status %d, use 301 or 308", first.StatusCode)
+		}
+	}
+	if report.HTTPS.Err != nil && len(report.HTTPS.Responses) == 0 {
+		issue("HTTPS is not available: %s", report.HTTPS.Err)
+	}
+
+	report.OpenRedirects = probeOpenRedirects(append(append([]*http.Response{}, report.HTTP.Responses...), report.HTTPS.Responses...))
+	for _, param := range report.OpenRedirects {
+		issue("Open redirect: %s", param)
+	}
+	return report
+}
+
+// redirectTarget resolves the Location of a redirect response
+func redirectTarget(resp *http.Response) *url.URL {
+	location := resp.Header.Get("Location")
+	if resp.StatusCode < 300 || resp.StatusCode > 399 || location == "" {
+		return nil
+	}
+	target, err := resp.Request.URL.Parse(location)
+	if err != nil {
+		return nil
+	}
+	return target
+}
+
+// probeOpenRedirects replaces redirect-like parameters seen in the chain with an external URL and checks
+// whether the server redirects to it
+func probeOpenRedirects(responses []*http.Response) []string {
+	client := newRedirectClient()
+	tested := map[string]bool{}
+	var found []string
+
+	var candidates []*url.URL
+	for _, resp := range responses {
+		candidates = append(candidates, resp.Request.URL)
+		if target := redirectTarget(resp); target != nil {
+			candidates = append(candidates, target)
+		}
+	}
+
+	for _, candidate := range candidates {
+		query := candidate.Query()
+		for param, values := range query {
+			if !redirectParams[strings.ToLower(param)] && !looksLikeURL(values) {
+				continue
+			}
+			key := candidate.Host + candidate.Path + "?" + param
+			if tested[key] {
+				continue
+			}
+			tested[key] = true
+
+			probe := *candidate
+			probeQuery := candidate.Query()
+			probeQuery.Set(param, openRedirectCanary)
+			probe.RawQuery = probeQuery.Encode()
+			resp, err := client.Get(probe.String())
+			if err != nil {
+				continue
+			}
+			resp.Body.Close()
+			if target := redirectTarget(resp); target != nil && target.Hostname() == "dominfo-open-redirect.invalid" {
+				found = append(found, fmt.Sprintf("%s%s?%s=", candidate.Host, candidate.Path, param))
+			}
+		}
+	}
+	return found
+}
+
+func looksLikeURL(values []string) bool {
+	for _, value := range values {
+		lower := strings.ToLower(value)
+		if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "//") || strings.HasPrefix(lower, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatRedirectReport renders both redirect chains hop by hop followed by the findings
+func FormatRedirectReport(report RedirectReport) string {
+	var sb strings.Builder
+	sb.WriteString(color.New(color.FgYellow, color.Bold).Sprintf("\nRedirect Chains for %s\n\n", report.Domain))
+
+	table := tablewriter.NewWriter(&sb)
+	table.SetHeader([]string{"Start", "Hop", "URL", "Status", "Location"})
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	for _, chain := range []RedirectChain{report.HTTP, report.HTTPS} {
+		for i, resp := range chain.Responses {
+			status := fmt.Sprintf("%d", resp.StatusCode)
+			switch {
+			case resp.StatusCode >= 400:
+				status = color.RedString(status)
+			case resp.StatusCode >= 300:
+				status = color.YellowString(status)
+			default:
+				status = color.GreenString(status)
+			}
+			table.Append([]string{chain.Start, fmt.Sprintf("%d", i+1), resp.Request.URL.String(), status, resp.Header.Get("Location")})
+		}
+		if chain.Err != nil {
+			table.Append([]string{chain.Start, fmt.Sprintf("%d", len(chain.Responses)+1), "", color.RedString("error"), chain.Err.Error()})
+		}
+	}
+	table.Render()
+
+	if len(report.Issues) == 0 {
+		sb.WriteString(color.GreenString("HTTPS is enforced, no redirect issues found\n"))
+	}
+	for _, issue := range report.Issues {
+		sb.WriteString(color.RedString("  - %s\n", issue))
+	}
+	return sb.String()
+}
@@ -1,92 +1,96 @@
 package utils
 
 import (
-	"crypto/tls"
 	"fmt"
-	"net/http"
 	"strings"
 
 	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
 )
 
-// DetectServerTechnologies detects technologies used by the server
+// DetectServerTechnologies detects technologies used by the server with the fingerprint rules
 func DetectServerTechnologies(domain string) (string, error) {
-	// Create a custom HTTP client to handle both HTTP and HTTPS requests
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
+	detected, page, err := DetectTechnologies(domain)
+	if err != nil {
+		return "", err
 	}
 
-	// Function to make a request and gather headers
-	getHeaders := func(url string) (http.Header, error) {
-		resp, err := client.Get(url)
-		if err != nil {
-			return nil, fmt.Errorf("could not make request to the domain: %w", err)
+	// Favicon and page hashes identify appliances and login pages that send no telling headers
+	fingerprint, fingerprintErr := FingerprintHashes(page)
+	if db, err := Fingerprints(); err == nil && fingerprintErr == nil {
+		for _, favicon := range fingerprint.Favicons {
+			for _, product := range favicon.Products {
+				detected = db.AddProduct(detected, product, "favicon hash")
+			}
 		}
-		defer resp.Body.Close()
-		return resp.Header, nil
-	}
-
-	// Attempt both HTTP and HTTPS
-	headers, err := getHeaders("http://" + domain)
-	if err != nil {
-		headers, err = getHeaders("https://" + domain)
-		if err != nil {
-			return "", fmt.Errorf("could not make request to the domain using both HTTP and HTTPS: %w", err)
+		for _, product := range fingerprint.Products {
+			detected = db.AddProduct(detected, product, "html structure hash")
 		}
 	}
 
 	var technologies []string
-	var os string
-
-	// Analyze the headers
-	if server := headers.Get("Server"); server != "" {
-		technologies = append(technologies, "Server: "+server)
-		serverLower := strings.ToLower(server)
-		if strings.Contains(serverLower, "apache") {
-			technologies = append(technologies, "Technology: Apache")
-			os = "Linux/Unix"
-		} else if strings.Contains(serverLower, "nginx") {
-			technologies = append(technologies, "Technology: Nginx")
-			os = "Linux/Unix"
-		} else if strings.Contains(serverLower, "microsoft-iis") {
-			technologies = append(technologies, "Technology: IIS")
-			os = "Windows"
-		} else if strings.Contains(serverLower, "cloudflare") {
-			technologies = append(technologies, "Technology: Cloudflare")
-			os = "Unknown"
+	for _, header := range []string{"Server", "X-Powered-By", "X-AspNet-Version"} {
+		if value := page.Headers.Get(header); value != "" {
+			technologies = append(technologies, header+": "+value)
 		}
 	}
 
-	if xPoweredBy := headers.Get("X-Powered-By"); xPoweredBy != "" {
-		technologies = append(technologies, "X-Powered-By: "+xPoweredBy)
-		xPoweredByLower := strings.ToLower(xPoweredBy)
-		if strings.Contains(xPoweredByLower, "php") {
-			technologies = append(technologies, "Technology: PHP")
-		} else if strings.Contains(xPoweredByLower, "asp.net") {
-			technologies = append(technologies, "Technology: ASP.NET")
-			os = "Windows"
-		} else if strings.Contains(xPoweredByLower, "node.js") {
-			technologies = append(technologies, "Technology: Node.js")
-		} else if strings.Contains(xPoweredByLower, "java") {
-			technologies = append(technologies, "Technology: Java")
+	var os []string
+	var sb strings.Builder
+	table := tablewriter.NewWriter(&sb)
+	table.SetHeader([]string{"Technology", "Version", "Categories", "Confidence", "Evidence"})
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	for _, technology := range detected {
+		for _, category := range technology.Categories {
+			if category == "Operating systems" {
+				os = append(os, technology.Name)
+			}
 		}
+		table.Append([]string{technology.Name, technology.Version, strings.Join(technology.Categories, ", "), fmt.Sprintf("%d%%", technology.Confidence), strings.Join(technology.Evidence, ", ")})
+	}
+	if len(detected) > 0 {
+		table.Render()
 	}
 
-	if xAspNetVersion := headers.Get("X-AspNet-Version"); xAspNetVersion != "" {
-		technologies = append(technologies, "X-AspNet-Version: "+xAspNetVersion)
-		technologies = append(technologies, "Technology: ASP.NET")
-		os = "Windows"
+	// robots.txt, sitemaps and the well-known files often name the CMS or the identity provider
+	var contacts []string
+	if info, err := InspectWellKnown(domain); err == nil {
+		for _, technology := range info.Technologies {
+			technologies = append(technologies, "Technology: "+technology+" (robots.txt/.well-known)")
+		}
+		contacts = info.SecurityContacts
 	}
 
-	if len(technologies) == 0 {
+	if len(technologies) == 0 && len(detected) == 0 {
 		return "No specific technologies detected", nil
 	}
 
-	result := fmt.Sprintf("\n%s\n%s", color.New(color.FgYellow, color.Bold).Sprint("Server Technologies:"), strings.Join(technologies, "\n"))
-	if os != "" {
-		result += fmt.Sprintf("\n%s\n%s", color.New(color.FgYellow, color.Bold).Sprint("Operating System:"), os)
+	result := "\n" + color.New(color.FgYellow, color.Bold).Sprint("Server Technologies:")
+	if len(technologies) > 0 {
+		result += "\n" + strings.Join(technologies, "\n") + "\n"
+	}
+	if sb.Len() > 0 {
+		result += "\n" + strings.TrimRight(sb.String(), "\n")
+	}
+	if len(os) > 0 {
+		result += fmt.Sprintf("\n%s\n%s", color.New(color.FgYellow, color.Bold).Sprint("Operating System:"), strings.Join(os, ", "))
+	}
+	if fingerprintErr != nil {
+		result += "\n" + color.RedString("error: could not load the favicon database: %s", fingerprintErr)
+	} else {
+		result += fmt.Sprintf("\n%s\n%s", color.New(color.FgYellow, color.Bold).Sprint("Favicon and HTML Fingerprint:"), FormatPageFingerprint(fingerprint))
+	}
+	if len(contacts) > 0 {
+		result += fmt.Sprintf("\n%s\n%s", color.New(color.FgYellow, color.Bold).Sprint("Security Contact (security.txt):"), strings.Join(contacts, "\n"))
+	}
+
+	// A broken --vuln-db file should not hide the detected technologies
+	if vulnerabilities, err := MatchVulnerabilities(detected); err != nil {
+		result += "\n" + color.RedString("error: could not load the vulnerability dataset: %s", err)
+	} else {
+		result += "\n" + strings.TrimRight(FormatVulnerabilityReport(vulnerabilities), "\n")
 	}
 	return result, nil
 }
@@ -0,0 +1,490 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/tls"
+	_ "embed"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// defaultServiceProbes are the bundled probes and match signatures
+//
+//go:embed service_probes.txt
+var defaultServiceProbes []byte
+
+// Service detection settings, they are set from the command line
+var (
+	ServiceDetection  = true
+	ServiceProbesFile string // probe file in the nmap-service-probes format used instead of the bundled one
+	ProbeTimeout      = 3 * time.Second
+)
+
+// maxProbeResponse limits how much of an answer is read and matched
+const maxProbeResponse = 32 << 10
+
+// serviceMatch is a match or softmatch line, the fields are templates filled with the regex groups
+type serviceMatch struct {
+	Service    string
+	Soft       bool
+	Regex      *regexp.Regexp
+	Product    string
+	Version    string
+	Info       string
+	Hostname   string
+	OS         string
+	DeviceType string
+}
+
+// ServiceProbe is a payload sent to a port and the signatures its answers are matched against
+type ServiceProbe struct {
+	Protocol string
+	Name     string
+	Payload  []byte
+	Ports    map[int]bool
+	SSLPorts map[int]bool
+	Matches  []serviceMatch
+}
+
+// ServiceInfo is the service identified on a port
+type ServiceInfo struct {
+	Port       int
+	Service    string
+	Product    string
+	Version    string
+	Info       string
+	Hostname   string
+	OS         string
+	DeviceType string
+	TLS        bool
+	Matched    bool   // false when the name is only the usual service of the port
+	Banner     string // first line of the answer, shown when nothing matched
+}
+
+var (
+	serviceProbesOnce sync.Once
+	serviceProbes     []ServiceProbe
+	serviceProbesErr  error
+)
+
+// ServiceProbes returns the probes of ServiceProbesFile or the bundled ones, they are loaded once
+func ServiceProbes() ([]ServiceProbe, error) {
+	serviceProbesOnce.Do(func() {
+		data := defaultServiceProbes
+		if ServiceProbesFile != "" {
+			if data, serviceProbesErr = os.ReadFile(ServiceProbesFile); serviceProbesErr != nil {
+				serviceProbesErr = fmt.Errorf("could not read service probes: %w", serviceProbesErr)
+				return
+			}
+		}
+		serviceProbes, _, serviceProbesErr = ParseServiceProbes(bytes.NewReader(data))
+	})
+	return serviceProbes, serviceProbesErr
+}
+
+// ParseServiceProbes reads a probe file in the nmap-service-probes format. Matches whose regex RE2 cannot
+// compile are skipped and counted, directives other than Probe, ports, sslports, match and softmatch are ignored.
+func ParseServiceProbes(r io.Reader) ([]ServiceProbe, int, error) {
+	var probes []ServiceProbe
+	skipped := 0
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	for number, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		directive, rest, _ := strings.Cut(line, " ")
+		if directive == "Probe" {
+			fields := strings.SplitN(rest, " ", 3)
+			if len(fields) < 3 || !strings.HasPrefix(fields[2], "q") || len(fields[2]) < 3 {
+				return nil, 0, fmt.Errorf("line %d: invalid probe", number+1)
+			}
+			delimiter := fields[2][1:2]
+			payload, _, ok := strings.Cut(fields[2][2:], delimiter)
+			if !ok {
+				return nil, 0, fmt.Errorf("line %d: unterminated probe payload", number+1)
+			}
+			probes = append(probes, ServiceProbe{Protocol: fields[0], Name: fields[1], Payload: unescapeProbe(payload), Ports: map[int]bool{}, SSLPorts: map[int]bool{}})
+			continue
+		}
+		if len(probes) == 0 {
+			continue
+		}
+		probe := &probes[len(probes)-1]
+		switch directive {
+		case "ports", "sslports":
+			ports, err := ParsePortSpec(rest)
+			if err != nil {
+				return nil, 0, fmt.Errorf("line %d: %w", number+1, err)
+			}
+			for _, port := range ports {
+				if directive == "ports" {
+					probe.Ports[port] = true
+				} else {
+					probe.SSLPorts[port] = true
+				}
+			}
+		case "match", "softmatch":
+			match, err := parseServiceMatch(rest, directive == "softmatch")
+			if err != nil {
+				skipped++
+				continue
+			}
+			probe.Matches = append(probe.Matches, match)
+		}
+	}
+	return probes, skipped, nil
+}
+
+// parseServiceMatch parses "service m|regex|flags p/product/ v/version/ ..."
+func parseServiceMatch(line string, soft bool) (serviceMatch, error) {
+	service, rest, _ := strings.Cut(line, " ")
+	match := serviceMatch{Service: service, Soft: soft}
+	if len(rest) < 3 || rest[0] != 'm' {
+		return match, fmt.Errorf("missing pattern")
+	}
+	delimiter := rest[1:2]
+	pattern, rest, ok := strings.Cut(rest[2:], delimiter)
+	if !ok {
+		return match, fmt.Errorf("unterminated pattern")
+	}
+	flags, rest, _ := strings.Cut(rest, " ")
+	goFlags := ""
+	for _, flag := range flags {
+		if flag == 's' || flag == 'i' {
+			goFlags += string(flag)
+		}
+	}
+	if goFlags != "" {
+		pattern = "(?" + goFlags + ")" + pattern
+	}
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return match, err
+	}
+	match.Regex = regex
+
+	// Version fields are a letter followed by a delimited value, cpe:/.../ entries are skipped
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		key := rest[:1]
+		if strings.HasPrefix(rest, "cpe:") {
+			key, rest = "cpe", rest[3:]
+		}
+		if len(rest) < 2 {
+			break
+		}
+		delimiter := rest[1:2]
+		value, after, ok := strings.Cut(rest[2:], delimiter)
+		if !ok {
+			break
+		}
+		rest = strings.TrimLeft(after, "a")
+		switch key {
+		case "p":
+			match.Product = value
+		case "v":
+			match.Version = value
+		case "i":
+			match.Info = value
+		case "h":
+			match.Hostname = value
+		case "o":
+			match.OS = value
+		case "d":
+			match.DeviceType = value
+		}
+	}
+	return match, nil
+}
+
+// unescapeProbe decodes the \r, \n, \t, \0 and \xHH escapes of a probe payload
+func unescapeProbe(payload string) []byte {
+	var out []byte
+	for i := 0; i < len(payload); i++ {
+		if payload[i] != '\\' || i+1 == len(payload) {
+			out = append(out, payload[i])
+			continue
+		}
+		i++
+		switch payload[i] {
+		case 'r':
+			out = append(out, '\r')
+		case 'n':
+			out = append(out, '\n')
+		case 't':
+			out = append(out, '\t')
+		case '0':
+			out = append(out, 0)
+		case 'x':
+			if i+2 < len(payload) {
+				if b, err := strconv.ParseUint(payload[i+1:i+3], 16, 8); err == nil {
+					out = append(out, byte(b))
+					i += 2
+					continue
+				}
+			}
+			out = append(out, 'x')
+		default:
+			out = append(out, payload[i])
+		}
+	}
+	return out
+}
+
+// latin1 maps every byte to the rune with the same value, so that \xHH in a pattern matches the byte HH
+func latin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+var templateGroup = regexp.MustCompile(`\$P\((\d)\)|\$(\d)`)
+
+// fill replaces $1 and $P(1) in a template with the regex groups
+func fill(template string, groups []string) string {
+	value := templateGroup.ReplaceAllStringFunc(template, func(ref string) string {
+		m := templateGroup.FindStringSubmatch(ref)
+		index, _ := strconv.Atoi(m[1] + m[2])
+		if index >= len(groups) {
+			return ""
+		}
+		if m[1] != "" {
+			return printable(groups[index])
+		}
+		return groups[index]
+	})
+	return strings.TrimSpace(value)
+}
+
+// printable drops control and non-ASCII characters
+func printable(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return -1
+		}
+		return r
+	}, value)
+}
+
+// sendProbe connects, optionally wraps the connection in TLS, sends the payload and reads the answer.
+// After the first bytes only a short wait follows, most services answer in one go.
+func sendProbe(host, serverName string, port int, useTLS bool, payload []byte) ([]byte, error) {
+	waitScanRate()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), ProbeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ProbeTimeout))
+	if useTLS {
+		tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true, ServerName: serverName})
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	if len(payload) > 0 {
+		if _, err := conn.Write(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	var response []byte
+	buf := make([]byte, 4096)
+	for len(response) < maxProbeResponse {
+		n, err := conn.Read(buf)
+		response = append(response, buf[:n]...)
+		if err != nil {
+			break
+		}
+		if n > 0 {
+			conn.SetReadDeadline(time.Now().Add(ProbeTimeout / 6))
+		}
+	}
+	if len(response) == 0 {
+		return nil, fmt.Errorf("no answer")
+	}
+	return response, nil
+}
+
+// matchResponse returns the first signature of the probe that matches the answer
+func (probe ServiceProbe) matchResponse(response []byte) (ServiceInfo, *serviceMatch) {
+	text := latin1(response)
+	for i := range probe.Matches {
+		match := &probe.Matches[i]
+		groups := match.Regex.FindStringSubmatch(text)
+		if groups == nil {
+			continue
+		}
+		return ServiceInfo{
+			Service:    match.Service,
+			Product:    fill(match.Product, groups),
+			Version:    fill(match.Version, groups),
+			Info:       fill(match.Info, groups),
+			Hostname:   fill(match.Hostname, groups),
+			OS:         fill(match.OS, groups),
+			DeviceType: fill(match.DeviceType, groups),
+			Matched:    true,
+		}, match
+	}
+	return ServiceInfo{}, nil
+}
+
+// looksLikeTLS tells whether a plaintext probe reached a TLS service: a TLS alert record or an HTTPS error page
+func looksLikeTLS(response []byte) bool {
+	return (len(response) > 1 && response[0] == 0x15 && response[1] == 0x03) ||
+		bytes.Contains(response, []byte("HTTP request was sent to HTTPS port")) ||
+		bytes.Contains(response, []byte("speaking plain HTTP to an SSL-enabled server")) ||
+		bytes.Contains(response, []byte("Client sent an HTTP request to an HTTPS server"))
+}
+
+// probeService runs the probes over plaintext or TLS: NULL first, then the probes registered for the port, then the rest
+func probeService(host, serverName string, port int, useTLS bool, probes []ServiceProbe) (result ServiceInfo, banner []byte, tlsHint bool) {
+	var ordered []ServiceProbe
+	for _, pass := range []int{0, 1, 2} {
+		for _, probe := range probes {
+			registered := probe.Ports[port] || (useTLS && probe.SSLPorts[port])
+			if (pass == 0 && probe.Name == "NULL") || (pass == 1 && probe.Name != "NULL" && registered) || (pass == 2 && probe.Name != "NULL" && !registered) {
+				ordered = append(ordered, probe)
+			}
+		}
+	}
+
+	var soft *ServiceInfo
+	for _, probe := range ordered {
+		if probe.Protocol != "TCP" {
+			continue
+		}
+		response, err := sendProbe(host, serverName, port, useTLS, probe.Payload)
+		if err != nil {
+			continue
+		}
+		if banner == nil {
+			banner = response
+		}
+		tlsHint = tlsHint || looksLikeTLS(response)
+		info, match := probe.matchResponse(response)
+		if match == nil {
+			continue
+		}
+		if !match.Soft {
+			return info, banner, tlsHint
+		}
+		if soft == nil {
+			soft = &info
+		}
+	}
+	if soft != nil {
+		return *soft, banner, tlsHint
+	}
+	return ServiceInfo{}, banner, tlsHint
+}
+
+// DetectService identifies the service and version on an open TCP port, serverName is sent in the TLS handshake
+func DetectService(host, serverName string, port int) ServiceInfo {
+	result := ServiceInfo{Port: port, Service: ServiceName(port, "tcp")}
+	probes, err := ServiceProbes()
+	if err != nil {
+		return result
+	}
+
+	sslPort := false
+	for _, probe := range probes {
+		sslPort = sslPort || probe.SSLPorts[port]
+	}
+
+	// Ports usually serving TLS are tried with TLS first, others fall back to TLS when plaintext finds nothing
+	var banner []byte
+	for _, useTLS := range []bool{sslPort, !sslPort} {
+		info, response, tlsHint := probeService(host, serverName, port, useTLS, probes)
+		if banner == nil {
+			banner = response
+		}
+		if info.Matched && !(tlsHint && !useTLS) {
+			info.Port, info.TLS = port, useTLS
+			return info
+		}
+		if !useTLS && !tlsHint && response != nil {
+			// A plaintext service answered without a match, TLS would not fare better
+			break
+		}
+	}
+
+	if banner != nil {
+		line, _, _ := strings.Cut(printable(strings.ReplaceAll(latin1(banner), "\n", " ")), "\r")
+		if len(line) > 60 {
+			line = line[:57] + "..."
+		}
+		result.Banner = line
+	}
+	return result
+}
+
+// DetectServices identifies the services on the open ports of a host in parallel
+func DetectServices(host, serverName string, ports []int) []ServiceInfo {
+	results := make([]ServiceInfo, len(ports))
+	var wg sync.WaitGroup
+	concurrencyLimit := make(chan struct{}, max(1, PortConcurrency))
+	for i, port := range ports {
+		wg.Add(1)
+		concurrencyLimit <- struct{}{}
+		go func(i, port int) {
+			defer wg.Done()
+			defer func() { <-concurrencyLimit }()
+			results[i] = DetectService(host, serverName, port)
+		}(i, port)
+	}
+	wg.Wait()
+	return results
+}
+
+// ServiceName returns the service name as shown in reports, ssl/ marks TLS and ? a name that was only guessed from the port
+func (s ServiceInfo) ServiceName() string {
+	name := s.Service
+	if s.TLS {
+		name = "ssl/" + name
+	}
+	if !s.Matched {
+		name += "?"
+	}
+	return name
+}
+
+// VersionString joins the product and version
+func (s ServiceInfo) VersionString() string {
+	return strings.TrimSpace(s.Product + " " + s.Version)
+}
+
+// Details joins the info, hostname, OS and device type, or the banner when nothing matched
+func (s ServiceInfo) Details() string {
+	var details []string
+	if s.Info != "" {
+		details = append(details, s.Info)
+	}
+	if s.Hostname != "" {
+		details = append(details, "host: "+s.Hostname)
+	}
+	if s.OS != "" {
+		details = append(details, "os: "+s.OS)
+	}
+	if s.DeviceType != "" {
+		details = append(details, "device: "+s.DeviceType)
+	}
+	if len(details) == 0 && s.Banner != "" {
+		details = append(details, "banner: "+s.Banner)
+	}
+	return strings.Join(details, ", ")
+}
@@ -0,0 +1,361 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/miekg/dns"
+)
+
+// smtpPorts lists the mail submission and relay ports checked on every MX host
+var smtpPorts = []int{25, 465, 587}
+
+// SMTPCheckOptions controls how a mail server is inspected
+type SMTPCheckOptions struct {
+	HeloName       string        // Name sent in EHLO, defaults to "dominfo.local"
+	Timeout        time.Duration // Dial and read timeout, defaults to 10 seconds
+	RelayTest      bool          // Run the non-destructive open relay test
+	RelaySender    string        // External sender used by the relay test
+	RelayRecipient string        // External recipient used by the relay test
+	SkipDANE       bool          // Skip TLSA lookups, e.g. against a local stand-in
+}
+
+// SMTPCheckResult holds the findings for a single MX host and port
+type SMTPCheckResult struct {
+	Host          string
+	Port          int
+	Banner        string
+	Extensions    []string
+	TLSExtensions []string
+	ImplicitTLS   bool
+	StartTLS      bool
+	TLSVersion    string
+	CipherSuite   string
+	Certificate   *x509.Certificate
+	HostnameErr   error
+	ChainErr      error
+	DANE          string
+	OpenRelay     string
+	Err           error
+}
+
+// CheckMailServers inspects every MX host of a domain on the SMTP ports
+func CheckMailServers(domain string, relayTest bool) (string, error) {
+	mxRecords, err := net.LookupMX(domain)
+	if err != nil {
+		return "", fmt.Errorf("could not fetch MX records for domain %s: %v", domain, err)
+	}
+	if len(mxRecords) == 0 {
+		return fmt.Sprintf("\n%s\n%s", color.New(color.FgYellow, color.Bold).Sprint("Mail Servers:"), "No MX records found"), nil
+	}
+
+	sort.Slice(mxRecords, func(i, j int) bool { return mxRecords[i].Pref < mxRecords[j].Pref })
+
+	opts := SMTPCheckOptions{RelayTest: relayTest}
+	results := make([][]SMTPCheckResult, len(mxRecords))
+	done := make(chan struct{})
+
+	for i, mx := range mxRecords {
+		go func(i int, host string) {
+			defer func() { done <- struct{}{} }()
+			for _, port := range smtpPorts {
+				results[i] = append(results[i], InspectSMTP(host, port, opts))
+			}
+		}(i, strings.TrimSuffix(mx.Host, "."))
+	}
+	for range mxRecords {
+		<-done
+	}
+
+	var sb strings.Builder
+	sb.WriteString(color.New(color.FgYellow, color.Bold).Sprint("\nMail Servers:\n"))
+	for i, mx := range mxRecords {
+		sb.WriteString(fmt.Sprintf("\n%s %s (preference %d)\n", color.New(color.FgYellow, color.Bold).Sprint("MX:"), strings.TrimSuffix(mx.Host, "."), mx.Pref))
+		for _, result := range results[i] {
+			sb.WriteString(formatSMTPResult(result))
+		}
+	}
+	return sb.String(), nil
+}
+
+// InspectSMTP connects to a mail server and records its banner, extensions and TLS setup
+func InspectSMTP(host string, port int, opts SMTPCheckOptions) SMTPCheckResult {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return SMTPCheckResult{Host: host, Port: port, Err: err}
+	}
+	defer conn.Close()
+
+	return InspectSMTPConn(conn, host, port, opts)
+}
+
+// InspectSMTPConn runs the SMTP checks over an existing connection, which lets the check run against a local stand-in
+func InspectSMTPConn(conn net.Conn, host string, port int, opts SMTPCheckOptions) SMTPCheckResult {
+	result := SMTPCheckResult{Host: host, Port: port}
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	heloName := opts.HeloName
+	if heloName == "" {
+		heloName = "dominfo.local"
+	}
+	conn.SetDeadline(time.Now().Add(3 * timeout))
+
+	tlsConfig := &tls.Config{ServerName: host, InsecureSkipVerify: true}
+
+	// Port 465 speaks TLS from the first byte (SMTPS)
+	if port == 465 {
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			result.Err = fmt.Errorf("TLS handshake failed: %v", err)
+			return result
+		}
+		result.ImplicitTLS = true
+		recordSMTPTLS(&result, tlsConn.ConnectionState(), opts)
+		conn = tlsConn
+	}
+
+	text := textproto.NewConn(conn)
+	_, banner, err := text.ReadResponse(220)
+	if err != nil {
+		result.Err = fmt.Errorf("unexpected greeting: %v", err)
+		return result
+	}
+	result.Banner = banner
+
+	extensions, err := smtpHello(text, heloName)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Extensions = extensions
+
+	if !result.ImplicitTLS && hasSMTPExtension(extensions, "STARTTLS") {
+		if _, _, err := smtpCmd(text, 220, "STARTTLS"); err != nil {
+			result.Err = fmt.Errorf("STARTTLS rejected: %v", err)
+			return result
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			result.Err = fmt.Errorf("STARTTLS handshake failed: %v", err)
+			return result
+		}
+		result.StartTLS = true
+		recordSMTPTLS(&result, tlsConn.ConnectionState(), opts)
+
+		// The session restarts after STARTTLS, so the extensions must be requested again
+		text = textproto.NewConn(tlsConn)
+		if result.TLSExtensions, err = smtpHello(text, heloName); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	if opts.RelayTest {
+		result.OpenRelay = smtpRelayTest(text, opts)
+	}
+
+	smtpCmd(text, 221, "QUIT")
+	return result
+}
+
+// smtpHello sends EHLO and returns the advertised extensions
+func smtpHello(text *textproto.Conn, heloName string) ([]string, error) {
+	_, msg, err := smtpCmd(text, 250, "EHLO %s", heloName)
+	if err != nil {
+		return nil, fmt.Errorf("EHLO rejected: %v", err)
+	}
+	lines := strings.Split(msg, "\n")
+	if len(lines) < 2 {
+		return nil, nil
+	}
+	return lines[1:], nil
+}
+
+// smtpCmd sends a command and reads its reply, checking it against the expected code
+func smtpCmd(text *textproto.Conn, expectCode int, format string, args ...interface{}) (int, string, error) {
+	id, err := text.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	text.StartResponse(id)
+	defer text.EndResponse(id)
+	return text.ReadResponse(expectCode)
+}
+
+func hasSMTPExtension(extensions []string, name string) bool {
+	for _, ext := range extensions {
+		fields := strings.Fields(ext)
+		if len(fields) > 0 && strings.EqualFold(fields[0], name) {
+			return true
+		}
+	}
+	return false
+}
+
+// smtpRelayTest tries to relay between two external addresses and resets the transaction without sending data
+func smtpRelayTest(text *textproto.Conn, opts SMTPCheckOptions) string {
+	sender := opts.RelaySender
+	if sender == "" {
+		sender = "relay-test@example.org"
+	}
+	recipient := opts.RelayRecipient
+	if recipient == "" {
+		recipient = "relay-test@example.net"
+	}
+
+	defer smtpCmd(text, 250, "RSET")
+
+	if _, msg, err := smtpCmd(text, 250, "MAIL FROM:<%s>", sender); err != nil {
+		return fmt.Sprintf("Not tested (MAIL FROM rejected: %s)", firstLine(msg, err))
+	}
+	code, msg, err := smtpCmd(text, 25, "RCPT TO:<%s>", recipient)
+	if err == nil {
+		return color.RedString("Open relay (RCPT TO %s accepted with %d)", recipient, code)
+	}
+	return color.GreenString("Relay denied (%s)", firstLine(msg, err))
+}
+
+func firstLine(msg string, err error) string {
+	if msg == "" && err != nil {
+		msg = err.Error()
+	}
+	return strings.SplitN(msg, "\n", 2)[0]
+}
+
+// recordSMTPTLS stores the negotiated TLS parameters and verifies the certificate against the MX name
+func recordSMTPTLS(result *SMTPCheckResult, state tls.ConnectionState, opts SMTPCheckOptions) {
+	result.TLSVersion = tls.VersionName(state.Version)
+	result.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+	if len(state.PeerCertificates) == 0 {
+		return
+	}
+
+	report := VerifyCertificateChain(state.PeerCertificates, result.Host)
+	result.Certificate = state.PeerCertificates[0]
+	result.HostnameErr = report.HostnameErr
+	result.ChainErr = report.VerifyErr
+
+	if !opts.SkipDANE {
+		result.DANE = checkDANE(result.Host, result.Port, state.PeerCertificates)
+	}
+}
+
+// checkDANE looks up the TLSA records for the service and matches them against the presented chain
+func checkDANE(host string, port int, chain []*x509.Certificate) string {
+	config, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil {
+		return fmt.Sprintf("error reading resolv.conf: %v", err)
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(fmt.Sprintf("_%d._tcp.%s", port, host)), dns.TypeTLSA)
+	m.SetEdns0(4096, true)
+	m.RecursionDesired = true
+
+	c := dns.Client{Timeout: 5 * time.Second}
+	r, _, err := c.Exchange(m, net.JoinHostPort(config.Servers[0], config.Port))
+	if err != nil {
+		return fmt.Sprintf("error querying TLSA records: %v", err)
+	}
+
+	var records []*dns.TLSA
+	for _, answer := range r.Answer {
+		if tlsa, ok := answer.(*dns.TLSA); ok {
+			records = append(records, tlsa)
+		}
+	}
+	if len(records) == 0 {
+		return "No TLSA records"
+	}
+
+	authenticated := "DNSSEC unauthenticated"
+	if r.AuthenticatedData {
+		authenticated = "DNSSEC authenticated"
+	}
+
+	for _, record := range records {
+		candidates := chain
+		// DANE-EE and PKIX-EE records pin the leaf, the trust anchor usages may match any certificate in the chain
+		if record.Usage == 1 || record.Usage == 3 {
+			candidates = chain[:1]
+		}
+		for _, cert := range candidates {
+			if record.Verify(cert) == nil {
+				return color.GreenString("TLSA match (usage %d, selector %d, matching type %d, %s)", record.Usage, record.Selector, record.MatchingType, authenticated)
+			}
+		}
+	}
+	return color.RedString("%d TLSA record(s) found but none match the certificate (%s)", len(records), authenticated)
+}
+
+func formatSMTPResult(result SMTPCheckResult) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s %d\n", color.New(color.FgYellow, color.Bold).Sprint("  Port:"), result.Port))
+	if result.Err != nil && result.Banner == "" && result.TLSVersion == "" {
+		sb.WriteString(fmt.Sprintf("    %s\n", color.RedString("error: %v", result.Err)))
+		return sb.String()
+	}
+
+	sb.WriteString(fmt.Sprintf("    %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Banner:"), strings.ReplaceAll(result.Banner, "\n", " ")))
+	if len(result.Extensions) > 0 {
+		sb.WriteString(fmt.Sprintf("    %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Extensions:"), strings.Join(result.Extensions, ", ")))
+	}
+	if len(result.TLSExtensions) > 0 {
+		sb.WriteString(fmt.Sprintf("    %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Extensions (after STARTTLS):"), strings.Join(result.TLSExtensions, ", ")))
+	}
+
+	switch {
+	case result.ImplicitTLS:
+		sb.WriteString(fmt.Sprintf("    %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("TLS:"), "Implicit TLS"))
+	case result.StartTLS:
+		sb.WriteString(fmt.Sprintf("    %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("TLS:"), "STARTTLS"))
+	default:
+		sb.WriteString(fmt.Sprintf("    %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("TLS:"), color.RedString("Not offered")))
+	}
+
+	if result.TLSVersion != "" {
+		sb.WriteString(fmt.Sprintf("    %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Protocol:"), result.TLSVersion))
+		sb.WriteString(fmt.Sprintf("    %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Cipher:"), result.CipherSuite))
+	}
+	if result.Certificate != nil {
+		for _, line := range strings.Split(strings.TrimSpace(formatCertificateInfo(result.Certificate)), "\n") {
+			sb.WriteString("    " + line + "\n")
+		}
+		if result.HostnameErr != nil {
+			sb.WriteString(fmt.Sprintf("    %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Hostname Match:"), color.RedString("No (%v)", result.HostnameErr)))
+		} else {
+			sb.WriteString(fmt.Sprintf("    %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Hostname Match:"), color.GreenString("Yes")))
+		}
+		if result.ChainErr != nil {
+			sb.WriteString(fmt.Sprintf("    %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Chain:"), color.RedString("Invalid (%v)", result.ChainErr)))
+		} else {
+			sb.WriteString(fmt.Sprintf("    %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Chain:"), color.GreenString("Valid")))
+		}
+	}
+	if result.DANE != "" {
+		sb.WriteString(fmt.Sprintf("    %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("DANE:"), result.DANE))
+	}
+	if result.OpenRelay != "" {
+		sb.WriteString(fmt.Sprintf("    %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Open Relay:"), result.OpenRelay))
+	}
+	if result.Err != nil {
+		sb.WriteString(fmt.Sprintf("    %s\n", color.RedString("error: %v", result.Err)))
+	}
+	return sb.String()
+}
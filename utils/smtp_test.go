@@ -0,0 +1,252 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const standInHost = "mx.example.test"
+
+// smtpStandIn is a scripted mail server that records the commands it receives
+type smtpStandIn struct {
+	cert        tls.Certificate
+	implicitTLS bool
+	startTLS    bool
+	mailCode    int // reply to MAIL FROM
+	rcptCode    int // reply to RCPT TO
+	commands    []string
+}
+
+func newStandInCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: standInHost},
+		DNSNames:     []string{standInHost},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// serve answers one SMTP session on conn until QUIT or a read error
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{s.cert}}
+	secure := false
+	if s.implicitTLS {
+		conn = tls.Server(conn, tlsConfig)
+		secure = true
+	}
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 %s ESMTP stand-in", standInHost)
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		s.commands = append(s.commands, line)
+		verb := strings.ToUpper(strings.Fields(line + " ")[0])
+		switch verb {
+		case "EHLO":
+			text.PrintfLine("250-%s greets you", standInHost)
+			text.PrintfLine("250-PIPELINING")
+			text.PrintfLine("250-SIZE 35882577")
+			if secure {
+				text.PrintfLine("250-AUTH PLAIN LOGIN")
+			} else if s.startTLS {
+				text.PrintfLine("250-STARTTLS")
+			}
+			text.PrintfLine("250 8BITMIME")
+		case "STARTTLS":
+			text.PrintfLine("220 2.0.0 Ready to start TLS")
+			tlsConn := tls.Server(conn, tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			text = textproto.NewConn(tlsConn)
+			secure = true
+		case "MAIL":
+			text.PrintfLine("%d sender", s.mailCode)
+		case "RCPT":
+			text.PrintfLine("%d recipient", s.rcptCode)
+		case "RSET":
+			text.PrintfLine("250 2.0.0 Ok")
+		case "QUIT":
+			text.PrintfLine("221 2.0.0 Bye")
+			return
+		default:
+			text.PrintfLine("502 5.5.2 Error: command not recognized")
+		}
+	}
+}
+
+// inspectStandIn runs InspectSMTPConn against the stand-in and returns the result once the server is done
+func inspectStandIn(t *testing.T, server *smtpStandIn, port int, opts SMTPCheckOptions) SMTPCheckResult {
+	t.Helper()
+	server.cert = newStandInCertificate(t)
+	client, serverConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.serve(serverConn)
+	}()
+
+	opts.SkipDANE = true
+	opts.Timeout = 5 * time.Second
+	result := InspectSMTPConn(client, standInHost, port, opts)
+	client.Close()
+	<-done
+	return result
+}
+
+// verbs returns the command names without their arguments
+func verbs(commands []string) []string {
+	var names []string
+	for _, command := range commands {
+		names = append(names, strings.Fields(command)[0])
+	}
+	return names
+}
+
+func TestInspectSMTPStartTLS(t *testing.T) {
+	server := &smtpStandIn{startTLS: true, mailCode: 250, rcptCode: 554}
+	result := inspectStandIn(t, server, 25, SMTPCheckOptions{HeloName: "scanner.example.org"})
+
+	if result.Err != nil {
+		t.Fatalf("unexpected error: %v", result.Err)
+	}
+	if result.Banner != standInHost+" ESMTP stand-in" {
+		t.Errorf("banner %q", result.Banner)
+	}
+	if want := []string{"PIPELINING", "SIZE 35882577", "STARTTLS", "8BITMIME"}; !reflect.DeepEqual(result.Extensions, want) {
+		t.Errorf("extensions %q, want %q", result.Extensions, want)
+	}
+	if !result.StartTLS || result.ImplicitTLS {
+		t.Errorf("StartTLS=%v ImplicitTLS=%v, want an upgraded plaintext session", result.StartTLS, result.ImplicitTLS)
+	}
+	if result.TLSVersion != "TLS 1.3" || result.CipherSuite == "" {
+		t.Errorf("TLS %q with %q", result.TLSVersion, result.CipherSuite)
+	}
+	if want := []string{"PIPELINING", "SIZE 35882577", "AUTH PLAIN LOGIN", "8BITMIME"}; !reflect.DeepEqual(result.TLSExtensions, want) {
+		t.Errorf("extensions after STARTTLS %q, want %q", result.TLSExtensions, want)
+	}
+	if result.Certificate == nil || result.Certificate.Subject.CommonName != standInHost {
+		t.Fatalf("certificate %v", result.Certificate)
+	}
+	if result.HostnameErr != nil {
+		t.Errorf("hostname error for a matching certificate: %v", result.HostnameErr)
+	}
+	if result.ChainErr == nil {
+		t.Error("self-signed certificate verified")
+	}
+	if result.OpenRelay != "" {
+		t.Errorf("relay test ran without RelayTest: %q", result.OpenRelay)
+	}
+	if want := []string{"EHLO scanner.example.org", "STARTTLS", "EHLO scanner.example.org", "QUIT"}; !reflect.DeepEqual(server.commands, want) {
+		t.Errorf("commands %q, want %q", server.commands, want)
+	}
+}
+
+func TestInspectSMTPWithoutStartTLS(t *testing.T) {
+	server := &smtpStandIn{mailCode: 250, rcptCode: 554}
+	result := inspectStandIn(t, server, 587, SMTPCheckOptions{})
+
+	if result.Err != nil {
+		t.Fatalf("unexpected error: %v", result.Err)
+	}
+	if result.StartTLS || result.TLSVersion != "" || result.TLSExtensions != nil || result.Certificate != nil {
+		t.Errorf("TLS recorded for a plaintext-only server: %+v", result)
+	}
+	if want := []string{"EHLO dominfo.local", "QUIT"}; !reflect.DeepEqual(server.commands, want) {
+		t.Errorf("commands %q, want %q", server.commands, want)
+	}
+}
+
+func TestInspectSMTPImplicitTLS(t *testing.T) {
+	server := &smtpStandIn{implicitTLS: true, mailCode: 250, rcptCode: 554}
+	result := inspectStandIn(t, server, 465, SMTPCheckOptions{})
+
+	if result.Err != nil {
+		t.Fatalf("unexpected error: %v", result.Err)
+	}
+	if !result.ImplicitTLS || result.StartTLS {
+		t.Errorf("ImplicitTLS=%v StartTLS=%v, want SMTPS", result.ImplicitTLS, result.StartTLS)
+	}
+	if result.Certificate == nil || !hasSMTPExtension(result.Extensions, "AUTH") {
+		t.Errorf("certificate %v, extensions %q", result.Certificate, result.Extensions)
+	}
+	if want := []string{"EHLO", "QUIT"}; !reflect.DeepEqual(verbs(server.commands), want) {
+		t.Errorf("commands %q, want %q", server.commands, want)
+	}
+}
+
+func TestInspectSMTPRelayTest(t *testing.T) {
+	tests := []struct {
+		name     string
+		mailCode int
+		rcptCode int
+		want     string
+		commands []string
+	}{
+		{"denied", 250, 554, "Relay denied (recipient)", []string{"EHLO", "STARTTLS", "EHLO", "MAIL", "RCPT", "RSET", "QUIT"}},
+		{"open", 250, 250, "Open relay (RCPT TO relay-test@example.net accepted with 250)", []string{"EHLO", "STARTTLS", "EHLO", "MAIL", "RCPT", "RSET", "QUIT"}},
+		{"sender rejected", 553, 250, "Not tested (MAIL FROM rejected: sender)", []string{"EHLO", "STARTTLS", "EHLO", "MAIL", "RSET", "QUIT"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &smtpStandIn{startTLS: true, mailCode: tt.mailCode, rcptCode: tt.rcptCode}
+			result := inspectStandIn(t, server, 25, SMTPCheckOptions{RelayTest: true})
+
+			if result.Err != nil {
+				t.Fatalf("unexpected error: %v", result.Err)
+			}
+			if !strings.Contains(result.OpenRelay, tt.want) {
+				t.Errorf("relay result %q, want %q", result.OpenRelay, tt.want)
+			}
+			// The transaction is always reset so that nothing is ever delivered
+			if got := verbs(server.commands); !reflect.DeepEqual(got, tt.commands) {
+				t.Errorf("commands %q, want %q", got, tt.commands)
+			}
+			if !strings.Contains(strings.Join(server.commands, "\n"), "MAIL FROM:<relay-test@example.org>") {
+				t.Errorf("default relay sender not used: %q", server.commands)
+			}
+		})
+	}
+}
+
+func TestInspectSMTPBadGreeting(t *testing.T) {
+	client, serverConn := net.Pipe()
+	go func() {
+		defer serverConn.Close()
+		textproto.NewConn(serverConn).PrintfLine("554 %s no service", standInHost)
+	}()
+	result := InspectSMTPConn(client, standInHost, 25, SMTPCheckOptions{SkipDANE: true, Timeout: 5 * time.Second})
+	client.Close()
+
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "unexpected greeting") {
+		t.Fatalf("got error %v, want an unexpected greeting", result.Err)
+	}
+}
@@ -0,0 +1,520 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+// SSLLabsAPIURL is the default base URL of the SSL Labs v4 API
+const SSLLabsAPIURL = "https://api.ssllabs.com/api/v4"
+
+// SSLLabsEmail is the email registered with the SSL Labs v4 API, it is sent with every request
+var SSLLabsEmail = os.Getenv("SSLLABS_EMAIL")
+
+// SSLLabsReport represents the structure of the SSL Labs API response
+type SSLLabsReport struct {
+	Host            string     `json:"host"`
+	Port            int        `json:"port"`
+	Protocol        string     `json:"protocol"`
+	IsPublic        bool       `json:"isPublic"`
+	Status          string     `json:"status"`
+	StatusMessage   string     `json:"statusMessage"`
+	StartTime       int64      `json:"startTime"`
+	TestTime        int64      `json:"testTime"`
+	EngineVersion   string     `json:"engineVersion"`
+	CriteriaVersion string     `json:"criteriaVersion"`
+	CertHostnames   []string   `json:"certHostnames"`
+	Endpoints       []Endpoint `json:"endpoints"`
+}
+
+// Endpoint represents each endpoint in the SSL Labs report
+type Endpoint struct {
+	IPAddress         string           `json:"ipAddress"`
+	ServerName        string           `json:"serverName"`
+	StatusMessage     string           `json:"statusMessage"`
+	Grade             string           `json:"grade"`
+	GradeTrustIgnored string           `json:"gradeTrustIgnored"`
+	HasWarnings       bool             `json:"hasWarnings"`
+	IsExceptional     bool             `json:"isExceptional"`
+	Progress          int              `json:"progress"`
+	Details           *EndpointDetails `json:"details"`
+}
+
+// EndpointDetails holds the detailed assessment of an endpoint, returned with all=done
+type EndpointDetails struct {
+	Protocols               []SSLLabsProtocol       `json:"protocols"`
+	Suites                  []SSLLabsProtocolSuites `json:"suites"`
+	ServerSignature         string                  `json:"serverSignature"`
+	RenegSupport            int                     `json:"renegSupport"`
+	SessionResumption       int                     `json:"sessionResumption"`
+	CompressionMethods      int                     `json:"compressionMethods"`
+	SupportsALPN            bool                    `json:"supportsAlpn"`
+	ALPNProtocols           string                  `json:"alpnProtocols"`
+	SessionTickets          int                     `json:"sessionTickets"`
+	OCSPStapling            bool                    `json:"ocspStapling"`
+	SNIRequired             bool                    `json:"sniRequired"`
+	SupportsRC4             bool                    `json:"supportsRc4"`
+	ForwardSecrecy          int                     `json:"forwardSecrecy"`
+	VulnBeast               bool                    `json:"vulnBeast"`
+	Heartbleed              bool                    `json:"heartbleed"`
+	Heartbeat               bool                    `json:"heartbeat"`
+	OpenSSLCCS              int                     `json:"openSslCcs"`
+	OpenSSLLuckyMinus20     int                     `json:"openSSLLuckyMinus20"`
+	Ticketbleed             int                     `json:"ticketbleed"`
+	Bleichenbacher          int                     `json:"bleichenbacher"`
+	ZombiePoodle            int                     `json:"zombiePoodle"`
+	GoldenDoodle            int                     `json:"goldenDoodle"`
+	ZeroLengthPaddingOracle int                     `json:"zeroLengthPaddingOracle"`
+	SleepingPoodle          int                     `json:"sleepingPoodle"`
+	Poodle                  bool                    `json:"poodle"`
+	PoodleTLS               int                     `json:"poodleTls"`
+	FallbackSCSV            bool                    `json:"fallbackScsv"`
+	Freak                   bool                    `json:"freak"`
+	Logjam                  bool                    `json:"logjam"`
+	DrownVulnerable         bool                    `json:"drownVulnerable"`
+	HasSCT                  int                     `json:"hasSct"`
+	HSTSPolicy              *SSLLabsHSTSPolicy      `json:"hstsPolicy"`
+}
+
+// SSLLabsProtocol is a protocol version supported by an endpoint
+type SSLLabsProtocol struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// SSLLabsProtocolSuites lists the cipher suites accepted for one protocol version
+type SSLLabsProtocolSuites struct {
+	Protocol   int            `json:"protocol"`
+	List       []SSLLabsSuite `json:"list"`
+	Preference bool           `json:"preference"`
+}
+
+// SSLLabsSuite is a single accepted cipher suite
+type SSLLabsSuite struct {
+	ID             int    `json:"id"`
+	Name           string `json:"name"`
+	CipherStrength int    `json:"cipherStrength"`
+	KxType         string `json:"kxType"`
+	KxStrength     int    `json:"kxStrength"`
+	NamedGroupName string `json:"namedGroupName"`
+	Q              *int   `json:"q"`
+}
+
+// SSLLabsHSTSPolicy is the HSTS policy observed by SSL Labs
+type SSLLabsHSTSPolicy struct {
+	Status            string `json:"status"`
+	MaxAge            int64  `json:"maxAge"`
+	IncludeSubDomains bool   `json:"includeSubDomains"`
+	Preload           bool   `json:"preload"`
+}
+
+// sslLabsErrors is the body returned with invocation errors
+type sslLabsErrors struct {
+	Errors []struct {
+		Field   string `json:"field"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// SSLLabsClient talks to the SSL Labs v4 API
+type SSLLabsClient struct {
+	BaseURL    string        // API base URL, can point to a local fake
+	Email      string        // registered email
+	HTTPClient *http.Client  // client used for all requests
+	StartNew   bool          // force a new assessment instead of using results cached by SSL Labs
+	FromCache  bool          // accept results cached by SSL Labs
+	MaxAge     int           // maximum age in hours of cached results, 0 uses the API default
+	CacheDir   string        // local directory for READY reports, empty disables the local cache
+	MaxWait    time.Duration // upper bound for the whole assessment
+	// PollInterval is used while an assessment is IN_PROGRESS, DNSPollInterval while it is still resolving
+	PollInterval    time.Duration
+	DNSPollInterval time.Duration
+	// Backoff is the first wait after a 429 or 529 without Retry-After, it doubles on every further one
+	Backoff time.Duration
+}
+
+// NewSSLLabsClient returns a client with the polling policy recommended by the API documentation
+func NewSSLLabsClient(email string) *SSLLabsClient {
+	return &SSLLabsClient{
+		BaseURL:         SSLLabsAPIURL,
+		Email:           email,
+		HTTPClient:      &http.Client{Timeout: 30 * time.Second},
+		FromCache:       true,
+		MaxAge:          24,
+		CacheDir:        "cache",
+		MaxWait:         10 * time.Minute,
+		PollInterval:    10 * time.Second,
+		DNSPollInterval: 5 * time.Second,
+		Backoff:         30 * time.Second,
+	}
+}
+
+// GetSSLLabsReport fetches the SSL Labs report for a given domain
+func GetSSLLabsReport(domain string) (string, error) {
+	report, err := NewSSLLabsClient(SSLLabsEmail).Analyze(domain)
+	if err != nil {
+		return "", err
+	}
+	return formatSSLLabsReport(*report), nil
+}
+
+// Register registers an email with the v4 API, which is required before running assessments
+func (c *SSLLabsClient) Register(firstName, lastName, email, organization string) error {
+	body, err := json.Marshal(map[string]string{
+		"firstName":    firstName,
+		"lastName":     lastName,
+		"email":        email,
+		"organization": organization,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.HTTPClient.Post(strings.TrimSuffix(c.BaseURL, "/")+"/register", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to register with SSL Labs: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("SSL Labs registration failed: %s", readSSLLabsError(resp))
+	}
+	return nil
+}
+
+// Analyze runs or fetches an assessment and polls until it is READY
+func (c *SSLLabsClient) Analyze(host string) (*SSLLabsReport, error) {
+	if c.Email == "" {
+		return nil, fmt.Errorf("SSL Labs API v4 requires a registered email, set --ssllabs-email or SSLLABS_EMAIL")
+	}
+
+	if !c.StartNew {
+		if report := c.loadCachedReport(host); report != nil {
+			return report, nil
+		}
+	}
+
+	deadline := time.Now().Add(c.MaxWait)
+	backoff := c.Backoff
+	if backoff <= 0 {
+		backoff = 30 * time.Second
+	}
+	first := true
+
+	for {
+		params := url.Values{"host": {host}, "all": {"done"}}
+		// startNew must only be sent once, repeating it would restart the assessment on every poll
+		if first {
+			if c.StartNew {
+				params.Set("startNew", "on")
+			} else if c.FromCache {
+				params.Set("fromCache", "on")
+				if c.MaxAge > 0 {
+					params.Set("maxAge", strconv.Itoa(c.MaxAge))
+				}
+			}
+		}
+
+		report, wait, err := c.analyzeOnce(params)
+		if err != nil {
+			return nil, err
+		}
+
+		var delay time.Duration
+		switch {
+		case report == nil:
+			// Rate limited or overloaded, back off exponentially unless the server says otherwise
+			delay = wait
+			if delay == 0 {
+				delay = backoff
+				backoff *= 2
+			}
+		case report.Status == "READY":
+			c.storeCachedReport(host, report)
+			return report, nil
+		case report.Status == "ERROR":
+			return nil, fmt.Errorf("SSL Labs report returned error for domain %s: %s", host, report.StatusMessage)
+		case report.Status == "IN_PROGRESS":
+			first = false
+			delay = c.PollInterval
+		default:
+			first = false
+			delay = c.DNSPollInterval
+		}
+
+		if time.Now().Add(delay).After(deadline) {
+			return nil, fmt.Errorf("SSL Labs report timed out for domain: %s", host)
+		}
+		time.Sleep(delay)
+	}
+}
+
+// analyzeOnce performs a single analyze call, returning a nil report and a wait hint when the API asks to back off
+func (c *SSLLabsClient) analyzeOnce(params url.Values) (*SSLLabsReport, time.Duration, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(c.BaseURL, "/")+"/analyze?"+params.Encode(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("email", c.Email)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch SSL Labs report: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusTooManyRequests:
+		io.Copy(io.Discard, resp.Body)
+		if wait := retryAfter(resp); wait > 0 {
+			return nil, wait, nil
+		}
+		// All assessment slots are in use, wait with the exponential backoff for one to free up
+		maxAssessments, _ := strconv.Atoi(resp.Header.Get("X-Max-Assessments"))
+		currentAssessments, _ := strconv.Atoi(resp.Header.Get("X-Current-Assessments"))
+		if maxAssessments > 0 && currentAssessments >= maxAssessments {
+			return nil, 0, nil
+		}
+		// Otherwise requests came in too fast, a short cool-off is enough
+		return nil, c.DNSPollInterval, nil
+	case http.StatusServiceUnavailable, 529:
+		io.Copy(io.Discard, resp.Body)
+		return nil, retryAfter(resp), nil
+	default:
+		return nil, 0, fmt.Errorf("SSL Labs API returned %d: %s", resp.StatusCode, readSSLLabsError(resp))
+	}
+
+	var report SSLLabsReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode SSL Labs report: %v", err)
+	}
+	return &report, 0, nil
+}
+
+// retryAfter reads the Retry-After header in seconds, if present
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func readSSLLabsError(resp *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var apiErrors sslLabsErrors
+	if json.Unmarshal(body, &apiErrors) == nil && len(apiErrors.Errors) > 0 {
+		var messages []string
+		for _, e := range apiErrors.Errors {
+			messages = append(messages, strings.TrimSpace(e.Field+" "+e.Message))
+		}
+		return strings.Join(messages, "; ")
+	}
+	return strings.TrimSpace(string(body))
+}
+
+func (c *SSLLabsClient) cachePath(host string) string {
+	return filepath.Join(c.CacheDir, "ssllabs-"+strings.ReplaceAll(host, string(filepath.Separator), "_")+".json")
+}
+
+// loadCachedReport returns a locally cached READY report that is younger than MaxAge
+func (c *SSLLabsClient) loadCachedReport(host string) *SSLLabsReport {
+	if c.CacheDir == "" || !c.FromCache {
+		return nil
+	}
+	data, err := os.ReadFile(c.cachePath(host))
+	if err != nil {
+		return nil
+	}
+	var report SSLLabsReport
+	if json.Unmarshal(data, &report) != nil || report.Status != "READY" {
+		return nil
+	}
+	maxAge := time.Duration(c.MaxAge) * time.Hour
+	if maxAge > 0 && time.Since(time.UnixMilli(report.TestTime)) > maxAge {
+		return nil
+	}
+	return &report
+}
+
+func (c *SSLLabsClient) storeCachedReport(host string, report *SSLLabsReport) {
+	if c.CacheDir == "" {
+		return
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return
+	}
+	if os.MkdirAll(c.CacheDir, 0o755) == nil {
+		os.WriteFile(c.cachePath(host), data, 0o644)
+	}
+}
+
+func formatSSLLabsReport(report SSLLabsReport) string {
+	sslLabsInfo := fmt.Sprintf("%s\n%s %s\n%s %d\n%s %s\n%s %s\n",
+		color.New(color.FgYellow, color.Bold).Sprint("\nSSL Labs Information:"),
+		color.New(color.FgYellow, color.Bold).Sprint("Host:"),
+		report.Host,
+		color.New(color.FgYellow, color.Bold).Sprint("Port:"),
+		report.Port,
+		color.New(color.FgYellow, color.Bold).Sprint("Protocol:"),
+		report.Protocol,
+		color.New(color.FgYellow, color.Bold).Sprint("Tested:"),
+		time.UnixMilli(report.TestTime).UTC().Format(time.RFC3339))
+
+	if len(report.Endpoints) == 0 {
+		return sslLabsInfo + "No endpoints assessed\n"
+	}
+
+	sslLabsInfo += color.New(color.FgYellow, color.Bold).Sprint("Endpoint Information:\n")
+	for _, endpoint := range report.Endpoints {
+		grade := endpoint.Grade
+		if grade == "" {
+			grade = "N/A"
+		}
+		if endpoint.GradeTrustIgnored != "" && endpoint.GradeTrustIgnored != endpoint.Grade {
+			grade += fmt.Sprintf(" (%s if trust issues are ignored)", endpoint.GradeTrustIgnored)
+		}
+		sslLabsInfo += fmt.Sprintf("\n%s %s\n%s %s\n%s %s\n%s %s\n",
+			color.New(color.FgYellow, color.Bold).Sprint("IP Address:"),
+			endpoint.IPAddress,
+			color.New(color.FgYellow, color.Bold).Sprint("Server Name:"),
+			endpoint.ServerName,
+			color.New(color.FgYellow, color.Bold).Sprint("Status Message:"),
+			endpoint.StatusMessage,
+			color.New(color.FgYellow, color.Bold).Sprint("Grade:"),
+			grade)
+		if endpoint.Details != nil {
+			sslLabsInfo += formatEndpointDetails(endpoint.Details)
+		}
+	}
+
+	return sslLabsInfo
+}
+
+func formatEndpointDetails(details *EndpointDetails) string {
+	var sb strings.Builder
+
+	var protocols []string
+	for _, protocol := range details.Protocols {
+		protocols = append(protocols, protocol.Name+" "+protocol.Version)
+	}
+	sb.WriteString(fmt.Sprintf("%s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Protocols:"), strings.Join(protocols, ", ")))
+
+	for _, suites := range details.Suites {
+		preference := "client order"
+		if suites.Preference {
+			preference = "server preference"
+		}
+		sb.WriteString(color.New(color.FgYellow, color.Bold).Sprintf("Cipher Suites (%s, %s):\n", sslLabsProtocolName(details.Protocols, suites.Protocol), preference))
+		for _, suite := range suites.List {
+			kx := suite.KxType
+			if suite.NamedGroupName != "" {
+				kx += " " + suite.NamedGroupName
+			}
+			weak := ""
+			if suite.Q != nil && *suite.Q == 0 {
+				weak = color.RedString(" (weak)")
+			}
+			sb.WriteString(fmt.Sprintf("  %s %d bits, %s%s\n", suite.Name, suite.CipherStrength, kx, weak))
+		}
+	}
+
+	table := tablewriter.NewWriter(&sb)
+	table.SetHeader([]string{"Check", "Result"})
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	table.Append([]string{"Heartbleed", sslLabsBool(details.Heartbleed)})
+	table.Append([]string{"OpenSSL CCS Injection", sslLabsTriState(details.OpenSSLCCS, map[int]string{1: "Not vulnerable", 2: "Possibly vulnerable, not exploitable", 3: "Vulnerable"})})
+	table.Append([]string{"ROBOT", sslLabsTriState(details.Bleichenbacher, map[int]string{1: "Not vulnerable", 2: "Vulnerable (weak oracle)", 3: "Vulnerable (strong oracle)", 4: "Inconsistent results"})})
+	table.Append([]string{"Ticketbleed", sslLabsTriState(details.Ticketbleed, map[int]string{1: "Not vulnerable", 2: "Vulnerable", 3: "Not vulnerable, similar bug present"})})
+	table.Append([]string{"OpenSSL Padding Oracle", sslLabsTriState(details.OpenSSLLuckyMinus20, map[int]string{1: "Not vulnerable", 2: "Vulnerable"})})
+	table.Append([]string{"Zombie POODLE", sslLabsTriState(details.ZombiePoodle, paddingOracleStates)})
+	table.Append([]string{"GOLDENDOODLE", sslLabsTriState(details.GoldenDoodle, paddingOracleStates)})
+	table.Append([]string{"0-Length Padding Oracle", sslLabsTriState(details.ZeroLengthPaddingOracle, paddingOracleStates)})
+	table.Append([]string{"Sleeping POODLE", sslLabsTriState(details.SleepingPoodle, paddingOracleStates)})
+	table.Append([]string{"POODLE (SSLv3)", sslLabsBool(details.Poodle)})
+	table.Append([]string{"POODLE (TLS)", sslLabsTriState(details.PoodleTLS, map[int]string{-3: "Timeout", -2: "TLS not supported", 1: "Not vulnerable", 2: "Vulnerable"})})
+	table.Append([]string{"BEAST", sslLabsBool(details.VulnBeast)})
+	table.Append([]string{"FREAK", sslLabsBool(details.Freak)})
+	table.Append([]string{"Logjam", sslLabsBool(details.Logjam)})
+	table.Append([]string{"DROWN", sslLabsBool(details.DrownVulnerable)})
+	table.Append([]string{"RC4", sslLabsBool(details.SupportsRC4)})
+	table.Append([]string{"TLS_FALLBACK_SCSV", yesNo(details.FallbackSCSV)})
+	table.Append([]string{"Forward Secrecy", forwardSecrecyName(details.ForwardSecrecy)})
+	table.Append([]string{"Secure Renegotiation", yesNo(details.RenegSupport&2 != 0)})
+	table.Append([]string{"Insecure Client Renegotiation", sslLabsBool(details.RenegSupport&1 != 0)})
+	table.Append([]string{"OCSP Stapling", yesNo(details.OCSPStapling)})
+	table.Append([]string{"ALPN", details.ALPNProtocols})
+	if details.HSTSPolicy != nil {
+		table.Append([]string{"HSTS", fmt.Sprintf("%s (max-age %d)", details.HSTSPolicy.Status, details.HSTSPolicy.MaxAge)})
+	}
+	table.Render()
+
+	return sb.String()
+}
+
+var paddingOracleStates = map[int]string{1: "Not vulnerable", 2: "Vulnerable", 3: "Vulnerable and exploitable"}
+
+// sslLabsBool renders a boolean vulnerability flag where true is bad
+func sslLabsBool(vulnerable bool) string {
+	if vulnerable {
+		return color.RedString("Vulnerable")
+	}
+	return color.GreenString("No")
+}
+
+// sslLabsTriState renders the numeric test results used by SSL Labs, where -1 means the test failed and 0 unknown
+func sslLabsTriState(value int, names map[int]string) string {
+	name, ok := names[value]
+	switch {
+	case value < 0 && ok:
+		return name
+	case value < 0:
+		return "Test failed"
+	case value == 0:
+		return "Unknown"
+	case !ok:
+		return strconv.Itoa(value)
+	case value == 1:
+		return color.GreenString(name)
+	default:
+		return color.RedString(name)
+	}
+}
+
+func forwardSecrecyName(value int) string {
+	switch {
+	case value&4 != 0:
+		return color.GreenString("With all simulated clients")
+	case value&2 != 0:
+		return color.GreenString("With modern clients")
+	case value&1 != 0:
+		return color.YellowString("With some clients")
+	default:
+		return color.RedString("No")
+	}
+}
+
+func sslLabsProtocolName(protocols []SSLLabsProtocol, id int) string {
+	for _, protocol := range protocols {
+		if protocol.ID == id {
+			return protocol.Name + " " + protocol.Version
+		}
+	}
+	return fmt.Sprintf("0x%04X", id)
+}
@@ -0,0 +1,311 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSSLLabsResponse is one answer of the fake API, either a status code with headers or a report
+type fakeSSLLabsResponse struct {
+	code    int
+	headers map[string]string
+	body    string
+	report  *SSLLabsReport
+}
+
+type fakeSSLLabsRequest struct {
+	query url.Values
+	email string
+	at    time.Time
+}
+
+// fakeSSLLabs serves the queued responses in order and records every analyze request
+type fakeSSLLabs struct {
+	mu        sync.Mutex
+	responses []fakeSSLLabsResponse
+	requests  []fakeSSLLabsRequest
+}
+
+func (f *fakeSSLLabs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path != "/analyze" {
+		http.NotFound(w, r)
+		return
+	}
+	f.requests = append(f.requests, fakeSSLLabsRequest{query: r.URL.Query(), email: r.Header.Get("email"), at: time.Now()})
+	if len(f.responses) == 0 {
+		http.Error(w, `{"errors":[{"field":"host","message":"unexpected request"}]}`, http.StatusBadRequest)
+		return
+	}
+	response := f.responses[0]
+	if len(f.responses) > 1 {
+		f.responses = f.responses[1:]
+	}
+	for key, value := range response.headers {
+		w.Header().Set(key, value)
+	}
+	if response.report != nil {
+		json.NewEncoder(w).Encode(response.report)
+		return
+	}
+	w.WriteHeader(response.code)
+	w.Write([]byte(response.body))
+}
+
+func (f *fakeSSLLabs) recorded() []fakeSSLLabsRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeSSLLabsRequest{}, f.requests...)
+}
+
+func newTestSSLLabsClient(t *testing.T, fake *fakeSSLLabs) *SSLLabsClient {
+	t.Helper()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	client := NewSSLLabsClient("test@example.com")
+	client.BaseURL = server.URL
+	client.HTTPClient = server.Client()
+	client.CacheDir = ""
+	client.MaxWait = 10 * time.Second
+	client.PollInterval = time.Millisecond
+	client.DNSPollInterval = time.Millisecond
+	client.Backoff = 50 * time.Millisecond
+	return client
+}
+
+func readyReport() *SSLLabsReport {
+	return &SSLLabsReport{
+		Host:      "example.com",
+		Port:      443,
+		Status:    "READY",
+		TestTime:  time.Now().UnixMilli(),
+		Endpoints: []Endpoint{{IPAddress: "192.0.2.1", Grade: "A+"}},
+	}
+}
+
+func TestSSLLabsPollsUntilReady(t *testing.T) {
+	fake := &fakeSSLLabs{responses: []fakeSSLLabsResponse{
+		{report: &SSLLabsReport{Status: "DNS"}},
+		{report: &SSLLabsReport{Status: "IN_PROGRESS"}},
+		{report: &SSLLabsReport{Status: "IN_PROGRESS"}},
+		{report: readyReport()},
+	}}
+	client := newTestSSLLabsClient(t, fake)
+
+	report, err := client.Analyze("example.com")
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if report.Status != "READY" || len(report.Endpoints) != 1 || report.Endpoints[0].Grade != "A+" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	requests := fake.recorded()
+	if len(requests) != 4 {
+		t.Fatalf("got %d requests, want 4", len(requests))
+	}
+	for i, request := range requests {
+		if request.email != "test@example.com" {
+			t.Errorf("request %d: email header %q", i, request.email)
+		}
+		if request.query.Get("host") != "example.com" || request.query.Get("all") != "done" {
+			t.Errorf("request %d: query %v", i, request.query)
+		}
+		if request.query.Has("startNew") {
+			t.Errorf("request %d: startNew sent without StartNew", i)
+		}
+	}
+}
+
+func TestSSLLabsFromCacheOnlyOnFirstRequest(t *testing.T) {
+	fake := &fakeSSLLabs{responses: []fakeSSLLabsResponse{
+		{report: &SSLLabsReport{Status: "IN_PROGRESS"}},
+		{report: readyReport()},
+	}}
+	client := newTestSSLLabsClient(t, fake)
+
+	if _, err := client.Analyze("example.com"); err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	requests := fake.recorded()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	if got := requests[0].query; got.Get("fromCache") != "on" || got.Get("maxAge") != "24" {
+		t.Errorf("first request: fromCache=%q maxAge=%q, want on and 24", got.Get("fromCache"), got.Get("maxAge"))
+	}
+	if got := requests[1].query; got.Has("fromCache") || got.Has("maxAge") {
+		t.Errorf("poll repeated the cache parameters: %v", got)
+	}
+}
+
+func TestSSLLabsStartNewOnlyOnFirstRequest(t *testing.T) {
+	fake := &fakeSSLLabs{responses: []fakeSSLLabsResponse{
+		{report: &SSLLabsReport{Status: "IN_PROGRESS"}},
+		{report: &SSLLabsReport{Status: "IN_PROGRESS"}},
+		{report: readyReport()},
+	}}
+	client := newTestSSLLabsClient(t, fake)
+	client.StartNew = true
+
+	if _, err := client.Analyze("example.com"); err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	requests := fake.recorded()
+	if requests[0].query.Get("startNew") != "on" || requests[0].query.Has("fromCache") {
+		t.Errorf("first request: %v, want startNew=on without fromCache", requests[0].query)
+	}
+	for i, request := range requests[1:] {
+		if request.query.Has("startNew") {
+			t.Errorf("poll %d restarted the assessment: %v", i+1, request.query)
+		}
+	}
+}
+
+func TestSSLLabsError(t *testing.T) {
+	fake := &fakeSSLLabs{responses: []fakeSSLLabsResponse{
+		{report: &SSLLabsReport{Status: "DNS"}},
+		{report: &SSLLabsReport{Status: "ERROR", StatusMessage: "Unable to resolve domain name"}},
+	}}
+	client := newTestSSLLabsClient(t, fake)
+
+	_, err := client.Analyze("example.com")
+	if err == nil || !strings.Contains(err.Error(), "Unable to resolve domain name") {
+		t.Fatalf("got error %v, want the status message", err)
+	}
+}
+
+func TestSSLLabsInvocationError(t *testing.T) {
+	fake := &fakeSSLLabs{responses: []fakeSSLLabsResponse{
+		{code: http.StatusBadRequest, body: `{"errors":[{"field":"host","message":"invalid hostname"}]}`},
+	}}
+	client := newTestSSLLabsClient(t, fake)
+
+	_, err := client.Analyze("example.com")
+	if err == nil || !strings.Contains(err.Error(), "host invalid hostname") {
+		t.Fatalf("got error %v, want the API error message", err)
+	}
+}
+
+func TestSSLLabsRequiresEmail(t *testing.T) {
+	client := newTestSSLLabsClient(t, &fakeSSLLabs{})
+	client.Email = ""
+	if _, err := client.Analyze("example.com"); err == nil {
+		t.Fatal("Analyze without an email succeeded")
+	}
+}
+
+func TestSSLLabsBackoff(t *testing.T) {
+	full := map[string]string{"X-Max-Assessments": "25", "X-Current-Assessments": "25"}
+	fake := &fakeSSLLabs{responses: []fakeSSLLabsResponse{
+		{code: http.StatusTooManyRequests, headers: full},
+		{code: 529},
+		{code: http.StatusServiceUnavailable},
+		{report: readyReport()},
+	}}
+	client := newTestSSLLabsClient(t, fake)
+
+	if _, err := client.Analyze("example.com"); err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	requests := fake.recorded()
+	if len(requests) != 4 {
+		t.Fatalf("got %d requests, want 4", len(requests))
+	}
+	// The wait doubles after every overload answer: 50ms, 100ms, 200ms
+	want := client.Backoff
+	for i := 1; i < len(requests); i++ {
+		if gap := requests[i].at.Sub(requests[i-1].at); gap < want {
+			t.Errorf("wait before request %d was %v, want at least %v", i, gap, want)
+		}
+		want *= 2
+	}
+}
+
+func TestSSLLabsTooFastCoolOff(t *testing.T) {
+	fake := &fakeSSLLabs{responses: []fakeSSLLabsResponse{
+		{code: http.StatusTooManyRequests, headers: map[string]string{"X-Max-Assessments": "25", "X-Current-Assessments": "3"}},
+		{report: readyReport()},
+	}}
+	client := newTestSSLLabsClient(t, fake)
+	client.Backoff = time.Hour
+
+	start := time.Now()
+	if _, err := client.Analyze("example.com"); err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("a 429 with free assessment slots waited %v, want the short cool-off", elapsed)
+	}
+}
+
+func TestSSLLabsRetryAfter(t *testing.T) {
+	for _, code := range []int{http.StatusTooManyRequests, 529} {
+		fake := &fakeSSLLabs{responses: []fakeSSLLabsResponse{
+			{code: code, headers: map[string]string{"Retry-After": "1"}},
+			{report: readyReport()},
+		}}
+		client := newTestSSLLabsClient(t, fake)
+		client.Backoff = time.Hour
+
+		if _, err := client.Analyze("example.com"); err != nil {
+			t.Fatalf("%d: Analyze: %v", code, err)
+		}
+		requests := fake.recorded()
+		if len(requests) != 2 {
+			t.Fatalf("%d: got %d requests, want 2", code, len(requests))
+		}
+		if gap := requests[1].at.Sub(requests[0].at); gap < time.Second || gap > 5*time.Second {
+			t.Errorf("%d: waited %v, want the Retry-After of 1s", code, gap)
+		}
+	}
+}
+
+func TestSSLLabsTimeout(t *testing.T) {
+	fake := &fakeSSLLabs{responses: []fakeSSLLabsResponse{{code: 529, headers: map[string]string{"Retry-After": "60"}}}}
+	client := newTestSSLLabsClient(t, fake)
+	client.MaxWait = time.Second
+
+	_, err := client.Analyze("example.com")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("got error %v, want a timeout", err)
+	}
+}
+
+func TestSSLLabsLocalCache(t *testing.T) {
+	fake := &fakeSSLLabs{responses: []fakeSSLLabsResponse{{report: readyReport()}}}
+	client := newTestSSLLabsClient(t, fake)
+	client.CacheDir = t.TempDir()
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Analyze("example.com"); err != nil {
+			t.Fatalf("Analyze %d: %v", i, err)
+		}
+	}
+	if got := len(fake.recorded()); got != 1 {
+		t.Fatalf("got %d requests, want the second report from the local cache", got)
+	}
+
+	// Reports older than MaxAge and runs with StartNew go to the API again
+	client.MaxAge = 1
+	stale := readyReport()
+	stale.TestTime = time.Now().Add(-2 * time.Hour).UnixMilli()
+	client.storeCachedReport("example.com", stale)
+	if _, err := client.Analyze("example.com"); err != nil {
+		t.Fatalf("Analyze with a stale cache: %v", err)
+	}
+	client.StartNew = true
+	if _, err := client.Analyze("example.com"); err != nil {
+		t.Fatalf("Analyze with StartNew: %v", err)
+	}
+	if got := len(fake.recorded()); got != 3 {
+		t.Fatalf("got %d requests, want 3", got)
+	}
+}
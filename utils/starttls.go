@@ -0,0 +1,465 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// STARTTLS dialects understood by TLSTarget
+const (
+	StartTLSSMTP       = "smtp"
+	StartTLSIMAP       = "imap"
+	StartTLSPOP3       = "pop3"
+	StartTLSFTP        = "ftp"
+	StartTLSLDAP       = "ldap"
+	StartTLSPostgreSQL = "postgres"
+	StartTLSXMPP       = "xmpp"
+	StartTLSXMPPServer = "xmpp-server"
+)
+
+// startTLSPorts maps well-known plaintext ports to the STARTTLS dialect they speak
+var startTLSPorts = map[int]string{
+	21:   StartTLSFTP,
+	25:   StartTLSSMTP,
+	110:  StartTLSPOP3,
+	143:  StartTLSIMAP,
+	389:  StartTLSLDAP,
+	587:  StartTLSSMTP,
+	5222: StartTLSXMPP,
+	5269: StartTLSXMPPServer,
+	5432: StartTLSPostgreSQL,
+}
+
+// implicitTLSPorts are ports where the TLS handshake starts right after connecting
+var implicitTLSPorts = map[int]bool{
+	443: true, 465: true, 636: true, 853: true, 990: true, 993: true, 995: true,
+	5223: true, 5986: true, 6697: true, 8443: true, 9443: true,
+}
+
+// TLSTarget describes a TLS service, StartTLS names the plaintext dialect to upgrade from or is empty for implicit TLS
+type TLSTarget struct {
+	Host       string
+	Port       string
+	ServerName string
+	StartTLS   string
+}
+
+// NewTLSTarget returns a target for a host and port, choosing STARTTLS for well-known plaintext ports
+func NewTLSTarget(host string, port int) TLSTarget {
+	return TLSTarget{Host: host, Port: strconv.Itoa(port), ServerName: host, StartTLS: startTLSPorts[port]}
+}
+
+// Address returns the host:port to connect to
+func (t TLSTarget) Address() string {
+	return net.JoinHostPort(t.Host, t.Port)
+}
+
+func (t TLSTarget) String() string {
+	if t.StartTLS != "" {
+		return fmt.Sprintf("%s (STARTTLS %s)", t.Address(), t.StartTLS)
+	}
+	return t.Address()
+}
+
+// dial opens a TCP connection and performs the STARTTLS upgrade, the returned connection is ready for a ClientHello
+func (t TLSTarget) dial(timeout time.Duration) (net.Conn, error) {
+	waitScanRate()
+	conn, err := net.DialTimeout("tcp", t.Address(), timeout)
+	if err != nil {
+		return nil, err
+	}
+	if t.StartTLS == "" {
+		return conn, nil
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := startTLSUpgrade(conn, t.StartTLS, t.ServerName); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("STARTTLS (%s) failed: %v", t.StartTLS, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// dialTLS completes a crypto/tls handshake with the target
+func (t TLSTarget) dialTLS(config *tls.Config, timeout time.Duration) (*tls.Conn, error) {
+	conn, err := t.dial(timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// startTLSUpgrade speaks the plaintext part of a protocol until the server is ready for the TLS handshake
+func startTLSUpgrade(conn net.Conn, protocol, serverName string) error {
+	switch protocol {
+	case StartTLSSMTP:
+		text := textproto.NewConn(conn)
+		if _, _, err := text.ReadResponse(220); err != nil {
+			return err
+		}
+		if _, err := smtpHello(text, "dominfo.local"); err != nil {
+			return err
+		}
+		_, _, err := smtpCmd(text, 220, "STARTTLS")
+		return err
+	case StartTLSFTP:
+		text := textproto.NewConn(conn)
+		if _, _, err := text.ReadResponse(220); err != nil {
+			return err
+		}
+		_, _, err := smtpCmd(text, 234, "AUTH TLS")
+		return err
+	case StartTLSIMAP:
+		reader := bufio.NewReader(conn)
+		if err := expectLinePrefix(reader, "* OK"); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(conn, "a1 STARTTLS\r\n"); err != nil {
+			return err
+		}
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(line, "a1 ") {
+				if !strings.HasPrefix(line, "a1 OK") {
+					return fmt.Errorf("server answered %q", strings.TrimSpace(line))
+				}
+				return nil
+			}
+		}
+	case StartTLSPOP3:
+		reader := bufio.NewReader(conn)
+		if err := expectLinePrefix(reader, "+OK"); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(conn, "STLS\r\n"); err != nil {
+			return err
+		}
+		return expectLinePrefix(reader, "+OK")
+	case StartTLSLDAP:
+		return ldapStartTLS(conn)
+	case StartTLSPostgreSQL:
+		// SSLRequest: length 8 and the magic code 80877103, the server answers with a single S or N
+		if _, err := conn.Write([]byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}); err != nil {
+			return err
+		}
+		answer := make([]byte, 1)
+		if _, err := io.ReadFull(conn, answer); err != nil {
+			return err
+		}
+		if answer[0] != 'S' {
+			return fmt.Errorf("server does not support SSL")
+		}
+		return nil
+	case StartTLSXMPP, StartTLSXMPPServer:
+		return xmppStartTLS(conn, protocol, serverName)
+	}
+	return fmt.Errorf("unknown STARTTLS protocol %q", protocol)
+}
+
+func expectLinePrefix(reader *bufio.Reader, prefix string) error {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, prefix) {
+		return fmt.Errorf("server answered %q", strings.TrimSpace(line))
+	}
+	return nil
+}
+
+// ldapStartTLS sends the StartTLS extended operation (RFC 4511 4.14) and checks the result code
+func ldapStartTLS(conn net.Conn) error {
+	oid := []byte("1.3.6.1.4.1.1466.20037")
+	request := append([]byte{0x80, byte(len(oid))}, oid...)        // requestName [0]
+	request = append([]byte{0x77, byte(len(request))}, request...) // ExtendedRequest [APPLICATION 23]
+	request = append([]byte{0x02, 0x01, 0x01}, request...)         // messageID 1
+	request = append([]byte{0x30, byte(len(request))}, request...) // LDAPMessage
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	length := int(header[1])
+	if length&0x80 != 0 {
+		lengthBytes := make([]byte, length&0x7f)
+		if _, err := io.ReadFull(conn, lengthBytes); err != nil {
+			return err
+		}
+		length = 0
+		for _, b := range lengthBytes {
+			length = length<<8 | int(b)
+		}
+	}
+	response := make([]byte, length)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return err
+	}
+
+	// ExtendedResponse [APPLICATION 24] starts with the resultCode ENUMERATED
+	index := bytes.IndexByte(response, 0x78)
+	if index < 0 {
+		return fmt.Errorf("unexpected LDAP response")
+	}
+	code := bytes.Index(response[index:], []byte{0x0a, 0x01})
+	if code < 0 || index+code+2 >= len(response) {
+		return fmt.Errorf("unexpected LDAP response")
+	}
+	if result := response[index+code+2]; result != 0 {
+		return fmt.Errorf("LDAP result code %d", result)
+	}
+	return nil
+}
+
+// xmppStartTLS opens an XMPP stream and negotiates STARTTLS (RFC 6120 5.4)
+func xmppStartTLS(conn net.Conn, protocol, serverName string) error {
+	namespace := "jabber:client"
+	if protocol == StartTLSXMPPServer {
+		namespace = "jabber:server"
+	}
+	header := fmt.Sprintf("<?xml version='1.0'?><stream:stream to='%s' xmlns='%s' xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>", serverName, namespace)
+	if _, err := io.WriteString(conn, header); err != nil {
+		return err
+	}
+
+	features, err := readUntil(conn, "</stream:features>")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(features, "urn:ietf:params:xml:ns:xmpp-tls") {
+		return fmt.Errorf("server does not offer STARTTLS")
+	}
+	if _, err := io.WriteString(conn, "<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>"); err != nil {
+		return err
+	}
+	answer, err := readUntil(conn, ">")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(answer, "<proceed") {
+		return fmt.Errorf("server answered %q", answer)
+	}
+	return nil
+}
+
+// readUntil reads byte by byte so that nothing after the marker is consumed
+func readUntil(conn net.Conn, marker string) (string, error) {
+	var sb strings.Builder
+	buf := make([]byte, 1)
+	for !strings.HasSuffix(sb.String(), marker) {
+		if sb.Len() > 64*1024 {
+			return "", fmt.Errorf("response too long")
+		}
+		if _, err := conn.Read(buf); err != nil {
+			return "", err
+		}
+		sb.WriteByte(buf[0])
+	}
+	return sb.String(), nil
+}
+
+// AddressTargets returns the target once for every address of its host, the host stays the server name.
+// For a network target only the addresses where the port is open are returned, each named by itself.
+func (t TLSTarget) AddressTargets() ([]TLSTarget, error) {
+	addresses, err := ResolveTargets(t.Host)
+	if err != nil {
+		return nil, err
+	}
+	network := IsNetworkTarget(t.Host)
+	port, _ := strconv.Atoi(t.Port)
+	targets := make([]TLSTarget, len(addresses))
+	forEachAddress(addresses, func(i int, ip net.IP) {
+		if network && !dialPort("tcp", ip.String(), port) {
+			return
+		}
+		targets[i] = t
+		targets[i].Host = ip.String()
+		if network {
+			targets[i].ServerName = ip.String()
+		}
+	})
+
+	open := targets[:0]
+	for _, target := range targets {
+		if target.Host != "" {
+			open = append(open, target)
+		}
+	}
+	if len(open) == 0 {
+		return nil, fmt.Errorf("port %s is not open on any address of %s", t.Port, t.Host)
+	}
+	return open, nil
+}
+
+// reportEachTarget runs a report for every target, addressConcurrency at a time. Failed targets are listed in red,
+// an error is only returned when all of them fail.
+func reportEachTarget(targets []TLSTarget, report func(TLSTarget) (string, error)) (string, error) {
+	reports := make([]string, len(targets))
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	concurrencyLimit := make(chan struct{}, addressConcurrency)
+	for i, target := range targets {
+		wg.Add(1)
+		concurrencyLimit <- struct{}{}
+		go func(i int, target TLSTarget) {
+			defer wg.Done()
+			defer func() { <-concurrencyLimit }()
+			reports[i], errs[i] = report(target)
+		}(i, target)
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			reports[i] = color.RedString("\n%s: %v\n", targets[i], err)
+		}
+	}
+	if failed == len(targets) && failed > 0 {
+		if failed == 1 {
+			return "", errs[0]
+		}
+		return "", fmt.Errorf("all %d addresses failed, %s: %v", failed, targets[0], errs[0])
+	}
+	return strings.Join(reports, "\n"), nil
+}
+
+// TLSServiceTargets returns the TLS and STARTTLS targets among the given open ports. Well-known ports are taken
+// as they are, every other open port is tried with a TLS handshake.
+func TLSServiceTargets(host string, openPorts []int) []TLSTarget {
+	found := make([]bool, len(openPorts))
+	var wg sync.WaitGroup
+	concurrencyLimit := make(chan struct{}, max(1, PortConcurrency))
+	for i, port := range openPorts {
+		if implicitTLSPorts[port] || startTLSPorts[port] != "" {
+			found[i] = true
+			continue
+		}
+		wg.Add(1)
+		concurrencyLimit <- struct{}{}
+		go func(i, port int) {
+			defer wg.Done()
+			defer func() { <-concurrencyLimit }()
+			found[i] = NewTLSTarget(host, port).speaksTLS()
+		}(i, port)
+	}
+	wg.Wait()
+
+	var targets []TLSTarget
+	for i, port := range openPorts {
+		if found[i] {
+			targets = append(targets, NewTLSTarget(host, port))
+		}
+	}
+	return targets
+}
+
+// speaksTLS tells whether a port answers a ClientHello with a handshake or a TLS alert
+func (t TLSTarget) speaksTLS() bool {
+	conn, err := t.dialTLS(&tls.Config{InsecureSkipVerify: true, ServerName: t.ServerName}, ProbeTimeout)
+	if err == nil {
+		conn.Close()
+		return true
+	}
+	// A server that rejects the hello (for example without SNI) still speaks TLS
+	var alert tls.AlertError
+	return errors.As(err, &alert)
+}
+
+// GetTLSServicesReport scans the selected ports on every address of a domain or network target and inspects the certificate and
+// protocols of every TLS service found
+func GetTLSServicesReport(domain string) (string, error) {
+	addresses, err := ResolveTargets(domain)
+	if err != nil {
+		return "", err
+	}
+	ports, err := tlsServicePorts()
+	if err != nil {
+		return "", err
+	}
+	network := IsNetworkTarget(domain)
+	found := make([][]TLSTarget, len(addresses))
+	forEachAddress(addresses, func(i int, ip net.IP) {
+		found[i] = TLSServiceTargets(ip.String(), ScanPorts(ip.String(), ports))
+		if !network {
+			for j := range found[i] {
+				found[i][j].ServerName = domain
+			}
+		}
+	})
+	var targets []TLSTarget
+	for _, addressTargets := range found {
+		targets = append(targets, addressTargets...)
+	}
+	if len(targets) == 0 {
+		return "", fmt.Errorf("no TLS or STARTTLS ports open on %s", domain)
+	}
+
+	return reportEachTarget(targets, tlsServiceReport)
+}
+
+// tlsServicePorts returns the ports selected for the port scan together with every known implicit TLS and STARTTLS port
+func tlsServicePorts() ([]int, error) {
+	ports, err := SelectedPorts()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[int]bool{}
+	for _, port := range ports {
+		seen[port] = true
+	}
+	for port := range implicitTLSPorts {
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+	for port := range startTLSPorts {
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// tlsServiceReport combines the certificate details and the protocol scan of one service
+func tlsServiceReport(target TLSTarget) (string, error) {
+	info, err := GetTLSInfo(target)
+	if err != nil {
+		return "", err
+	}
+	scan, err := ScanTLS(target)
+	if err != nil {
+		return info + color.RedString("TLS scan failed: %v\n", err), nil
+	}
+	return info + FormatTLSScanResult(scan), nil
+}
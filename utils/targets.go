@@ -0,0 +1,258 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Target settings, they are set from the command line
+var (
+	ExcludeSpec string  // addresses, CIDR blocks and ranges that are never scanned
+	ExcludeFile string  // file with one exclusion per line
+	MaxTargets  = 65536 // largest number of addresses a network target may expand to
+	ScanRate    = 0.0   // connections and packets per second over all scans, 0 disables the limit
+)
+
+// addressConcurrency is the number of addresses of a network target scanned at the same time
+const addressConcurrency = 8
+
+// AddressRange is an inclusive range of addresses of one family
+type AddressRange struct {
+	First netip.Addr
+	Last  netip.Addr
+}
+
+func (r AddressRange) contains(addr netip.Addr) bool {
+	return addr.BitLen() == r.First.BitLen() && addr.Compare(r.First) >= 0 && addr.Compare(r.Last) <= 0
+}
+
+// parseAddressRange parses an address, a CIDR block (192.0.2.0/24), a full range (192.0.2.1-192.0.2.50)
+// or a range of the last IPv4 octet (192.0.2.1-50)
+func parseAddressRange(entry string) (AddressRange, error) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return AddressRange{}, fmt.Errorf("invalid CIDR block %q", entry)
+		}
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()).Masked()
+		if !prefix.IsValid() {
+			return AddressRange{}, fmt.Errorf("invalid CIDR block %q", entry)
+		}
+		// The last address has all host bits set
+		last := prefix.Addr().AsSlice()
+		for bit := prefix.Bits(); bit < len(last)*8; bit++ {
+			last[bit/8] |= 1 << (7 - bit%8)
+		}
+		lastAddr, _ := netip.AddrFromSlice(last)
+		return AddressRange{First: prefix.Addr(), Last: lastAddr}, nil
+	}
+
+	low, high, isRange := strings.Cut(entry, "-")
+	first, err := netip.ParseAddr(strings.TrimSpace(low))
+	if err != nil {
+		return AddressRange{}, fmt.Errorf("invalid address %q", entry)
+	}
+	first = first.Unmap()
+	if !isRange {
+		return AddressRange{First: first, Last: first}, nil
+	}
+
+	high = strings.TrimSpace(high)
+	last, err := netip.ParseAddr(high)
+	if octet, atoiErr := strconv.Atoi(high); err != nil && atoiErr == nil && first.Is4() && octet >= 0 && octet <= 255 {
+		// Only the last octet is given
+		octets := first.As4()
+		octets[3] = byte(octet)
+		last, err = netip.AddrFrom4(octets), nil
+	}
+	if err != nil {
+		return AddressRange{}, fmt.Errorf("invalid address range %q", entry)
+	}
+	last = last.Unmap()
+	if first.BitLen() != last.BitLen() || first.Compare(last) > 0 {
+		return AddressRange{}, fmt.Errorf("invalid address range %q", entry)
+	}
+	return AddressRange{First: first, Last: last}, nil
+}
+
+// parseAddressRanges parses a comma separated list of addresses, CIDR blocks and ranges
+func parseAddressRanges(spec string) ([]AddressRange, error) {
+	var ranges []AddressRange
+	for _, entry := range strings.Split(spec, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		r, err := parseAddressRange(entry)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// IsNetworkTarget tells whether a target is made of addresses, CIDR blocks and ranges rather than a domain
+func IsNetworkTarget(target string) bool {
+	ranges, err := parseAddressRanges(target)
+	return err == nil && len(ranges) > 0
+}
+
+// IsValidTarget accepts a domain that resolves or a list of addresses, CIDR blocks and ranges
+func IsValidTarget(target string) bool {
+	return IsNetworkTarget(target) || IsValidDomain(target)
+}
+
+// ExpandTargets returns every address of a comma separated list of addresses, CIDR blocks and ranges
+func ExpandTargets(spec string) ([]net.IP, error) {
+	ranges, err := parseAddressRanges(spec)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[netip.Addr]bool{}
+	var addresses []net.IP
+	for _, r := range ranges {
+		for addr := r.First; addr.IsValid() && addr.Compare(r.Last) <= 0; addr = addr.Next() {
+			if seen[addr] {
+				continue
+			}
+			if len(addresses) >= MaxTargets {
+				return nil, fmt.Errorf("%s expands to more than %d addresses", spec, MaxTargets)
+			}
+			seen[addr] = true
+			addresses = append(addresses, net.IP(addr.AsSlice()))
+		}
+	}
+	return addresses, nil
+}
+
+var (
+	exclusionsOnce sync.Once
+	exclusions     []AddressRange
+	exclusionsErr  error
+)
+
+// Exclusions returns the ranges of ExcludeSpec and ExcludeFile, they are parsed once
+func Exclusions() ([]AddressRange, error) {
+	exclusionsOnce.Do(func() {
+		if exclusions, exclusionsErr = parseAddressRanges(ExcludeSpec); exclusionsErr != nil {
+			exclusionsErr = fmt.Errorf("invalid exclusion: %w", exclusionsErr)
+			return
+		}
+		if ExcludeFile == "" {
+			return
+		}
+		file, err := os.Open(ExcludeFile)
+		if err != nil {
+			exclusionsErr = fmt.Errorf("could not read exclusion file: %w", err)
+			return
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for line := 1; scanner.Scan(); line++ {
+			text, _, _ := strings.Cut(scanner.Text(), "#")
+			ranges, err := parseAddressRanges(text)
+			if err != nil {
+				exclusionsErr = fmt.Errorf("%s line %d: %w", ExcludeFile, line, err)
+				return
+			}
+			exclusions = append(exclusions, ranges...)
+		}
+		exclusionsErr = scanner.Err()
+	})
+	return exclusions, exclusionsErr
+}
+
+// IsExcluded tells whether an address is in the exclusion list
+func IsExcluded(ip net.IP) bool {
+	ranges, _ := Exclusions()
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	for _, r := range ranges {
+		if r.contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveTargets returns the addresses of a domain or a network target, without the excluded ones
+func ResolveTargets(target string) ([]net.IP, error) {
+	if _, err := Exclusions(); err != nil {
+		return nil, err
+	}
+	var addresses []net.IP
+	var err error
+	if IsNetworkTarget(target) {
+		addresses, err = ExpandTargets(target)
+	} else {
+		addresses, err = ResolveAddresses(target)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := addresses[:0]
+	for _, ip := range addresses {
+		if !IsExcluded(ip) {
+			allowed = append(allowed, ip)
+		}
+	}
+	if len(allowed) == 0 {
+		return nil, fmt.Errorf("all addresses of %s are excluded", target)
+	}
+	return allowed, nil
+}
+
+// ReverseDNS returns the PTR name of an address or an empty string
+func ReverseDNS(ip net.IP) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip.String())
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(names[0], ".")
+}
+
+// forEachAddress calls fn for every address, addressConcurrency at a time
+func forEachAddress(addresses []net.IP, fn func(i int, ip net.IP)) {
+	var wg sync.WaitGroup
+	concurrencyLimit := make(chan struct{}, addressConcurrency)
+	for i, ip := range addresses {
+		wg.Add(1)
+		concurrencyLimit <- struct{}{}
+		go func(i int, ip net.IP) {
+			defer wg.Done()
+			defer func() { <-concurrencyLimit }()
+			fn(i, ip)
+		}(i, ip)
+	}
+	wg.Wait()
+}
+
+var (
+	scanRateOnce sync.Once
+	scanRateTick <-chan time.Time
+)
+
+// waitScanRate blocks until ScanRate allows the next connection or packet, the limit is shared by all scans
+func waitScanRate() {
+	if ScanRate <= 0 {
+		return
+	}
+	scanRateOnce.Do(func() {
+		scanRateTick = time.NewTicker(time.Duration(float64(time.Second) / ScanRate)).C
+	})
+	<-scanRateTick
+}
@@ -0,0 +1,708 @@
+package utils
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Raw TLS record and handshake types used by the scanners that need to craft their own handshakes
+const (
+	recordTypeChangeCipherSpec uint8 = 20
+	recordTypeAlert            uint8 = 21
+	recordTypeHandshake        uint8 = 22
+	recordTypeApplicationData  uint8 = 23
+	recordTypeHeartbeat        uint8 = 24
+
+	handshakeTypeClientHello       uint8 = 1
+	handshakeTypeServerHello       uint8 = 2
+	handshakeTypeCertificate       uint8 = 11
+	handshakeTypeServerKeyExchange uint8 = 12
+	handshakeTypeCertificateReq    uint8 = 13
+	handshakeTypeServerHelloDone   uint8 = 14
+	handshakeTypeClientKeyExchange uint8 = 16
+	handshakeTypeFinished          uint8 = 20
+)
+
+// Protocol versions, including SSLv3 which crypto/tls can no longer negotiate
+const (
+	versionSSL30 uint16 = 0x0300
+	versionTLS10 uint16 = 0x0301
+	versionTLS11 uint16 = 0x0302
+	versionTLS12 uint16 = 0x0303
+	versionTLS13 uint16 = 0x0304
+)
+
+// TLS extension types
+const (
+	extServerName          uint16 = 0
+	extStatusRequest       uint16 = 5
+	extSupportedGroups     uint16 = 10
+	extECPointFormats      uint16 = 11
+	extSignatureAlgorithms uint16 = 13
+	extHeartbeat           uint16 = 15
+	extALPN                uint16 = 16
+	extSCT                 uint16 = 18
+	extSessionTicket       uint16 = 35
+	extSupportedVersions   uint16 = 43
+	extPSKModes            uint16 = 45
+	extKeyShare            uint16 = 51
+	extRenegotiationInfo   uint16 = 0xff01
+)
+
+// Named groups offered in key exchange probes
+const (
+	groupSecp256r1 uint16 = 0x0017
+	groupSecp384r1 uint16 = 0x0018
+	groupSecp521r1 uint16 = 0x0019
+	groupX25519    uint16 = 0x001d
+	groupX448      uint16 = 0x001e
+	groupFFDHE2048 uint16 = 0x0100
+	groupFFDHE3072 uint16 = 0x0101
+	groupFFDHE4096 uint16 = 0x0102
+	groupMLKEM768  uint16 = 0x11ec
+)
+
+var groupNames = map[uint16]string{
+	groupSecp256r1: "secp256r1",
+	groupSecp384r1: "secp384r1",
+	groupSecp521r1: "secp521r1",
+	groupX25519:    "x25519",
+	groupX448:      "x448",
+	groupFFDHE2048: "ffdhe2048",
+	groupFFDHE3072: "ffdhe3072",
+	groupFFDHE4096: "ffdhe4096",
+	groupMLKEM768:  "X25519MLKEM768",
+}
+
+var versionNames = map[uint16]string{
+	versionSSL30: "SSLv3",
+	versionTLS10: "TLS 1.0",
+	versionTLS11: "TLS 1.1",
+	versionTLS12: "TLS 1.2",
+	versionTLS13: "TLS 1.3",
+}
+
+// helloRetryRequestRandom marks a ServerHello that is really a HelloRetryRequest (RFC 8446 4.1.3)
+var helloRetryRequestRandom = []byte{
+	0xcf, 0x21, 0xad, 0x74, 0xe5, 0x9a, 0x61, 0x11, 0xbe, 0x1d, 0x8c, 0x02, 0x1e, 0x65, 0xb8, 0x91,
+	0xc2, 0xa2, 0x11, 0x16, 0x7a, 0xbb, 0x8c, 0x5e, 0x07, 0x9e, 0x09, 0xe2, 0xc8, 0xa8, 0x33, 0x9c,
+}
+
+// defaultSignatureAlgorithms covers modern and legacy schemes so that old servers still answer
+var defaultSignatureAlgorithms = []uint16{
+	0x0403, 0x0503, 0x0603, 0x0807, 0x0808, 0x0804, 0x0805, 0x0806,
+	0x0401, 0x0501, 0x0601, 0x0303, 0x0301, 0x0302, 0x0402, 0x0502, 0x0602, 0x0203, 0x0201, 0x0202,
+}
+
+var defaultGroups = []uint16{groupX25519, groupSecp256r1, groupSecp384r1, groupSecp521r1, groupFFDHE2048, groupFFDHE3072}
+
+// tlsExtension is a raw extension appended to a crafted ClientHello
+type tlsExtension struct {
+	Type uint16
+	Data []byte
+}
+
+// clientHelloSpec describes a crafted ClientHello
+type clientHelloSpec struct {
+	Version           uint16   // legacy_version field
+	RecordVersion     uint16   // version in the record header, defaults to TLS 1.0 (or SSLv3 for SSLv3 hellos)
+	Ciphers           []uint16 // offered cipher suites
+	Compression       []byte   // compression methods, defaults to null only
+	ServerName        string   // SNI, omitted for IP addresses
+	Groups            []uint16 // supported_groups, defaults to defaultGroups
+	KeyShares         []uint16 // groups for which a key share is sent, only x25519 carries a real key
+	SupportedVersions []uint16 // adds supported_versions, key_share and psk_key_exchange_modes when set
+	ALPN              []string
+	RenegotiationInfo []byte // renegotiated_connection, empty on the initial handshake
+	NoRenegotiation   bool   // omit the renegotiation_info extension
+	StatusRequest     bool
+	SessionTicket     bool
+	Heartbeat         bool
+	SCT               bool
+	NoExtensions      bool // plain SSLv3 style hello without extensions
+	Extensions        []tlsExtension
+	Random            []byte
+}
+
+// marshal builds the handshake message (header included) for the spec
+func (spec *clientHelloSpec) marshal() []byte {
+	random := spec.Random
+	if len(random) != 32 {
+		random = make([]byte, 32)
+		rand.Read(random)
+		spec.Random = random
+	}
+
+	body := appendUint16(nil, spec.Version)
+	body = append(body, random...)
+
+	sessionID := make([]byte, 32)
+	rand.Read(sessionID)
+	body = append(body, byte(len(sessionID)))
+	body = append(body, sessionID...)
+
+	body = appendUint16(body, uint16(2*len(spec.Ciphers)))
+	for _, cipher := range spec.Ciphers {
+		body = appendUint16(body, cipher)
+	}
+
+	compression := spec.Compression
+	if len(compression) == 0 {
+		compression = []byte{0}
+	}
+	body = append(body, byte(len(compression)))
+	body = append(body, compression...)
+
+	if !spec.NoExtensions {
+		extensions := spec.marshalExtensions()
+		body = appendUint16(body, uint16(len(extensions)))
+		body = append(body, extensions...)
+	}
+
+	return wrapHandshake(handshakeTypeClientHello, body)
+}
+
+func (spec *clientHelloSpec) marshalExtensions() []byte {
+	var ext []byte
+
+	if spec.ServerName != "" && net.ParseIP(spec.ServerName) == nil {
+		name := []byte(spec.ServerName)
+		data := appendUint16(nil, uint16(len(name)+3))
+		data = append(data, 0)
+		data = appendUint16(data, uint16(len(name)))
+		data = append(data, name...)
+		ext = appendExtension(ext, extServerName, data)
+	}
+
+	groups := spec.Groups
+	if len(groups) == 0 {
+		groups = defaultGroups
+	}
+	data := appendUint16(nil, uint16(2*len(groups)))
+	for _, group := range groups {
+		data = appendUint16(data, group)
+	}
+	ext = appendExtension(ext, extSupportedGroups, data)
+	ext = appendExtension(ext, extECPointFormats, []byte{1, 0})
+
+	data = appendUint16(nil, uint16(2*len(defaultSignatureAlgorithms)))
+	for _, alg := range defaultSignatureAlgorithms {
+		data = appendUint16(data, alg)
+	}
+	ext = appendExtension(ext, extSignatureAlgorithms, data)
+	if !spec.NoRenegotiation {
+		ext = appendExtension(ext, extRenegotiationInfo, append([]byte{byte(len(spec.RenegotiationInfo))}, spec.RenegotiationInfo...))
+	}
+
+	if spec.StatusRequest {
+		ext = appendExtension(ext, extStatusRequest, []byte{1, 0, 0, 0, 0})
+	}
+	if spec.SessionTicket {
+		ext = appendExtension(ext, extSessionTicket, nil)
+	}
+	if spec.Heartbeat {
+		// peer_allowed_to_send
+		ext = appendExtension(ext, extHeartbeat, []byte{1})
+	}
+	if spec.SCT {
+		ext = appendExtension(ext, extSCT, nil)
+	}
+	if len(spec.ALPN) > 0 {
+		var protocols []byte
+		for _, proto := range spec.ALPN {
+			protocols = append(protocols, byte(len(proto)))
+			protocols = append(protocols, proto...)
+		}
+		ext = appendExtension(ext, extALPN, append(appendUint16(nil, uint16(len(protocols))), protocols...))
+	}
+
+	if len(spec.SupportedVersions) > 0 {
+		data = []byte{byte(2 * len(spec.SupportedVersions))}
+		for _, version := range spec.SupportedVersions {
+			data = appendUint16(data, version)
+		}
+		ext = appendExtension(ext, extSupportedVersions, data)
+		ext = appendExtension(ext, extPSKModes, []byte{1, 1})
+
+		var shares []byte
+		for _, group := range spec.KeyShares {
+			if share := keyShareFor(group); share != nil {
+				shares = appendUint16(shares, group)
+				shares = appendUint16(shares, uint16(len(share)))
+				shares = append(shares, share...)
+			}
+		}
+		ext = appendExtension(ext, extKeyShare, append(appendUint16(nil, uint16(len(shares))), shares...))
+	}
+
+	for _, extra := range spec.Extensions {
+		ext = appendExtension(ext, extra.Type, extra.Data)
+	}
+	return ext
+}
+
+// keyShareFor returns a fresh public key for the group, an empty key_share makes the server answer with a HelloRetryRequest
+func keyShareFor(group uint16) []byte {
+	var curve ecdh.Curve
+	switch group {
+	case groupX25519:
+		curve = ecdh.X25519()
+	case groupSecp256r1:
+		curve = ecdh.P256()
+	case groupSecp384r1:
+		curve = ecdh.P384()
+	case groupSecp521r1:
+		curve = ecdh.P521()
+	default:
+		return nil
+	}
+	key, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil
+	}
+	return key.PublicKey().Bytes()
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendExtension(b []byte, typ uint16, data []byte) []byte {
+	b = appendUint16(b, typ)
+	b = appendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+func wrapHandshake(typ uint8, body []byte) []byte {
+	msg := []byte{typ, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}
+	return append(msg, body...)
+}
+
+// tlsAlert is returned when the peer answers with an alert record
+type tlsAlert struct {
+	Level       uint8
+	Description uint8
+}
+
+var alertNames = map[uint8]string{
+	0: "close_notify", 10: "unexpected_message", 20: "bad_record_mac", 21: "decryption_failed",
+	22: "record_overflow", 30: "decompression_failure", 40: "handshake_failure", 42: "bad_certificate",
+	47: "illegal_parameter", 50: "decode_error", 51: "decrypt_error", 70: "protocol_version",
+	71: "insufficient_security", 80: "internal_error", 86: "inappropriate_fallback", 90: "user_canceled",
+	100: "no_renegotiation", 109: "missing_extension", 110: "unsupported_extension", 112: "unrecognized_name",
+	120: "no_application_protocol",
+}
+
+func (a *tlsAlert) Error() string {
+	if name, ok := alertNames[a.Description]; ok {
+		return "tls alert: " + name
+	}
+	return fmt.Sprintf("tls alert: %d", a.Description)
+}
+
+// rawTLSConn reads and writes unencrypted TLS records over a TCP connection
+type rawTLSConn struct {
+	conn    net.Conn
+	timeout time.Duration
+	hsBuf   []byte
+}
+
+// dialRawTLS opens a connection for a crafted handshake, upgrading STARTTLS targets first
+func dialRawTLS(target TLSTarget, timeout time.Duration) (*rawTLSConn, error) {
+	conn, err := target.dial(timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &rawTLSConn{conn: conn, timeout: timeout}, nil
+}
+
+func (c *rawTLSConn) Close() error {
+	return c.conn.Close()
+}
+
+// writeRecord writes a single record, splitting nothing since crafted messages stay below the record limit
+func (c *rawTLSConn) writeRecord(typ uint8, version uint16, payload []byte) error {
+	record := []byte{typ, byte(version >> 8), byte(version), byte(len(payload) >> 8), byte(len(payload))}
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	_, err := c.conn.Write(append(record, payload...))
+	return err
+}
+
+// readRecord reads the next record from the peer
+func (c *rawTLSConn) readRecord() (uint8, uint16, []byte, error) {
+	c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return 0, 0, nil, err
+	}
+	length := int(binary.BigEndian.Uint16(header[3:5]))
+	if length > 18432 {
+		return 0, 0, nil, fmt.Errorf("record too large: %d", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.conn, payload); err != nil {
+		return 0, 0, nil, err
+	}
+	return header[0], binary.BigEndian.Uint16(header[1:3]), payload, nil
+}
+
+// readHandshake returns the next handshake message, reassembling messages split across records
+func (c *rawTLSConn) readHandshake() (uint8, []byte, error) {
+	for {
+		if len(c.hsBuf) >= 4 {
+			length := int(c.hsBuf[1])<<16 | int(c.hsBuf[2])<<8 | int(c.hsBuf[3])
+			if len(c.hsBuf) >= 4+length {
+				typ := c.hsBuf[0]
+				msg := c.hsBuf[:4+length]
+				c.hsBuf = c.hsBuf[4+length:]
+				return typ, msg, nil
+			}
+		}
+
+		typ, _, payload, err := c.readRecord()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch typ {
+		case recordTypeHandshake:
+			c.hsBuf = append(c.hsBuf, payload...)
+		case recordTypeAlert:
+			if len(payload) < 2 {
+				return 0, nil, fmt.Errorf("malformed alert")
+			}
+			return 0, nil, &tlsAlert{Level: payload[0], Description: payload[1]}
+		default:
+			return 0, nil, fmt.Errorf("unexpected record type %d", typ)
+		}
+	}
+}
+
+// serverHello holds the fields of a parsed ServerHello or HelloRetryRequest
+type serverHello struct {
+	Version        uint16
+	Random         []byte
+	SessionID      []byte
+	CipherSuite    uint16
+	Compression    uint8
+	Extensions     map[uint16][]byte
+	ExtensionOrder []uint16
+	HelloRetry     bool
+}
+
+// negotiatedVersion returns the version selected through supported_versions or the legacy version field
+func (h *serverHello) negotiatedVersion() uint16 {
+	if data, ok := h.Extensions[extSupportedVersions]; ok && len(data) == 2 {
+		return binary.BigEndian.Uint16(data)
+	}
+	return h.Version
+}
+
+// selectedGroup returns the group of the key_share extension, for both ServerHello and HelloRetryRequest
+func (h *serverHello) selectedGroup() (uint16, bool) {
+	data, ok := h.Extensions[extKeyShare]
+	if !ok || len(data) < 2 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(data), true
+}
+
+// parseServerHello decodes a ServerHello handshake message (header included)
+func parseServerHello(msg []byte) (*serverHello, error) {
+	errMalformed := errors.New("malformed ServerHello")
+	if len(msg) < 4+38 || msg[0] != handshakeTypeServerHello {
+		return nil, errMalformed
+	}
+	body := msg[4:]
+	hello := &serverHello{
+		Version:    binary.BigEndian.Uint16(body[0:2]),
+		Random:     body[2:34],
+		Extensions: map[uint16][]byte{},
+	}
+	sessionIDLength := int(body[34])
+	body = body[35:]
+	if len(body) < sessionIDLength+3 {
+		return nil, errMalformed
+	}
+	hello.SessionID = body[:sessionIDLength]
+	body = body[sessionIDLength:]
+	hello.CipherSuite = binary.BigEndian.Uint16(body[0:2])
+	hello.Compression = body[2]
+	body = body[3:]
+	hello.HelloRetry = string(hello.Random) == string(helloRetryRequestRandom)
+
+	if len(body) < 2 {
+		return hello, nil
+	}
+	extensionsLength := int(binary.BigEndian.Uint16(body))
+	body = body[2:]
+	if len(body) < extensionsLength {
+		return nil, errMalformed
+	}
+	body = body[:extensionsLength]
+	for len(body) >= 4 {
+		typ := binary.BigEndian.Uint16(body[0:2])
+		length := int(binary.BigEndian.Uint16(body[2:4]))
+		if len(body) < 4+length {
+			return nil, errMalformed
+		}
+		hello.Extensions[typ] = body[4 : 4+length]
+		hello.ExtensionOrder = append(hello.ExtensionOrder, typ)
+		body = body[4+length:]
+	}
+	return hello, nil
+}
+
+// recordVersionFor picks the record layer version used to send a hello
+func recordVersionFor(spec *clientHelloSpec) uint16 {
+	if spec.RecordVersion != 0 {
+		return spec.RecordVersion
+	}
+	if spec.Version == versionSSL30 {
+		return versionSSL30
+	}
+	return versionTLS10
+}
+
+// sendClientHello sends a crafted ClientHello on a new connection and returns the server's answer
+func sendClientHello(target TLSTarget, spec *clientHelloSpec, timeout time.Duration) (*serverHello, error) {
+	conn, err := dialRawTLS(target, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	hello, _, err := conn.handshakeHello(spec)
+	return hello, err
+}
+
+// handshakeHello sends the ClientHello on an open connection and reads the ServerHello
+func (c *rawTLSConn) handshakeHello(spec *clientHelloSpec) (*serverHello, []byte, error) {
+	clientHello := spec.marshal()
+	if err := c.writeRecord(recordTypeHandshake, recordVersionFor(spec), clientHello); err != nil {
+		return nil, nil, err
+	}
+	typ, msg, err := c.readHandshake()
+	if err != nil {
+		return nil, nil, err
+	}
+	if typ != handshakeTypeServerHello {
+		return nil, nil, fmt.Errorf("unexpected handshake message %d", typ)
+	}
+	hello, err := parseServerHello(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return hello, msg, nil
+}
+
+// cipherSuite describes a cipher suite known to the raw scanners
+type cipherSuite struct {
+	ID   uint16
+	Name string
+}
+
+// tls13CipherSuites are only negotiable through supported_versions
+var tls13CipherSuites = []cipherSuite{
+	{0x1301, "TLS_AES_128_GCM_SHA256"},
+	{0x1302, "TLS_AES_256_GCM_SHA384"},
+	{0x1303, "TLS_CHACHA20_POLY1305_SHA256"},
+	{0x1304, "TLS_AES_128_CCM_SHA256"},
+	{0x1305, "TLS_AES_128_CCM_8_SHA256"},
+}
+
+// legacyCipherSuites covers the SSLv3 to TLS 1.2 suites seen in the wild, including export and anonymous suites
+var legacyCipherSuites = []cipherSuite{
+	{0x0001, "TLS_RSA_WITH_NULL_MD5"},
+	{0x0002, "TLS_RSA_WITH_NULL_SHA"},
+	{0x0003, "TLS_RSA_EXPORT_WITH_RC4_40_MD5"},
+	{0x0004, "TLS_RSA_WITH_RC4_128_MD5"},
+	{0x0005, "TLS_RSA_WITH_RC4_128_SHA"},
+	{0x0006, "TLS_RSA_EXPORT_WITH_RC2_CBC_40_MD5"},
+	{0x0007, "TLS_RSA_WITH_IDEA_CBC_SHA"},
+	{0x0008, "TLS_RSA_EXPORT_WITH_DES40_CBC_SHA"},
+	{0x0009, "TLS_RSA_WITH_DES_CBC_SHA"},
+	{0x000a, "TLS_RSA_WITH_3DES_EDE_CBC_SHA"},
+	{0x000b, "TLS_DH_DSS_EXPORT_WITH_DES40_CBC_SHA"},
+	{0x000c, "TLS_DH_DSS_WITH_DES_CBC_SHA"},
+	{0x000d, "TLS_DH_DSS_WITH_3DES_EDE_CBC_SHA"},
+	{0x000e, "TLS_DH_RSA_EXPORT_WITH_DES40_CBC_SHA"},
+	{0x000f, "TLS_DH_RSA_WITH_DES_CBC_SHA"},
+	{0x0010, "TLS_DH_RSA_WITH_3DES_EDE_CBC_SHA"},
+	{0x0011, "TLS_DHE_DSS_EXPORT_WITH_DES40_CBC_SHA"},
+	{0x0012, "TLS_DHE_DSS_WITH_DES_CBC_SHA"},
+	{0x0013, "TLS_DHE_DSS_WITH_3DES_EDE_CBC_SHA"},
+	{0x0014, "TLS_DHE_RSA_EXPORT_WITH_DES40_CBC_SHA"},
+	{0x0015, "TLS_DHE_RSA_WITH_DES_CBC_SHA"},
+	{0x0016, "TLS_DHE_RSA_WITH_3DES_EDE_CBC_SHA"},
+	{0x0017, "TLS_DH_anon_EXPORT_WITH_RC4_40_MD5"},
+	{0x0018, "TLS_DH_anon_WITH_RC4_128_MD5"},
+	{0x0019, "TLS_DH_anon_EXPORT_WITH_DES40_CBC_SHA"},
+	{0x001a, "TLS_DH_anon_WITH_DES_CBC_SHA"},
+	{0x001b, "TLS_DH_anon_WITH_3DES_EDE_CBC_SHA"},
+	{0x002f, "TLS_RSA_WITH_AES_128_CBC_SHA"},
+	{0x0030, "TLS_DH_DSS_WITH_AES_128_CBC_SHA"},
+	{0x0031, "TLS_DH_RSA_WITH_AES_128_CBC_SHA"},
+	{0x0032, "TLS_DHE_DSS_WITH_AES_128_CBC_SHA"},
+	{0x0033, "TLS_DHE_RSA_WITH_AES_128_CBC_SHA"},
+	{0x0034, "TLS_DH_anon_WITH_AES_128_CBC_SHA"},
+	{0x0035, "TLS_RSA_WITH_AES_256_CBC_SHA"},
+	{0x0036, "TLS_DH_DSS_WITH_AES_256_CBC_SHA"},
+	{0x0037, "TLS_DH_RSA_WITH_AES_256_CBC_SHA"},
+	{0x0038, "TLS_DHE_DSS_WITH_AES_256_CBC_SHA"},
+	{0x0039, "TLS_DHE_RSA_WITH_AES_256_CBC_SHA"},
+	{0x003a, "TLS_DH_anon_WITH_AES_256_CBC_SHA"},
+	{0x003b, "TLS_RSA_WITH_NULL_SHA256"},
+	{0x003c, "TLS_RSA_WITH_AES_128_CBC_SHA256"},
+	{0x003d, "TLS_RSA_WITH_AES_256_CBC_SHA256"},
+	{0x0040, "TLS_DHE_DSS_WITH_AES_128_CBC_SHA256"},
+	{0x0041, "TLS_RSA_WITH_CAMELLIA_128_CBC_SHA"},
+	{0x0044, "TLS_DHE_DSS_WITH_CAMELLIA_128_CBC_SHA"},
+	{0x0045, "TLS_DHE_RSA_WITH_CAMELLIA_128_CBC_SHA"},
+	{0x0067, "TLS_DHE_RSA_WITH_AES_128_CBC_SHA256"},
+	{0x006a, "TLS_DHE_DSS_WITH_AES_256_CBC_SHA256"},
+	{0x006b, "TLS_DHE_RSA_WITH_AES_256_CBC_SHA256"},
+	{0x006c, "TLS_DH_anon_WITH_AES_128_CBC_SHA256"},
+	{0x006d, "TLS_DH_anon_WITH_AES_256_CBC_SHA256"},
+	{0x0084, "TLS_RSA_WITH_CAMELLIA_256_CBC_SHA"},
+	{0x0087, "TLS_DHE_DSS_WITH_CAMELLIA_256_CBC_SHA"},
+	{0x0088, "TLS_DHE_RSA_WITH_CAMELLIA_256_CBC_SHA"},
+	{0x0096, "TLS_RSA_WITH_SEED_CBC_SHA"},
+	{0x009a, "TLS_DHE_RSA_WITH_SEED_CBC_SHA"},
+	{0x009c, "TLS_RSA_WITH_AES_128_GCM_SHA256"},
+	{0x009d, "TLS_RSA_WITH_AES_256_GCM_SHA384"},
+	{0x009e, "TLS_DHE_RSA_WITH_AES_128_GCM_SHA256"},
+	{0x009f, "TLS_DHE_RSA_WITH_AES_256_GCM_SHA384"},
+	{0x00a2, "TLS_DHE_DSS_WITH_AES_128_GCM_SHA256"},
+	{0x00a3, "TLS_DHE_DSS_WITH_AES_256_GCM_SHA384"},
+	{0x00a6, "TLS_DH_anon_WITH_AES_128_GCM_SHA256"},
+	{0x00a7, "TLS_DH_anon_WITH_AES_256_GCM_SHA384"},
+	{0x00ba, "TLS_RSA_WITH_CAMELLIA_128_CBC_SHA256"},
+	{0x00be, "TLS_DHE_RSA_WITH_CAMELLIA_128_CBC_SHA256"},
+	{0x00c0, "TLS_RSA_WITH_CAMELLIA_256_CBC_SHA256"},
+	{0x00c4, "TLS_DHE_RSA_WITH_CAMELLIA_256_CBC_SHA256"},
+	{0xc001, "TLS_ECDH_ECDSA_WITH_NULL_SHA"},
+	{0xc002, "TLS_ECDH_ECDSA_WITH_RC4_128_SHA"},
+	{0xc003, "TLS_ECDH_ECDSA_WITH_3DES_EDE_CBC_SHA"},
+	{0xc004, "TLS_ECDH_ECDSA_WITH_AES_128_CBC_SHA"},
+	{0xc005, "TLS_ECDH_ECDSA_WITH_AES_256_CBC_SHA"},
+	{0xc006, "TLS_ECDHE_ECDSA_WITH_NULL_SHA"},
+	{0xc007, "TLS_ECDHE_ECDSA_WITH_RC4_128_SHA"},
+	{0xc008, "TLS_ECDHE_ECDSA_WITH_3DES_EDE_CBC_SHA"},
+	{0xc009, "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA"},
+	{0xc00a, "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA"},
+	{0xc00b, "TLS_ECDH_RSA_WITH_NULL_SHA"},
+	{0xc00c, "TLS_ECDH_RSA_WITH_RC4_128_SHA"},
+	{0xc00d, "TLS_ECDH_RSA_WITH_3DES_EDE_CBC_SHA"},
+	{0xc00e, "TLS_ECDH_RSA_WITH_AES_128_CBC_SHA"},
+	{0xc00f, "TLS_ECDH_RSA_WITH_AES_256_CBC_SHA"},
+	{0xc010, "TLS_ECDHE_RSA_WITH_NULL_SHA"},
+	{0xc011, "TLS_ECDHE_RSA_WITH_RC4_128_SHA"},
+	{0xc012, "TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA"},
+	{0xc013, "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA"},
+	{0xc014, "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA"},
+	{0xc015, "TLS_ECDH_anon_WITH_NULL_SHA"},
+	{0xc016, "TLS_ECDH_anon_WITH_RC4_128_SHA"},
+	{0xc017, "TLS_ECDH_anon_WITH_3DES_EDE_CBC_SHA"},
+	{0xc018, "TLS_ECDH_anon_WITH_AES_128_CBC_SHA"},
+	{0xc019, "TLS_ECDH_anon_WITH_AES_256_CBC_SHA"},
+	{0xc023, "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256"},
+	{0xc024, "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA384"},
+	{0xc025, "TLS_ECDH_ECDSA_WITH_AES_128_CBC_SHA256"},
+	{0xc026, "TLS_ECDH_ECDSA_WITH_AES_256_CBC_SHA384"},
+	{0xc027, "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256"},
+	{0xc028, "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA384"},
+	{0xc029, "TLS_ECDH_RSA_WITH_AES_128_CBC_SHA256"},
+	{0xc02a, "TLS_ECDH_RSA_WITH_AES_256_CBC_SHA384"},
+	{0xc02b, "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+	{0xc02c, "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"},
+	{0xc02d, "TLS_ECDH_ECDSA_WITH_AES_128_GCM_SHA256"},
+	{0xc02e, "TLS_ECDH_ECDSA_WITH_AES_256_GCM_SHA384"},
+	{0xc02f, "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+	{0xc030, "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+	{0xc031, "TLS_ECDH_RSA_WITH_AES_128_GCM_SHA256"},
+	{0xc032, "TLS_ECDH_RSA_WITH_AES_256_GCM_SHA384"},
+	{0xc060, "TLS_ECDHE_RSA_WITH_ARIA_128_GCM_SHA256"},
+	{0xc061, "TLS_ECDHE_RSA_WITH_ARIA_256_GCM_SHA384"},
+	{0xc072, "TLS_ECDHE_ECDSA_WITH_CAMELLIA_128_CBC_SHA256"},
+	{0xc073, "TLS_ECDHE_ECDSA_WITH_CAMELLIA_256_CBC_SHA384"},
+	{0xc076, "TLS_ECDHE_RSA_WITH_CAMELLIA_128_CBC_SHA256"},
+	{0xc077, "TLS_ECDHE_RSA_WITH_CAMELLIA_256_CBC_SHA384"},
+	{0xc09c, "TLS_RSA_WITH_AES_128_CCM"},
+	{0xc09d, "TLS_RSA_WITH_AES_256_CCM"},
+	{0xc09e, "TLS_DHE_RSA_WITH_AES_128_CCM"},
+	{0xc09f, "TLS_DHE_RSA_WITH_AES_256_CCM"},
+	{0xc0a0, "TLS_RSA_WITH_AES_128_CCM_8"},
+	{0xc0a1, "TLS_RSA_WITH_AES_256_CCM_8"},
+	{0xc0a2, "TLS_DHE_RSA_WITH_AES_128_CCM_8"},
+	{0xc0a3, "TLS_DHE_RSA_WITH_AES_256_CCM_8"},
+	{0xc0ac, "TLS_ECDHE_ECDSA_WITH_AES_128_CCM"},
+	{0xc0ad, "TLS_ECDHE_ECDSA_WITH_AES_256_CCM"},
+	{0xc0ae, "TLS_ECDHE_ECDSA_WITH_AES_128_CCM_8"},
+	{0xc0af, "TLS_ECDHE_ECDSA_WITH_AES_256_CCM_8"},
+	{0xcc13, "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256_OLD"},
+	{0xcc14, "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256_OLD"},
+	{0xcc15, "TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256_OLD"},
+	{0xcca8, "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256"},
+	{0xcca9, "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256"},
+	{0xccaa, "TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256"},
+}
+
+// cipherSuiteName returns the IANA name of a cipher suite
+func cipherSuiteName(id uint16) string {
+	for _, suites := range [][]cipherSuite{tls13CipherSuites, legacyCipherSuites} {
+		for _, suite := range suites {
+			if suite.ID == id {
+				return suite.Name
+			}
+		}
+	}
+	return fmt.Sprintf("0x%04X", id)
+}
+
+func cipherSuiteIDs(suites []cipherSuite) []uint16 {
+	ids := make([]uint16, len(suites))
+	for i, suite := range suites {
+		ids[i] = suite.ID
+	}
+	return ids
+}
+
+// cipherStrength returns the effective symmetric key size of a suite in bits
+func cipherStrength(name string) int {
+	switch {
+	case strings.Contains(name, "_NULL_"):
+		return 0
+	case strings.Contains(name, "EXPORT"):
+		return 40
+	case strings.Contains(name, "_DES_CBC_"):
+		return 56
+	case strings.Contains(name, "3DES"):
+		return 112
+	case strings.Contains(name, "_256_"), strings.Contains(name, "CHACHA20"):
+		return 256
+	default:
+		return 128
+	}
+}
+
+// cipherForwardSecret reports whether the suite uses an ephemeral key exchange
+func cipherForwardSecret(id uint16, name string) bool {
+	return id>>8 == 0x13 || strings.Contains(name, "_DHE_") || strings.Contains(name, "_ECDHE_")
+}
+
+// cipherAEAD reports whether the suite uses authenticated encryption
+func cipherAEAD(name string) bool {
+	return strings.Contains(name, "GCM") || strings.Contains(name, "CHACHA20") || strings.Contains(name, "CCM")
+}
+
+// cipherInsecure reports suites that provide no or trivially broken protection
+func cipherInsecure(name string) bool {
+	return strings.Contains(name, "_NULL_") || strings.Contains(name, "EXPORT") || strings.Contains(name, "_anon_")
+}
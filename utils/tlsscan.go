@@ -0,0 +1,506 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+// tlsScanTimeout bounds every connection made by the local TLS scanner
+const tlsScanTimeout = 5 * time.Second
+
+// TLSProtocolResult holds the cipher suites accepted for a single protocol version
+type TLSProtocolResult struct {
+	Version          uint16
+	Supported        bool
+	Ciphers          []uint16
+	ServerPreference bool
+}
+
+// TLSScanResult is the outcome of a local TLS scan of a single service
+type TLSScanResult struct {
+	Host              string
+	Port              string
+	Protocols         []TLSProtocolResult
+	Groups            []string
+	OCSPStapling      bool
+	SessionResumption bool
+	ALPN              []string
+	JARM              string
+	Certificate       *x509.Certificate
+	CertificateErr    error
+	Score             int
+	Grade             string
+	GradeReasons      []string
+}
+
+// scannedVersions lists the protocol versions probed, oldest first
+var scannedVersions = []uint16{versionSSL30, versionTLS10, versionTLS11, versionTLS12, versionTLS13}
+
+// GetTLSScanReport runs the local TLS scanner against port 443 of every address of a domain or network target
+func GetTLSScanReport(domain string) (string, error) {
+	targets, err := TLSTarget{Host: domain, Port: "443", ServerName: domain}.AddressTargets()
+	if err != nil {
+		return "", err
+	}
+	return reportEachTarget(targets, func(target TLSTarget) (string, error) {
+		result, err := ScanTLS(target)
+		if err != nil {
+			return "", err
+		}
+		return FormatTLSScanResult(result), nil
+	})
+}
+
+// ScanTLS enumerates protocol versions, cipher suites, key exchange groups and TLS features of a service
+func ScanTLS(target TLSTarget) (*TLSScanResult, error) {
+	conn, err := target.dial(tlsScanTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.Close()
+
+	result := &TLSScanResult{Host: target.Host, Port: target.Port}
+	result.Protocols = make([]TLSProtocolResult, len(scannedVersions))
+
+	var wg sync.WaitGroup
+	for i, version := range scannedVersions {
+		wg.Add(1)
+		go func(i int, version uint16) {
+			defer wg.Done()
+			result.Protocols[i] = enumerateCipherSuites(target, version)
+		}(i, version)
+	}
+	wg.Wait()
+
+	result.Groups = enumerateGroups(target, result.Protocols)
+	probeTLSFeatures(target, result)
+	result.JARM, _ = JARMFingerprint(target)
+	gradeTLSScan(result)
+	return result, nil
+}
+
+// helloForVersion builds a ClientHello that only allows the given version
+func helloForVersion(version uint16, serverName string, ciphers []uint16) *clientHelloSpec {
+	spec := &clientHelloSpec{Version: version, Ciphers: ciphers, ServerName: serverName}
+	switch version {
+	case versionSSL30:
+		spec.NoExtensions = true
+	case versionTLS13:
+		spec.Version = versionTLS12
+		spec.SupportedVersions = []uint16{versionTLS13}
+		spec.KeyShares = []uint16{groupX25519}
+	}
+	return spec
+}
+
+// enumerateCipherSuites offers all known suites for a version and removes the selected one until the server refuses
+func enumerateCipherSuites(target TLSTarget, version uint16) TLSProtocolResult {
+	result := TLSProtocolResult{Version: version}
+
+	suites := legacyCipherSuites
+	if version == versionTLS13 {
+		suites = tls13CipherSuites
+	}
+	remaining := cipherSuiteIDs(suites)
+
+	for len(remaining) > 0 {
+		hello, err := sendClientHello(target, helloForVersion(version, target.ServerName, remaining), tlsScanTimeout)
+		if err != nil || hello.negotiatedVersion() != version {
+			break
+		}
+		index := indexOfUint16(remaining, hello.CipherSuite)
+		if index < 0 {
+			break
+		}
+		result.Supported = true
+		result.Ciphers = append(result.Ciphers, hello.CipherSuite)
+		remaining = append(remaining[:index:index], remaining[index+1:]...)
+	}
+
+	// The server has a preference when it picks the same suite regardless of the client order
+	if len(result.Ciphers) > 1 {
+		reversed := make([]uint16, len(result.Ciphers))
+		for i, id := range result.Ciphers {
+			reversed[len(reversed)-1-i] = id
+		}
+		hello, err := sendClientHello(target, helloForVersion(version, target.ServerName, reversed), tlsScanTimeout)
+		result.ServerPreference = err == nil && hello.CipherSuite == result.Ciphers[0]
+	}
+	return result
+}
+
+// enumerateGroups checks which named groups the server accepts for key exchange
+func enumerateGroups(target TLSTarget, protocols []TLSProtocolResult) []string {
+	// Groups are probed with TLS 1.3 when available, otherwise with the newest legacy version that has extensions
+	var supportsTLS13 bool
+	var legacyVersion uint16
+	for _, protocol := range protocols {
+		if !protocol.Supported {
+			continue
+		}
+		if protocol.Version == versionTLS13 {
+			supportsTLS13 = true
+		} else if protocol.Version > versionSSL30 && protocol.Version > legacyVersion {
+			legacyVersion = protocol.Version
+		}
+	}
+
+	var ecdheSuites []uint16
+	for _, suite := range legacyCipherSuites {
+		if strings.Contains(suite.Name, "_ECDHE_") {
+			ecdheSuites = append(ecdheSuites, suite.ID)
+		}
+	}
+
+	candidates := []uint16{groupX25519, groupSecp256r1, groupSecp384r1, groupSecp521r1, groupX448, groupFFDHE2048, groupFFDHE3072, groupFFDHE4096, groupMLKEM768}
+	var groups []string
+	for _, group := range candidates {
+		switch {
+		case supportsTLS13:
+			// Without a matching key share the server answers with a HelloRetryRequest naming the group
+			spec := helloForVersion(versionTLS13, target.ServerName, cipherSuiteIDs(tls13CipherSuites))
+			spec.Groups = []uint16{group}
+			spec.KeyShares = []uint16{group}
+			hello, err := sendClientHello(target, spec, tlsScanTimeout)
+			if err != nil {
+				continue
+			}
+			if selected, ok := hello.selectedGroup(); ok && selected == group {
+				groups = append(groups, groupNames[group])
+			}
+		case legacyVersion != 0 && group < groupFFDHE2048:
+			spec := helloForVersion(legacyVersion, target.ServerName, ecdheSuites)
+			spec.Groups = []uint16{group}
+			hello, err := sendClientHello(target, spec, tlsScanTimeout)
+			if err == nil && indexOfUint16(ecdheSuites, hello.CipherSuite) >= 0 {
+				groups = append(groups, groupNames[group])
+			}
+		}
+	}
+	return groups
+}
+
+// probeTLSFeatures uses complete handshakes to check OCSP stapling, session resumption, ALPN and the certificate
+func probeTLSFeatures(target TLSTarget, result *TLSScanResult) {
+	config := &tls.Config{
+		ServerName:         target.ServerName,
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS10,
+		ClientSessionCache: tls.NewLRUClientSessionCache(1),
+	}
+
+	conn, err := target.dialTLS(config, tlsScanTimeout)
+	if err != nil {
+		result.CertificateErr = err
+		return
+	}
+	state := conn.ConnectionState()
+	result.OCSPStapling = len(state.OCSPResponse) > 0
+	if len(state.PeerCertificates) > 0 {
+		result.Certificate = state.PeerCertificates[0]
+		result.CertificateErr = VerifyCertificateChain(state.PeerCertificates, target.ServerName).firstError()
+	}
+	// TLS 1.3 tickets arrive after the handshake and are only processed while reading
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	conn.Read(make([]byte, 1))
+	conn.Close()
+
+	if conn, err := target.dialTLS(config, tlsScanTimeout); err == nil {
+		result.SessionResumption = conn.ConnectionState().DidResume
+		conn.Close()
+	}
+
+	for _, proto := range []string{"h2", "http/1.1"} {
+		alpnConfig := &tls.Config{ServerName: target.ServerName, InsecureSkipVerify: true, MinVersion: tls.VersionTLS10, NextProtos: []string{proto}}
+		if conn, err := target.dialTLS(alpnConfig, tlsScanTimeout); err == nil {
+			if conn.ConnectionState().NegotiatedProtocol == proto {
+				result.ALPN = append(result.ALPN, proto)
+			}
+			conn.Close()
+		}
+	}
+}
+
+// firstError returns the chain or hostname error of a report, if any
+func (report ChainReport) firstError() error {
+	if report.VerifyErr != nil {
+		return report.VerifyErr
+	}
+	return report.HostnameErr
+}
+
+// gradeTLSScan grades the scan from A to F, following the SSL Labs Server Rating Guide:
+//
+//	score = 30% protocol + 30% key exchange + 40% cipher strength
+//	protocol:     SSLv3 80, TLS 1.0 90, TLS 1.1 95, TLS 1.2/1.3 100, averaged over best and worst
+//	key exchange: certificate key < 1024 bits 40, < 2048 80, < 4096 90, otherwise 100 (ECDSA and Ed25519 use RSA equivalents)
+//	cipher:       0 bits 0, < 128 20, < 256 80, 256 100, averaged over strongest and weakest
+//	letter:       A >= 80, B >= 65, C >= 50, D >= 35, E >= 20, otherwise F
+//
+// The letter is then capped:
+//
+//	F: export, NULL or anonymous suites, a key below 1024 bits, an untrusted certificate or no working protocol
+//	C: SSLv3, RC4 or no TLS 1.2 support
+//	B: TLS 1.0/1.1, 64-bit block ciphers (DES/3DES), no forward secrecy, a key below 2048 bits or no AEAD suites
+func gradeTLSScan(result *TLSScanResult) {
+	protocolScores := map[uint16]int{versionSSL30: 80, versionTLS10: 90, versionTLS11: 95, versionTLS12: 100, versionTLS13: 100}
+
+	best, worst := -1, -1
+	strongest, weakest := -1, -1
+	var supportsTLS12, forwardSecrecy, aead bool
+	caps := map[string][]string{}
+
+	for _, protocol := range result.Protocols {
+		if !protocol.Supported {
+			continue
+		}
+		score := protocolScores[protocol.Version]
+		if best < 0 || score > best {
+			best = score
+		}
+		if worst < 0 || score < worst {
+			worst = score
+		}
+		switch protocol.Version {
+		case versionSSL30:
+			caps["C"] = append(caps["C"], "SSLv3 supported")
+		case versionTLS10, versionTLS11:
+			caps["B"] = append(caps["B"], versionNames[protocol.Version]+" supported")
+		case versionTLS12, versionTLS13:
+			supportsTLS12 = true
+		}
+
+		for _, id := range protocol.Ciphers {
+			name := cipherSuiteName(id)
+			bits := cipherStrength(name)
+			if strongest < 0 || bits > strongest {
+				strongest = bits
+			}
+			if weakest < 0 || bits < weakest {
+				weakest = bits
+			}
+			if cipherForwardSecret(id, name) {
+				forwardSecrecy = true
+			}
+			if cipherAEAD(name) {
+				aead = true
+			}
+			switch {
+			case cipherInsecure(name):
+				caps["F"] = append(caps["F"], name+" accepted")
+			case strings.Contains(name, "RC4"):
+				caps["C"] = append(caps["C"], name+" accepted")
+			case strings.Contains(name, "DES"):
+				caps["B"] = append(caps["B"], name+" accepted")
+			}
+		}
+	}
+
+	if best < 0 {
+		result.Grade = "F"
+		result.GradeReasons = []string{"no supported protocol"}
+		return
+	}
+	if !supportsTLS12 {
+		caps["C"] = append(caps["C"], "TLS 1.2 not supported")
+	}
+	if !forwardSecrecy {
+		caps["B"] = append(caps["B"], "no forward secrecy")
+	}
+	if !aead {
+		caps["B"] = append(caps["B"], "no AEAD cipher suites")
+	}
+
+	keyScore := 0
+	if result.Certificate != nil {
+		keyType, bits := describePublicKey(result.Certificate)
+		if strings.HasPrefix(keyType, "ECDSA") || keyType == "Ed25519" {
+			bits = rsaEquivalentBits(bits)
+		}
+		switch {
+		case bits < 1024:
+			keyScore = 40
+			caps["F"] = append(caps["F"], fmt.Sprintf("%s key of %d bits", keyType, bits))
+		case bits < 2048:
+			keyScore = 80
+			caps["B"] = append(caps["B"], fmt.Sprintf("%s key of %d bits", keyType, bits))
+		case bits < 4096:
+			keyScore = 90
+		default:
+			keyScore = 100
+		}
+	}
+	if result.CertificateErr != nil {
+		caps["F"] = append(caps["F"], "certificate problem: "+result.CertificateErr.Error())
+	}
+
+	cipherScore := (cipherStrengthScore(strongest) + cipherStrengthScore(weakest)) / 2
+	result.Score = (30*(best+worst)/2 + 30*keyScore + 40*cipherScore) / 100
+
+	switch {
+	case result.Score >= 80:
+		result.Grade = "A"
+	case result.Score >= 65:
+		result.Grade = "B"
+	case result.Score >= 50:
+		result.Grade = "C"
+	case result.Score >= 35:
+		result.Grade = "D"
+	case result.Score >= 20:
+		result.Grade = "E"
+	default:
+		result.Grade = "F"
+	}
+
+	for _, letter := range []string{"F", "C", "B"} {
+		if len(caps[letter]) == 0 {
+			continue
+		}
+		if result.Grade < letter {
+			result.Grade = letter
+		}
+		for _, reason := range caps[letter] {
+			result.GradeReasons = append(result.GradeReasons, fmt.Sprintf("capped at %s: %s", letter, reason))
+		}
+	}
+}
+
+func cipherStrengthScore(bits int) int {
+	switch {
+	case bits <= 0:
+		return 0
+	case bits < 128:
+		return 20
+	case bits < 256:
+		return 80
+	default:
+		return 100
+	}
+}
+
+// rsaEquivalentBits maps elliptic curve key sizes to comparable RSA sizes (NIST SP 800-57)
+func rsaEquivalentBits(bits int) int {
+	switch {
+	case bits >= 512:
+		return 15360
+	case bits >= 384:
+		return 7680
+	case bits >= 256:
+		return 3072
+	case bits >= 224:
+		return 2048
+	default:
+		return 1024
+	}
+}
+
+func indexOfUint16(list []uint16, value uint16) int {
+	for i, v := range list {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// FormatTLSScanResult renders a local TLS scan result
+func FormatTLSScanResult(result *TLSScanResult) string {
+	var sb strings.Builder
+	sb.WriteString(color.New(color.FgYellow, color.Bold).Sprintf("\nTLS Scan for %s:\n", net.JoinHostPort(result.Host, result.Port)))
+
+	gradeColor := color.GreenString
+	switch result.Grade {
+	case "B", "C":
+		gradeColor = color.YellowString
+	case "D", "E", "F":
+		gradeColor = color.RedString
+	}
+	sb.WriteString(fmt.Sprintf("%s %s (score %d)\n", color.New(color.FgYellow, color.Bold).Sprint("Grade:"), gradeColor(result.Grade), result.Score))
+	for _, reason := range result.GradeReasons {
+		sb.WriteString("  - " + reason + "\n")
+	}
+
+	sb.WriteString(color.New(color.FgYellow, color.Bold).Sprint("\nProtocols:\n"))
+	for i := len(result.Protocols) - 1; i >= 0; i-- {
+		protocol := result.Protocols[i]
+		status := color.RedString("No")
+		if protocol.Supported {
+			status = color.GreenString("Yes")
+			if protocol.Version < versionTLS12 {
+				status = color.RedString("Yes")
+			}
+		}
+		sb.WriteString(fmt.Sprintf("  %-8s %s\n", versionNames[protocol.Version], status))
+	}
+
+	for i := len(result.Protocols) - 1; i >= 0; i-- {
+		protocol := result.Protocols[i]
+		if !protocol.Supported {
+			continue
+		}
+		preference := "client order"
+		if protocol.ServerPreference {
+			preference = "server preference"
+		}
+		sb.WriteString(color.New(color.FgYellow, color.Bold).Sprintf("\nCipher Suites (%s, %s):\n", versionNames[protocol.Version], preference))
+
+		table := tablewriter.NewWriter(&sb)
+		table.SetHeader([]string{"Cipher Suite", "Bits", "Forward Secrecy", "Status"})
+		table.SetBorder(false)
+		table.SetAutoWrapText(false)
+		for _, id := range protocol.Ciphers {
+			name := cipherSuiteName(id)
+			status := color.GreenString("Strong")
+			switch {
+			case cipherInsecure(name), strings.Contains(name, "RC4"):
+				status = color.RedString("Insecure")
+			case strings.Contains(name, "DES"), !cipherForwardSecret(id, name), !cipherAEAD(name):
+				status = color.YellowString("Weak")
+			}
+			fs := "No"
+			if cipherForwardSecret(id, name) {
+				fs = "Yes"
+			}
+			table.Append([]string{name, fmt.Sprint(cipherStrength(name)), fs, status})
+		}
+		table.Render()
+	}
+
+	groups := append([]string(nil), result.Groups...)
+	sort.Strings(groups)
+	if len(groups) == 0 {
+		groups = []string{"None detected"}
+	}
+	alpn := result.ALPN
+	if len(alpn) == 0 {
+		alpn = []string{"None"}
+	}
+
+	sb.WriteString(color.New(color.FgYellow, color.Bold).Sprint("\nFeatures:\n"))
+	sb.WriteString(fmt.Sprintf("  %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Key Exchange Groups:"), strings.Join(groups, ", ")))
+	sb.WriteString(fmt.Sprintf("  %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("OCSP Stapling:"), yesNo(result.OCSPStapling)))
+	sb.WriteString(fmt.Sprintf("  %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Session Resumption (tickets):"), yesNo(result.SessionResumption)))
+	sb.WriteString(fmt.Sprintf("  %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("ALPN:"), strings.Join(alpn, ", ")))
+	sb.WriteString(fmt.Sprintf("  %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("JARM:"), result.JARM))
+	if result.CertificateErr != nil {
+		sb.WriteString(fmt.Sprintf("  %s %s\n", color.New(color.FgYellow, color.Bold).Sprint("Certificate:"), color.RedString("%v", result.CertificateErr)))
+	}
+
+	return sb.String()
+}
+
+func yesNo(value bool) string {
+	if value {
+		return color.GreenString("Yes")
+	}
+	return color.RedString("No")
+}
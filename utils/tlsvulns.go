@@ -0,0 +1,797 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+// VulnStatus is the outcome of a single vulnerability probe
+type VulnStatus int
+
+const (
+	VulnInconclusive VulnStatus = iota
+	VulnNotVulnerable
+	VulnVulnerable
+	VulnNotApplicable
+)
+
+func (s VulnStatus) String() string {
+	switch s {
+	case VulnVulnerable:
+		return "Vulnerable"
+	case VulnNotVulnerable:
+		return "Not vulnerable"
+	case VulnNotApplicable:
+		return "Not applicable"
+	default:
+		return "Inconclusive"
+	}
+}
+
+// TLSVulnResult is the result of one vulnerability probe
+type TLSVulnResult struct {
+	Name   string
+	Status VulnStatus
+	Detail string
+}
+
+// tlsVulnTimeout bounds every read in the probes, a silent server is treated as not answering
+const tlsVulnTimeout = 5 * time.Second
+
+// rsaKeyExchangeSuites are the static RSA suites needed to build a Bleichenbacher oracle
+var rsaKeyExchangeSuites = []uint16{0x002f, 0x0035, 0x003c, 0x003d, 0x009c, 0x009d, 0x000a}
+
+// GetTLSVulnerabilityReport runs all vulnerability probes against port 443 of every address of a domain or network target
+func GetTLSVulnerabilityReport(domain string) (string, error) {
+	targets, err := TLSTarget{Host: domain, Port: "443", ServerName: domain}.AddressTargets()
+	if err != nil {
+		return "", err
+	}
+	return reportEachTarget(targets, func(target TLSTarget) (string, error) {
+		results, err := CheckTLSVulnerabilities(target)
+		if err != nil {
+			return "", err
+		}
+		return FormatTLSVulnResults(target.String(), results), nil
+	})
+}
+
+// CheckTLSVulnerabilities runs the Heartbleed, CCS injection, renegotiation, fallback, compression and ROBOT probes
+func CheckTLSVulnerabilities(target TLSTarget) ([]TLSVulnResult, error) {
+	version, err := highestLegacyVersion(target)
+	if err != nil {
+		if !supportsTLS13(target) {
+			return nil, fmt.Errorf("no SSLv3 to TLS 1.2 handshake possible: %v", err)
+		}
+		// The other probes attack SSLv3 to TLS 1.2 handshakes, which a TLS 1.3-only server never completes
+		notApplicable := func(name string) TLSVulnResult {
+			return TLSVulnResult{Name: name, Status: VulnNotApplicable, Detail: "only TLS 1.3 supported"}
+		}
+		return []TLSVulnResult{
+			notApplicable("Heartbleed (CVE-2014-0160)"),
+			notApplicable("OpenSSL CCS Injection (CVE-2014-0224)"),
+			notApplicable("Insecure Client-Initiated Renegotiation"),
+			ProbeFallbackSCSV(target),
+			notApplicable("TLS Compression (CRIME)"),
+			notApplicable("ROBOT (Bleichenbacher oracle)"),
+		}, nil
+	}
+
+	return []TLSVulnResult{
+		ProbeHeartbleed(target, version),
+		ProbeCCSInjection(target, version),
+		ProbeRenegotiation(target),
+		ProbeFallbackSCSV(target),
+		ProbeCompression(target, version),
+		ProbeROBOT(target, version),
+	}, nil
+}
+
+// supportsTLS13 tells whether the server negotiates TLS 1.3
+func supportsTLS13(target TLSTarget) bool {
+	hello, err := sendClientHello(target, helloForVersion(versionTLS13, target.ServerName, cipherSuiteIDs(tls13CipherSuites)), tlsVulnTimeout)
+	return err == nil && hello.negotiatedVersion() == versionTLS13
+}
+
+// highestLegacyVersion returns the newest pre-TLS 1.3 version the server negotiates
+func highestLegacyVersion(target TLSTarget) (uint16, error) {
+	var lastErr error
+	for _, version := range []uint16{versionTLS12, versionTLS11, versionTLS10, versionSSL30} {
+		hello, err := sendClientHello(target, helloForVersion(version, target.ServerName, cipherSuiteIDs(legacyCipherSuites)), tlsVulnTimeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if hello.Version == version {
+			return version, nil
+		}
+	}
+	return 0, lastErr
+}
+
+// serverFlight holds the server messages that follow the ServerHello up to ServerHelloDone
+type serverFlight struct {
+	Hello             *serverHello
+	Certificates      []*x509.Certificate
+	ServerKeyExchange []byte
+	CertRequested     bool
+	Transcript        []byte
+}
+
+// startHandshake sends a ClientHello and reads the server flight up to ServerHelloDone
+func (c *rawTLSConn) startHandshake(spec *clientHelloSpec) (*serverFlight, error) {
+	clientHello := spec.marshal()
+	if err := c.writeRecord(recordTypeHandshake, recordVersionFor(spec), clientHello); err != nil {
+		return nil, err
+	}
+
+	flight := &serverFlight{Transcript: append([]byte(nil), clientHello...)}
+	for {
+		typ, msg, err := c.readHandshake()
+		if err != nil {
+			return nil, err
+		}
+		flight.Transcript = append(flight.Transcript, msg...)
+		body := msg[4:]
+
+		switch typ {
+		case handshakeTypeServerHello:
+			if flight.Hello, err = parseServerHello(msg); err != nil {
+				return nil, err
+			}
+		case handshakeTypeCertificate:
+			flight.Certificates = parseCertificateMessage(body)
+		case handshakeTypeServerKeyExchange:
+			flight.ServerKeyExchange = body
+		case handshakeTypeCertificateReq:
+			flight.CertRequested = true
+		case handshakeTypeServerHelloDone:
+			if flight.Hello == nil {
+				return nil, fmt.Errorf("ServerHelloDone without ServerHello")
+			}
+			return flight, nil
+		}
+	}
+}
+
+// parseCertificateMessage decodes the certificate list of a TLS 1.2 Certificate message
+func parseCertificateMessage(body []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	if len(body) < 3 {
+		return nil
+	}
+	body = body[3:]
+	for len(body) >= 3 {
+		length := int(body[0])<<16 | int(body[1])<<8 | int(body[2])
+		if len(body) < 3+length {
+			break
+		}
+		if cert, err := x509.ParseCertificate(body[3 : 3+length]); err == nil {
+			certs = append(certs, cert)
+		}
+		body = body[3+length:]
+	}
+	return certs
+}
+
+// ProbeHeartbleed sends a heartbeat request that claims a larger payload than it carries (CVE-2014-0160)
+func ProbeHeartbleed(target TLSTarget, version uint16) TLSVulnResult {
+	result := TLSVulnResult{Name: "Heartbleed (CVE-2014-0160)"}
+
+	conn, err := dialRawTLS(target, tlsVulnTimeout)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	defer conn.Close()
+
+	spec := helloForVersion(version, target.ServerName, cipherSuiteIDs(legacyCipherSuites))
+	spec.Heartbeat = true
+	flight, err := conn.startHandshake(spec)
+	if err != nil {
+		result.Detail = "handshake failed: " + err.Error()
+		return result
+	}
+	if _, ok := flight.Hello.Extensions[extHeartbeat]; !ok {
+		result.Status = VulnNotVulnerable
+		result.Detail = "heartbeat extension not supported"
+		return result
+	}
+
+	// heartbeat_request with payload_length 16384 and no payload
+	if err := conn.writeRecord(recordTypeHeartbeat, version, []byte{1, 0x40, 0x00}); err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+
+	for {
+		typ, _, payload, err := conn.readRecord()
+		if err != nil {
+			result.Status = VulnNotVulnerable
+			result.Detail = "no heartbeat response"
+			return result
+		}
+		switch typ {
+		case recordTypeHeartbeat:
+			if len(payload) > 3 {
+				result.Status = VulnVulnerable
+				result.Detail = fmt.Sprintf("server returned %d bytes of memory", len(payload))
+			} else {
+				result.Status = VulnNotVulnerable
+				result.Detail = "empty heartbeat response"
+			}
+			return result
+		case recordTypeAlert:
+			result.Status = VulnNotVulnerable
+			result.Detail = "malformed heartbeat rejected with an alert"
+			return result
+		}
+	}
+}
+
+// ProbeCCSInjection sends ChangeCipherSpec before the key exchange (CVE-2014-0224)
+func ProbeCCSInjection(target TLSTarget, version uint16) TLSVulnResult {
+	result := TLSVulnResult{Name: "OpenSSL CCS Injection (CVE-2014-0224)"}
+
+	conn, err := dialRawTLS(target, tlsVulnTimeout)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	defer conn.Close()
+
+	if _, err := conn.startHandshake(helloForVersion(version, target.ServerName, cipherSuiteIDs(legacyCipherSuites))); err != nil {
+		result.Detail = "handshake failed: " + err.Error()
+		return result
+	}
+
+	// A patched server rejects the early CCS with unexpected_message
+	conn.writeRecord(recordTypeChangeCipherSpec, version, []byte{1})
+	response := readAlertOrTimeout(conn)
+	switch {
+	case response == "alert:10":
+		result.Status = VulnNotVulnerable
+		result.Detail = "early ChangeCipherSpec rejected"
+		return result
+	case strings.HasPrefix(response, "alert:"), response == "closed":
+		result.Status = VulnNotVulnerable
+		result.Detail = "early ChangeCipherSpec rejected (" + response + ")"
+		return result
+	}
+
+	// A vulnerable server silently switched to keys derived from an empty master secret, so the next record fails to decrypt
+	conn.writeRecord(recordTypeChangeCipherSpec, version, []byte{1})
+	response = readAlertOrTimeout(conn)
+	switch response {
+	case "alert:20", "alert:21", "alert:51":
+		result.Status = VulnVulnerable
+		result.Detail = "early ChangeCipherSpec accepted"
+	default:
+		result.Detail = "server did not answer the early ChangeCipherSpec (" + response + ")"
+	}
+	return result
+}
+
+// readAlertOrTimeout waits for the next record and summarizes it as alert:<description>, closed, timeout or record:<type>
+func readAlertOrTimeout(conn *rawTLSConn) string {
+	typ, _, payload, err := conn.readRecord()
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return "timeout"
+		}
+		return "closed"
+	}
+	if typ == recordTypeAlert && len(payload) >= 2 {
+		return fmt.Sprintf("alert:%d", payload[1])
+	}
+	return fmt.Sprintf("record:%d", typ)
+}
+
+// ProbeCompression checks whether the server accepts TLS level DEFLATE compression (CRIME)
+func ProbeCompression(target TLSTarget, version uint16) TLSVulnResult {
+	result := TLSVulnResult{Name: "TLS Compression (CRIME)"}
+
+	spec := helloForVersion(version, target.ServerName, cipherSuiteIDs(legacyCipherSuites))
+	spec.Compression = []byte{1, 0}
+	hello, err := sendClientHello(target, spec, tlsVulnTimeout)
+	if err != nil {
+		result.Detail = "handshake failed: " + err.Error()
+		return result
+	}
+	if hello.Compression == 1 {
+		result.Status = VulnVulnerable
+		result.Detail = "DEFLATE compression selected"
+	} else {
+		result.Status = VulnNotVulnerable
+		result.Detail = "compression not supported"
+	}
+	return result
+}
+
+// ProbeFallbackSCSV offers a lower version with TLS_FALLBACK_SCSV, which a protected server rejects with inappropriate_fallback
+func ProbeFallbackSCSV(target TLSTarget) TLSVulnResult {
+	result := TLSVulnResult{Name: "Downgrade protection (TLS_FALLBACK_SCSV)"}
+
+	highest, err := highestLegacyVersion(target)
+	tls13 := supportsTLS13(target)
+	switch {
+	case tls13 && err != nil:
+		result.Status = VulnNotVulnerable
+		result.Detail = "only TLS 1.3 supported, no downgrade possible"
+		return result
+	case tls13:
+		highest = versionTLS13
+	case err != nil:
+		result.Detail = "handshake failed: " + err.Error()
+		return result
+	}
+	if highest == versionSSL30 {
+		result.Status = VulnNotVulnerable
+		result.Detail = "only SSLv3 supported, no downgrade possible"
+		return result
+	}
+
+	lower := highest - 1
+	spec := helloForVersion(lower, target.ServerName, append(cipherSuiteIDs(legacyCipherSuites), 0x5600))
+	hello, err := sendClientHello(target, spec, tlsVulnTimeout)
+	var alert *tlsAlert
+	switch {
+	case errors.As(err, &alert) && alert.Description == 86:
+		result.Status = VulnNotVulnerable
+		result.Detail = "inappropriate_fallback returned for " + versionNames[lower]
+	case errors.As(err, &alert):
+		result.Status = VulnNotVulnerable
+		result.Detail = fmt.Sprintf("%s rejected (%s), no downgrade possible", versionNames[lower], alert)
+	case err != nil:
+		// A timeout or reset says nothing about the version
+		result.Detail = versionNames[lower] + " handshake failed: " + err.Error()
+	case hello.Version == lower:
+		result.Status = VulnVulnerable
+		result.Detail = fmt.Sprintf("fallback to %s accepted although %s is supported", versionNames[lower], versionNames[highest])
+	default:
+		result.Detail = "unexpected version " + versionNames[hello.Version]
+	}
+	return result
+}
+
+// ProbeRenegotiation completes a TLS 1.2 handshake and then asks for a renegotiation
+func ProbeRenegotiation(target TLSTarget) TLSVulnResult {
+	result := TLSVulnResult{Name: "Insecure Client-Initiated Renegotiation"}
+
+	session, err := dialTLS12Session(target)
+	if err != nil {
+		result.Detail = "could not complete a TLS 1.2 ECDHE handshake: " + err.Error()
+		return result
+	}
+	defer session.conn.Close()
+
+	secure := "secure renegotiation (RFC 5746) not supported"
+	if session.secureRenegotiation {
+		secure = "secure renegotiation (RFC 5746) supported"
+	}
+
+	spec := &clientHelloSpec{
+		Version:           versionTLS12,
+		Ciphers:           tls12SessionSuites,
+		ServerName:        target.ServerName,
+		Groups:            []uint16{groupX25519},
+		RenegotiationInfo: session.clientVerifyData,
+		NoRenegotiation:   !session.secureRenegotiation,
+	}
+	if err := session.writeEncrypted(recordTypeHandshake, spec.marshal()); err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+
+	typ, payload, err := session.readEncrypted()
+	switch {
+	case err != nil:
+		result.Status = VulnNotVulnerable
+		result.Detail = "renegotiation refused (connection closed), " + secure
+	case typ == recordTypeHandshake && len(payload) > 0 && payload[0] == handshakeTypeServerHello:
+		if session.secureRenegotiation {
+			result.Status = VulnNotVulnerable
+			result.Detail = "client-initiated renegotiation allowed (DoS risk), " + secure
+		} else {
+			result.Status = VulnVulnerable
+			result.Detail = "client-initiated renegotiation allowed, " + secure
+		}
+	case typ == recordTypeAlert && len(payload) >= 2:
+		result.Status = VulnNotVulnerable
+		result.Detail = fmt.Sprintf("renegotiation refused (%v), %s", &tlsAlert{Level: payload[0], Description: payload[1]}, secure)
+	default:
+		result.Detail = fmt.Sprintf("unexpected record type %d, %s", typ, secure)
+	}
+	return result
+}
+
+// tls12SessionSuites are the ECDHE AES-128-GCM suites implemented by the minimal TLS 1.2 client
+var tls12SessionSuites = []uint16{0xc02f, 0xc02b}
+
+// tls12Session is a minimal TLS 1.2 client used by probes that need an established connection
+type tls12Session struct {
+	conn                *rawTLSConn
+	clientAEAD          cipher.AEAD
+	serverAEAD          cipher.AEAD
+	clientIV, serverIV  []byte
+	clientSeq           uint64
+	serverSeq           uint64
+	clientVerifyData    []byte
+	secureRenegotiation bool
+}
+
+// dialTLS12Session runs a full ECDHE handshake with AES-128-GCM
+func dialTLS12Session(target TLSTarget) (*tls12Session, error) {
+	conn, err := dialRawTLS(target, tlsVulnTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &clientHelloSpec{
+		Version:    versionTLS12,
+		Ciphers:    tls12SessionSuites,
+		ServerName: target.ServerName,
+		Groups:     []uint16{groupX25519, groupSecp256r1, groupSecp384r1},
+	}
+	flight, err := conn.startHandshake(spec)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if flight.CertRequested {
+		conn.Close()
+		return nil, fmt.Errorf("server requires a client certificate")
+	}
+	if flight.Hello.Version != versionTLS12 || indexOfUint16(tls12SessionSuites, flight.Hello.CipherSuite) < 0 {
+		conn.Close()
+		return nil, fmt.Errorf("server did not select TLS 1.2 with ECDHE AES-128-GCM")
+	}
+
+	// ServerKeyExchange: curve_type(1)=named_curve || group(2) || public key
+	ske := flight.ServerKeyExchange
+	if len(ske) < 4 || ske[0] != 3 || len(ske) < 4+int(ske[3]) {
+		conn.Close()
+		return nil, fmt.Errorf("unsupported ServerKeyExchange")
+	}
+	group := binary.BigEndian.Uint16(ske[1:3])
+	serverPublic := ske[4 : 4+int(ske[3])]
+
+	curves := map[uint16]ecdh.Curve{groupX25519: ecdh.X25519(), groupSecp256r1: ecdh.P256(), groupSecp384r1: ecdh.P384()}
+	curve, ok := curves[group]
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("unsupported group 0x%04x", group)
+	}
+	private, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	peer, err := curve.NewPublicKey(serverPublic)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	preMaster, err := private.ECDH(peer)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	publicKey := private.PublicKey().Bytes()
+	clientKeyExchange := wrapHandshake(handshakeTypeClientKeyExchange, append([]byte{byte(len(publicKey))}, publicKey...))
+	transcript := append(flight.Transcript, clientKeyExchange...)
+
+	seed := append(append([]byte(nil), spec.Random...), flight.Hello.Random...)
+	master := tls12PRF(preMaster, "master secret", seed, 48)
+	keySeed := append(append([]byte(nil), flight.Hello.Random...), spec.Random...)
+	keyBlock := tls12PRF(master, "key expansion", keySeed, 2*16+2*4)
+
+	session := &tls12Session{
+		conn:     conn,
+		clientIV: keyBlock[32:36],
+		serverIV: keyBlock[36:40],
+	}
+	_, session.secureRenegotiation = flight.Hello.Extensions[extRenegotiationInfo]
+	if session.clientAEAD, err = newGCM(keyBlock[0:16]); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if session.serverAEAD, err = newGCM(keyBlock[16:32]); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	transcriptHash := sha256.Sum256(transcript)
+	session.clientVerifyData = tls12PRF(master, "client finished", transcriptHash[:], 12)
+
+	if err := conn.writeRecord(recordTypeHandshake, versionTLS12, clientKeyExchange); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.writeRecord(recordTypeChangeCipherSpec, versionTLS12, []byte{1}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := session.writeEncrypted(recordTypeHandshake, wrapHandshake(handshakeTypeFinished, session.clientVerifyData)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Server ChangeCipherSpec followed by its encrypted Finished, skipping a NewSessionTicket if one is sent
+	for {
+		typ, _, payload, err := conn.readRecord()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if typ == recordTypeAlert {
+			conn.Close()
+			if len(payload) < 2 {
+				return nil, fmt.Errorf("malformed alert")
+			}
+			return nil, &tlsAlert{Level: payload[0], Description: payload[1]}
+		}
+		if typ == recordTypeChangeCipherSpec {
+			break
+		}
+	}
+	typ, payload, err := session.readEncrypted()
+	if err != nil || typ != recordTypeHandshake || len(payload) == 0 || payload[0] != handshakeTypeFinished {
+		conn.Close()
+		return nil, fmt.Errorf("server Finished not received")
+	}
+	return session, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// writeEncrypted seals a record with the client write key, the explicit nonce is the sequence number
+func (s *tls12Session) writeEncrypted(typ uint8, plaintext []byte) error {
+	explicit := make([]byte, 8)
+	binary.BigEndian.PutUint64(explicit, s.clientSeq)
+	nonce := append(append([]byte(nil), s.clientIV...), explicit...)
+	additional := tls12AdditionalData(s.clientSeq, typ, len(plaintext))
+	s.clientSeq++
+
+	sealed := s.clientAEAD.Seal(explicit, nonce, plaintext, additional)
+	return s.conn.writeRecord(typ, versionTLS12, sealed)
+}
+
+// readEncrypted opens the next record with the server write key
+func (s *tls12Session) readEncrypted() (uint8, []byte, error) {
+	typ, _, payload, err := s.conn.readRecord()
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(payload) < 8+s.serverAEAD.Overhead() {
+		return 0, nil, fmt.Errorf("short encrypted record")
+	}
+	nonce := append(append([]byte(nil), s.serverIV...), payload[:8]...)
+	additional := tls12AdditionalData(s.serverSeq, typ, len(payload)-8-s.serverAEAD.Overhead())
+	s.serverSeq++
+
+	plaintext, err := s.serverAEAD.Open(nil, nonce, payload[8:], additional)
+	if err != nil {
+		return 0, nil, err
+	}
+	return typ, plaintext, nil
+}
+
+func tls12AdditionalData(seq uint64, typ uint8, length int) []byte {
+	additional := make([]byte, 13)
+	binary.BigEndian.PutUint64(additional, seq)
+	additional[8] = typ
+	binary.BigEndian.PutUint16(additional[9:], versionTLS12)
+	binary.BigEndian.PutUint16(additional[11:], uint16(length))
+	return additional
+}
+
+// tls12PRF is the TLS 1.2 pseudo random function with SHA-256 (RFC 5246 section 5)
+func tls12PRF(secret []byte, label string, seed []byte, length int) []byte {
+	labelSeed := append([]byte(label), seed...)
+	var out []byte
+	a := labelSeed
+	for len(out) < length {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(a)
+		a = mac.Sum(nil)
+
+		mac = hmac.New(sha256.New, secret)
+		mac.Write(a)
+		mac.Write(labelSeed)
+		out = append(out, mac.Sum(nil)...)
+	}
+	return out[:length]
+}
+
+// ProbeROBOT sends correctly and incorrectly padded RSA key exchanges and compares the server reactions (CVE-2017-13099)
+func ProbeROBOT(target TLSTarget, version uint16) TLSVulnResult {
+	result := TLSVulnResult{Name: "ROBOT (Bleichenbacher oracle)"}
+	if version == versionSSL30 {
+		result.Detail = "only SSLv3 supported"
+		return result
+	}
+
+	spec := helloForVersion(version, target.ServerName, rsaKeyExchangeSuites)
+	conn, err := dialRawTLS(target, tlsVulnTimeout)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	flight, err := conn.startHandshake(spec)
+	conn.Close()
+	var alert *tlsAlert
+	if errors.As(err, &alert) {
+		result.Status = VulnNotVulnerable
+		result.Detail = fmt.Sprintf("RSA key exchange not supported (%s)", alert)
+		return result
+	}
+	if err != nil {
+		result.Detail = "handshake with RSA key exchange failed: " + err.Error()
+		return result
+	}
+	if len(flight.Certificates) == 0 {
+		result.Detail = "no certificate received"
+		return result
+	}
+	publicKey, ok := flight.Certificates[0].PublicKey.(*rsa.PublicKey)
+	if !ok {
+		result.Status = VulnNotVulnerable
+		result.Detail = "certificate key is not RSA"
+		return result
+	}
+
+	payloads := robotPayloads(publicKey, version)
+
+	// The shortened mode without ChangeCipherSpec and Finished catches servers that only differ in the timeout behavior
+	for _, withFinished := range []bool{true, false} {
+		responses := make([]string, len(payloads))
+		for i, payload := range payloads {
+			responses[i] = robotAttempt(target, version, payload, withFinished)
+		}
+		if allEqual(responses) {
+			continue
+		}
+
+		// Confirm once to filter out network noise before reporting an oracle
+		for i, payload := range payloads {
+			if robotAttempt(target, version, payload, withFinished) != responses[i] {
+				result.Detail = "inconsistent server responses: " + strings.Join(responses, ", ")
+				return result
+			}
+		}
+		result.Status = VulnVulnerable
+		if responses[0] != responses[1] {
+			result.Detail = "strong oracle: " + strings.Join(responses, ", ")
+		} else {
+			result.Detail = "weak oracle: " + strings.Join(responses, ", ")
+		}
+		return result
+	}
+
+	result.Status = VulnNotVulnerable
+	result.Detail = "identical responses to all padding variants"
+	return result
+}
+
+// robotPayloads encrypts the five padding variants used by the original ROBOT test
+func robotPayloads(publicKey *rsa.PublicKey, version uint16) [][]byte {
+	keySize := (publicKey.N.BitLen() + 7) / 8
+	padding := make([]byte, keySize-48-3)
+	for i := range padding {
+		for padding[i] == 0 {
+			rand.Read(padding[i : i+1])
+		}
+	}
+	pms := make([]byte, 46)
+	rand.Read(pms)
+	versionBytes := []byte{byte(version >> 8), byte(version)}
+
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+	plaintexts := [][]byte{
+		join([]byte{0x00, 0x02}, padding, []byte{0x00}, versionBytes, pms),       // correct padding
+		join([]byte{0x41, 0x17}, padding, []byte{0x00}, versionBytes, pms),       // wrong first bytes
+		join([]byte{0x00, 0x02}, padding, []byte{0x11}, pms, []byte{0x00, 0x11}), // 0x00 on a wrong position
+		join([]byte{0x00, 0x02}, padding, []byte{0x11}, []byte{0x11, 0x11}, pms), // no 0x00 separator
+		join([]byte{0x00, 0x02}, padding, []byte{0x00}, []byte{0x02, 0x02}, pms), // wrong version number
+	}
+
+	var payloads [][]byte
+	for _, plaintext := range plaintexts {
+		m := new(big.Int).SetBytes(plaintext)
+		c := new(big.Int).Exp(m, big.NewInt(int64(publicKey.E)), publicKey.N)
+		encrypted := c.FillBytes(make([]byte, keySize))
+		payloads = append(payloads, wrapHandshake(handshakeTypeClientKeyExchange, append(appendUint16(nil, uint16(len(encrypted))), encrypted...)))
+	}
+	return payloads
+}
+
+// robotAttempt sends one ClientKeyExchange variant and summarizes the server reaction
+func robotAttempt(target TLSTarget, version uint16, clientKeyExchange []byte, withFinished bool) string {
+	conn, err := dialRawTLS(target, tlsVulnTimeout)
+	if err != nil {
+		return "connect failed"
+	}
+	defer conn.Close()
+
+	if _, err := conn.startHandshake(helloForVersion(version, target.ServerName, rsaKeyExchangeSuites)); err != nil {
+		return "handshake failed"
+	}
+	conn.writeRecord(recordTypeHandshake, version, clientKeyExchange)
+	if withFinished {
+		conn.writeRecord(recordTypeChangeCipherSpec, version, []byte{1})
+		finished := make([]byte, 64)
+		rand.Read(finished)
+		conn.writeRecord(recordTypeHandshake, version, finished)
+	}
+
+	var responses []string
+	for len(responses) < 3 {
+		response := readAlertOrTimeout(conn)
+		responses = append(responses, response)
+		if response == "timeout" || response == "closed" {
+			break
+		}
+	}
+	return strings.Join(responses, "+")
+}
+
+func allEqual(values []string) bool {
+	for _, value := range values[1:] {
+		if value != values[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// FormatTLSVulnResults renders the vulnerability probe results as a table
+func FormatTLSVulnResults(target string, results []TLSVulnResult) string {
+	var sb strings.Builder
+	sb.WriteString(color.New(color.FgYellow, color.Bold).Sprintf("\nTLS Vulnerabilities for %s:\n\n", target))
+
+	table := tablewriter.NewWriter(&sb)
+	table.SetHeader([]string{"Check", "Result", "Detail"})
+	table.SetBorder(false)
+	table.SetRowLine(true)
+	table.SetAutoWrapText(false)
+	for _, result := range results {
+		status := result.Status.String()
+		switch result.Status {
+		case VulnVulnerable:
+			status = color.RedString(status)
+		case VulnNotVulnerable, VulnNotApplicable:
+			status = color.GreenString(status)
+		default:
+			status = color.YellowString(status)
+		}
+		table.Append([]string{result.Name, status, result.Detail})
+	}
+	table.Render()
+	return sb.String()
+}
@@ -0,0 +1,426 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/miekg/dns"
+	"github.com/olekukonko/tablewriter"
+)
+
+// UDP scan settings, they are set from the command line
+var (
+	UDPScan    = true
+	UDPTimeout = 2 * time.Second // wait for an answer before a port counts as open|filtered
+)
+
+// UDP port states
+const (
+	UDPOpen         = "open"
+	UDPOpenFiltered = "open|filtered"
+	UDPClosed       = "closed"
+	UDPFiltered     = "filtered"
+)
+
+// udpProbe builds the payload for a UDP service and reads its answer. Inspect returns details for the report
+// and a warning when the answer shows the service can be abused for amplification.
+type udpProbe struct {
+	Port    int
+	Service string
+	Payload func() []byte
+	Inspect func(request, response []byte) (info, amplification string)
+	AnyPort bool // the server answers from another port, like TFTP with its new transfer ID (RFC 1350)
+}
+
+// UDPResult is the state of one UDP port
+type UDPResult struct {
+	Port          int
+	Service       string
+	State         string
+	Info          string
+	Amplification string // empty unless the service answers in a way that is used for reflection attacks
+}
+
+// udpProbes are the UDP services that are scanned, every one with a payload its protocol answers
+var udpProbes = []udpProbe{
+	{Port: 53, Service: "domain", Payload: dnsVersionQuery, Inspect: inspectDNS},
+	{Port: 69, Service: "tftp", Payload: tftpReadRequest, Inspect: inspectTFTP, AnyPort: true},
+	{Port: 123, Service: "ntp", Payload: ntpClientRequest, Inspect: inspectNTP},
+	{Port: 137, Service: "netbios-ns", Payload: netbiosStatusQuery, Inspect: inspectNetBIOS},
+	{Port: 161, Service: "snmp", Payload: snmpGetSysDescr, Inspect: inspectSNMP},
+	{Port: 500, Service: "isakmp", Payload: ikeMainMode, Inspect: inspectIKE},
+	{Port: 1900, Service: "ssdp", Payload: ssdpSearch, Inspect: inspectSSDP},
+	{Port: 5353, Service: "mdns", Payload: mdnsServicesQuery, Inspect: inspectMDNS},
+	{Port: 11211, Service: "memcached", Payload: memcachedStats, Inspect: inspectMemcached},
+}
+
+// ntpMonlistRequest is a mode 7 MON_GETLIST_1 request, servers that answer it amplify traffic many times
+var ntpMonlistRequest = append([]byte{0x17, 0x00, 0x03, 0x2a}, make([]byte, 44)...)
+
+// ScanUDP probes the UDP services on a host in parallel
+func ScanUDP(host string) []UDPResult {
+	results := make([]UDPResult, len(udpProbes))
+	var wg sync.WaitGroup
+	for i, probe := range udpProbes {
+		wg.Add(1)
+		go func(i int, probe udpProbe) {
+			defer wg.Done()
+			results[i] = scanUDPPort(host, probe)
+		}(i, probe)
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Port < results[j].Port
+	})
+	return results
+}
+
+// scanUDPPort sends the probe until an answer or an ICMP error arrives, silence leaves the port open|filtered
+func scanUDPPort(host string, probe udpProbe) UDPResult {
+	result := UDPResult{Port: probe.Port, Service: probe.Service, State: UDPOpenFiltered}
+	for attempt := 0; attempt <= PortRetries; attempt++ {
+		request := probe.Payload()
+		var response []byte
+		var err error
+		if probe.AnyPort {
+			// Without an answer from any port, a connected socket tells closed and filtered ports apart
+			if response, err = exchangeUDPAnyPort(host, probe.Port, request); err != nil {
+				response, err = exchangeUDP(host, probe.Port, request)
+			}
+		} else {
+			response, err = exchangeUDP(host, probe.Port, request)
+		}
+		switch {
+		case err == nil:
+			result.State = UDPOpen
+			result.Info, result.Amplification = probe.Inspect(request, response)
+			if probe.Port == 123 {
+				if monlist, err := exchangeUDP(host, probe.Port, ntpMonlistRequest); err == nil {
+					result.Amplification = inspectMonlist(monlist)
+				}
+			}
+			return result
+		case errors.Is(err, syscall.ECONNREFUSED):
+			// ICMP port unreachable
+			result.State = UDPClosed
+			return result
+		case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+			// Other ICMP unreachable codes, usually a firewall
+			result.State = UDPFiltered
+			return result
+		}
+	}
+	return result
+}
+
+// exchangeUDP sends one datagram and reads the first answer. On a connected socket the kernel reports
+// an ICMP port unreachable as a refused connection on the next read.
+func exchangeUDP(host string, port int, request []byte) ([]byte, error) {
+	waitScanRate()
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(host, strconv.Itoa(port)), UDPTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(UDPTimeout))
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// exchangeUDPAnyPort sends one datagram from an unconnected socket and reads the first answer of the host from
+// any source port. The kernel does not report ICMP errors on such a socket, silence and refusal look the same.
+func exchangeUDPAnyPort(host string, port int, request []byte) ([]byte, error) {
+	waitScanRate()
+	target, err := net.ResolveUDPAddr("udp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(UDPTimeout))
+	if _, err := conn.WriteToUDP(request, target); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return nil, err
+		}
+		if from.IP.Equal(target.IP) {
+			return buf[:n], nil
+		}
+	}
+}
+
+func randomID() uint16 {
+	var b [2]byte
+	rand.Read(b[:])
+	return binary.BigEndian.Uint16(b[:])
+}
+
+func dnsVersionQuery() []byte {
+	m := new(dns.Msg)
+	m.SetQuestion("version.bind.", dns.TypeTXT)
+	m.Question[0].Qclass = dns.ClassCHAOS
+	m.Id = randomID()
+	packed, _ := m.Pack()
+	return packed
+}
+
+func inspectDNS(request, response []byte) (string, string) {
+	m := new(dns.Msg)
+	if err := m.Unpack(response); err != nil {
+		return "", ""
+	}
+	var info []string
+	for _, answer := range m.Answer {
+		if txt, ok := answer.(*dns.TXT); ok {
+			info = append(info, "version: "+strings.Join(txt.Txt, " "))
+		}
+	}
+	if m.RecursionAvailable {
+		info = append(info, "recursion available")
+	}
+	return strings.Join(info, ", "), ""
+}
+
+func tftpReadRequest() []byte {
+	name := fmt.Sprintf("dominfo-%04x.txt", randomID())
+	return []byte("\x00\x01" + name + "\x00octet\x00")
+}
+
+func inspectTFTP(request, response []byte) (string, string) {
+	if len(response) >= 4 && response[1] == 5 {
+		return "error: " + printable(string(bytes.TrimRight(response[4:], "\x00"))), ""
+	}
+	return "", ""
+}
+
+func ntpClientRequest() []byte {
+	request := make([]byte, 48)
+	request[0] = 0x1b // version 3, client mode
+	return request
+}
+
+func inspectNTP(request, response []byte) (string, string) {
+	if len(response) < 48 {
+		return "", ""
+	}
+	return fmt.Sprintf("version %d, stratum %d", response[0]>>3&0x07, response[1]), ""
+}
+
+// inspectMonlist reports a mode 7 answer without an error code, it lists the recent clients of the server
+func inspectMonlist(response []byte) string {
+	if len(response) < 8 || response[0]&0x80 == 0 || response[0]&0x07 != 7 || response[3] != 0x2a || response[4]>>4 != 0 {
+		return ""
+	}
+	return fmt.Sprintf("NTP monlist answered with %d bytes to a %d byte request", len(response), len(ntpMonlistRequest))
+}
+
+// netbiosStatusQuery asks for the name table of the host, the wildcard name "*" is encoded in the first level encoding
+func netbiosStatusQuery() []byte {
+	query := binary.BigEndian.AppendUint16(nil, randomID())
+	query = append(query, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20, 'C', 'K')
+	query = append(query, bytes.Repeat([]byte{'A'}, 30)...)
+	return append(query, 0x00, 0x00, 0x21, 0x00, 0x01)
+}
+
+func inspectNetBIOS(request, response []byte) (string, string) {
+	// Header, name, type, class, TTL and data length come before the name count
+	const offset = 12 + 34 + 2 + 2 + 4 + 2
+	if len(response) <= offset {
+		return "", ""
+	}
+	var names []string
+	for i, entry := 0, response[offset+1:]; i < int(response[offset]) && len(entry) >= 18; i, entry = i+1, entry[18:] {
+		name := strings.TrimSpace(string(entry[:15]))
+		// Workstation names end with the suffix 0x00, bit 15 of the flags marks group names
+		if entry[15] == 0x00 {
+			if entry[16]&0x80 != 0 {
+				names = append(names, "group "+name)
+			} else {
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return "", ""
+	}
+	return "names: " + strings.Join(names, ", "), ""
+}
+
+// snmpGetSysDescr is an SNMPv2c get-request for sysDescr.0 with the community public
+func snmpGetSysDescr() []byte {
+	request := []byte{
+		0x30, 0x29, 0x02, 0x01, 0x01, 0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c',
+		0xa0, 0x1c, 0x02, 0x04, 0x00, 0x00, 0x00, 0x00, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00,
+		0x30, 0x0e, 0x30, 0x0c, 0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00, 0x05, 0x00,
+	}
+	binary.BigEndian.PutUint16(request[19:], randomID())
+	return request
+}
+
+func inspectSNMP(request, response []byte) (string, string) {
+	oid := []byte{0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00, 0x04}
+	index := bytes.Index(response, oid)
+	if index < 0 || index+len(oid) >= len(response) {
+		return "community public accepted", ""
+	}
+	value := response[index+len(oid):]
+	length, value := int(value[0]), value[1:]
+	if length&0x80 != 0 {
+		size := length & 0x7f
+		if size > 2 || len(value) < size {
+			return "community public accepted", ""
+		}
+		length = 0
+		for _, b := range value[:size] {
+			length = length<<8 | int(b)
+		}
+		value = value[size:]
+	}
+	description := printable(string(value[:min(length, len(value))]))
+	if len(description) > 60 {
+		description = description[:57] + "..."
+	}
+	return "community public accepted, " + description, ""
+}
+
+// ikeMainMode is an IKEv1 main mode proposal for 3DES, SHA1, pre-shared key and group 2
+func ikeMainMode() []byte {
+	packet := make([]byte, 8, 80)
+	rand.Read(packet)
+	packet = append(packet, make([]byte, 8)...)                           // responder cookie
+	packet = append(packet, 0x01, 0x10, 0x02, 0x00, 0, 0, 0, 0)           // SA payload next, version 1.0, identity protection
+	packet = append(packet, 0, 0, 0, 80)                                  // length
+	packet = append(packet, 0x00, 0x00, 0x00, 52, 0, 0, 0, 1, 0, 0, 0, 1) // SA: DOI IPsec, situation identity only
+	packet = append(packet, 0x00, 0x00, 0x00, 40, 0x01, 0x01, 0x00, 0x01) // proposal 1, ISAKMP, one transform
+	packet = append(packet, 0x00, 0x00, 0x00, 32, 0x01, 0x01, 0x00, 0x00) // transform 1, KEY_IKE
+	packet = append(packet,
+		0x80, 0x01, 0x00, 0x05, // 3DES
+		0x80, 0x02, 0x00, 0x02, // SHA1
+		0x80, 0x03, 0x00, 0x01, // pre-shared key
+		0x80, 0x04, 0x00, 0x02, // group 2
+		0x80, 0x0b, 0x00, 0x01, // lifetime in seconds
+		0x80, 0x0c, 0x70, 0x80) // 28800
+	return packet
+}
+
+func inspectIKE(request, response []byte) (string, string) {
+	if len(response) < 28 || !bytes.Equal(response[:8], request[:8]) {
+		return "", ""
+	}
+	switch response[16] {
+	case 0x01:
+		return "IKEv1 proposal accepted", ""
+	case 0x0b:
+		return "IKEv1 notification", ""
+	}
+	return fmt.Sprintf("IKE version %d.%d", response[17]>>4, response[17]&0x0f), ""
+}
+
+func ssdpSearch() []byte {
+	return []byte("M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 1\r\nST: ssdp:all\r\n\r\n")
+}
+
+func inspectSSDP(request, response []byte) (string, string) {
+	if !bytes.HasPrefix(response, []byte("HTTP/1.1 200")) {
+		return "", ""
+	}
+	info := ""
+	for _, line := range strings.Split(string(response), "\r\n") {
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "server") {
+			info = strings.TrimSpace(value)
+		}
+	}
+	return info, fmt.Sprintf("SSDP answers unicast M-SEARCH, %d bytes to a %d byte request", len(response), len(request))
+}
+
+func mdnsServicesQuery() []byte {
+	m := new(dns.Msg)
+	m.SetQuestion("_services._dns-sd._udp.local.", dns.TypePTR)
+	m.RecursionDesired = false
+	packed, _ := m.Pack()
+	return packed
+}
+
+func inspectMDNS(request, response []byte) (string, string) {
+	m := new(dns.Msg)
+	if err := m.Unpack(response); err != nil {
+		return "", ""
+	}
+	var services []string
+	for _, answer := range m.Answer {
+		if ptr, ok := answer.(*dns.PTR); ok {
+			services = append(services, strings.TrimSuffix(ptr.Ptr, ".local."))
+		}
+	}
+	if len(services) == 0 {
+		return "", ""
+	}
+	return "services: " + strings.Join(services, ", "), ""
+}
+
+// memcachedStats is a stats command behind the 8 byte UDP frame header
+func memcachedStats() []byte {
+	request := binary.BigEndian.AppendUint16(nil, randomID())
+	return append(request, []byte("\x00\x00\x00\x01\x00\x00stats\r\n")...)
+}
+
+func inspectMemcached(request, response []byte) (string, string) {
+	if len(response) < 8 || !bytes.Contains(response[8:], []byte("STAT ")) {
+		return "", ""
+	}
+	info := ""
+	for _, line := range strings.Split(string(response[8:]), "\r\n") {
+		if version, ok := strings.CutPrefix(line, "STAT version "); ok {
+			info = "version " + version
+		}
+	}
+	return info, fmt.Sprintf("memcached answers over UDP, %d bytes to a %d byte request", len(response), len(request))
+}
+
+// formatUDPResults lists the UDP ports with their state and warns about services open to amplification
+func formatUDPResults(results []UDPResult) string {
+	var sb strings.Builder
+	sb.WriteString("UDP Ports:\n")
+	table := tablewriter.NewWriter(&sb)
+	table.SetHeader([]string{"Port", "State", "Service", "Info"})
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	var warnings []string
+	for _, result := range results {
+		table.Append([]string{strconv.Itoa(result.Port) + "/udp", result.State, result.Service, result.Info})
+		if result.Amplification != "" {
+			warnings = append(warnings, color.RedString("Amplification risk on %d/udp: %s", result.Port, result.Amplification))
+		}
+	}
+	table.Render()
+	if len(warnings) > 0 {
+		sb.WriteString("\n" + strings.Join(warnings, "\n") + "\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,534 @@
+package utils
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+// defaultVulnerabilities is the built-in dataset with a few well-known CVEs and end-of-life dates
+//
+//go:embed vulnerabilities.json
+var defaultVulnerabilities []byte
+
+// VulnDBPaths is a comma separated list of datasets or NVD JSON feeds merged over the built-in dataset
+var VulnDBPaths string
+
+// VersionRange is an affected version range, named like the NVD cpe_match fields
+type VersionRange struct {
+	StartIncluding string `json:"versionStartIncluding,omitempty"`
+	StartExcluding string `json:"versionStartExcluding,omitempty"`
+	EndIncluding   string `json:"versionEndIncluding,omitempty"`
+	EndExcluding   string `json:"versionEndExcluding,omitempty"`
+}
+
+// CVE is a vulnerability of a product and the version ranges it affects
+type CVE struct {
+	ID      string         `json:"id"`
+	CVSS    float64        `json:"cvss"`
+	Summary string         `json:"summary"`
+	Ranges  []VersionRange `json:"ranges"`
+}
+
+// EOLCycle is a release cycle such as 7.4 and the date its support ended, empty while it is supported
+type EOLCycle struct {
+	Cycle string `json:"cycle"`
+	EOL   string `json:"eol"`
+}
+
+// VulnProduct holds the CVEs and release cycles of a product
+type VulnProduct struct {
+	CVEs []CVE      `json:"cves,omitempty"`
+	EOL  []EOLCycle `json:"eol,omitempty"`
+}
+
+// VulnDB is the offline dataset, products are keyed by the vendor and product part of their CPE
+// (cpe:2.3:a:php:php), the same CPE the fingerprint rules carry
+type VulnDB struct {
+	Products map[string]*VulnProduct `json:"products"`
+}
+
+// ComponentVulnerabilities is what the dataset knows about a detected technology
+type ComponentVulnerabilities struct {
+	Technology DetectedTechnology
+	CVEs       []CVE
+	Possible   map[string]bool // CVEs whose ranges are more precise than the detected version
+	EOLCycle   string
+	EOL        string
+	Outdated   bool
+}
+
+var (
+	vulnDBOnce sync.Once
+	vulnDB     *VulnDB
+	vulnDBErr  error
+)
+
+// VulnerabilityDB returns the built-in dataset merged with VulnDBPaths, it is loaded once
+func VulnerabilityDB() (*VulnDB, error) {
+	vulnDBOnce.Do(func() {
+		vulnDB = &VulnDB{Products: map[string]*VulnProduct{}}
+		if vulnDBErr = vulnDB.Load(defaultVulnerabilities); vulnDBErr != nil {
+			return
+		}
+		for _, path := range strings.Split(VulnDBPaths, ",") {
+			if path = strings.TrimSpace(path); path == "" {
+				continue
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				vulnDBErr = fmt.Errorf("could not read vulnerability dataset: %w", err)
+				return
+			}
+			if err := vulnDB.Load(data); err != nil {
+				vulnDBErr = fmt.Errorf("%s: %w", path, err)
+				return
+			}
+		}
+	})
+	return vulnDB, vulnDBErr
+}
+
+// cpeProduct reduces a CPE to the part, vendor and product used as dataset key
+func cpeProduct(cpe string) (key, version string) {
+	fields := strings.Split(cpe, ":")
+	if len(fields) < 5 || fields[0] != "cpe" {
+		return "", ""
+	}
+	key = strings.Join(fields[:5], ":")
+	if len(fields) > 5 && fields[5] != "*" && fields[5] != "-" {
+		version = fields[5]
+	}
+	return key, version
+}
+
+// Load merges a dataset in the format of vulnerabilities.json or an NVD JSON feed, version 1.1 (CVE_Items) or
+// the 2.0 API (vulnerabilities). CVEs with an ID already known and cycles with the same name are replaced.
+func (db *VulnDB) Load(data []byte) error {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return fmt.Errorf("invalid dataset: %w", err)
+	}
+	switch {
+	case top["products"] != nil:
+		var dataset VulnDB
+		if err := json.Unmarshal(data, &dataset); err != nil {
+			return fmt.Errorf("invalid dataset: %w", err)
+		}
+		for key, product := range dataset.Products {
+			key, _ = cpeProduct(key)
+			for _, cve := range product.CVEs {
+				db.addCVE(key, cve)
+			}
+			for _, cycle := range product.EOL {
+				db.addCycle(key, cycle)
+			}
+		}
+	case top["CVE_Items"] != nil:
+		return db.loadNVD11(top["CVE_Items"])
+	case top["vulnerabilities"] != nil:
+		return db.loadNVD20(top["vulnerabilities"])
+	default:
+		return fmt.Errorf("unknown dataset format, expected products, CVE_Items or vulnerabilities")
+	}
+	return nil
+}
+
+func (db *VulnDB) product(key string) *VulnProduct {
+	product, ok := db.Products[key]
+	if !ok {
+		product = &VulnProduct{}
+		db.Products[key] = product
+	}
+	return product
+}
+
+func (db *VulnDB) addCVE(key string, cve CVE) {
+	product := db.product(key)
+	for i := range product.CVEs {
+		if product.CVEs[i].ID == cve.ID {
+			product.CVEs[i] = cve
+			return
+		}
+	}
+	product.CVEs = append(product.CVEs, cve)
+}
+
+func (db *VulnDB) addCycle(key string, cycle EOLCycle) {
+	product := db.product(key)
+	for i := range product.EOL {
+		if product.EOL[i].Cycle == cycle.Cycle {
+			product.EOL[i] = cycle
+			return
+		}
+	}
+	product.EOL = append(product.EOL, cycle)
+}
+
+// nvdMatch is a cpe_match (1.1) or cpeMatch (2.0) entry, the CPE is in cpe23Uri or criteria
+type nvdMatch struct {
+	Vulnerable bool   `json:"vulnerable"`
+	Cpe23URI   string `json:"cpe23Uri"`
+	Criteria   string `json:"criteria"`
+	VersionRange
+}
+
+type nvdNode struct {
+	CPEMatch11 []nvdMatch `json:"cpe_match"`
+	CPEMatch20 []nvdMatch `json:"cpeMatch"`
+	Children   []nvdNode  `json:"children"`
+}
+
+// addNVDMatches groups the vulnerable matches of the nodes by product into one CVE each
+func (db *VulnDB) addNVDMatches(id string, cvss float64, summary string, nodes []nvdNode) {
+	ranges := map[string][]VersionRange{}
+	var walk func(nodes []nvdNode)
+	walk = func(nodes []nvdNode) {
+		for _, node := range nodes {
+			for _, match := range append(node.CPEMatch11, node.CPEMatch20...) {
+				key, version := cpeProduct(match.Cpe23URI + match.Criteria)
+				if !match.Vulnerable || key == "" {
+					continue
+				}
+				r := match.VersionRange
+				if r == (VersionRange{}) {
+					// A CPE without range names the single affected version, or every version with *
+					r = VersionRange{StartIncluding: version, EndIncluding: version}
+				}
+				ranges[key] = append(ranges[key], r)
+			}
+			walk(node.Children)
+		}
+	}
+	walk(nodes)
+	for key, productRanges := range ranges {
+		db.addCVE(key, CVE{ID: id, CVSS: cvss, Summary: summary, Ranges: productRanges})
+	}
+}
+
+func (db *VulnDB) loadNVD11(raw json.RawMessage) error {
+	var items []struct {
+		CVE struct {
+			Meta struct {
+				ID string `json:"ID"`
+			} `json:"CVE_data_meta"`
+			Description struct {
+				Data []struct {
+					Value string `json:"value"`
+				} `json:"description_data"`
+			} `json:"description"`
+		} `json:"cve"`
+		Configurations struct {
+			Nodes []nvdNode `json:"nodes"`
+		} `json:"configurations"`
+		Impact struct {
+			V3 struct {
+				CVSS struct {
+					BaseScore float64 `json:"baseScore"`
+				} `json:"cvssV3"`
+			} `json:"baseMetricV3"`
+			V2 struct {
+				CVSS struct {
+					BaseScore float64 `json:"baseScore"`
+				} `json:"cvssV2"`
+			} `json:"baseMetricV2"`
+		} `json:"impact"`
+	}
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return fmt.Errorf("invalid NVD 1.1 feed: %w", err)
+	}
+	for _, item := range items {
+		cvss := item.Impact.V3.CVSS.BaseScore
+		if cvss == 0 {
+			cvss = item.Impact.V2.CVSS.BaseScore
+		}
+		summary := ""
+		if len(item.CVE.Description.Data) > 0 {
+			summary = item.CVE.Description.Data[0].Value
+		}
+		db.addNVDMatches(item.CVE.Meta.ID, cvss, summary, item.Configurations.Nodes)
+	}
+	return nil
+}
+
+func (db *VulnDB) loadNVD20(raw json.RawMessage) error {
+	type metric struct {
+		Data struct {
+			BaseScore float64 `json:"baseScore"`
+		} `json:"cvssData"`
+	}
+	var items []struct {
+		CVE struct {
+			ID           string `json:"id"`
+			Descriptions []struct {
+				Lang  string `json:"lang"`
+				Value string `json:"value"`
+			} `json:"descriptions"`
+			Metrics struct {
+				V31 []metric `json:"cvssMetricV31"`
+				V30 []metric `json:"cvssMetricV30"`
+				V2  []metric `json:"cvssMetricV2"`
+			} `json:"metrics"`
+			Configurations []struct {
+				Nodes []nvdNode `json:"nodes"`
+			} `json:"configurations"`
+		} `json:"cve"`
+	}
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return fmt.Errorf("invalid NVD 2.0 feed: %w", err)
+	}
+	for _, item := range items {
+		var cvss float64
+		for _, metrics := range [][]metric{item.CVE.Metrics.V31, item.CVE.Metrics.V30, item.CVE.Metrics.V2} {
+			if len(metrics) > 0 {
+				cvss = metrics[0].Data.BaseScore
+				break
+			}
+		}
+		summary := ""
+		for _, description := range item.CVE.Descriptions {
+			if description.Lang == "en" {
+				summary = description.Value
+				break
+			}
+		}
+		for _, configuration := range item.CVE.Configurations {
+			db.addNVDMatches(item.CVE.ID, cvss, summary, configuration.Nodes)
+		}
+	}
+	return nil
+}
+
+var versionToken = regexp.MustCompile(`\d+|[a-zA-Z]+`)
+
+// versionParts splits 1.0.1f into 1, 0, 1 and f
+func versionParts(version string) []string {
+	return versionToken.FindAllString(version, -1)
+}
+
+// compareVersions compares numeric parts as numbers and letters as text, so 1.0.1f is older than 1.0.1g
+// and 1.0.1 older than both
+func compareVersions(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		x, errX := strconv.Atoi(a[i])
+		y, errY := strconv.Atoi(b[i])
+		switch {
+		case errX == nil && errY == nil && x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		case errX == nil && errY != nil:
+			return 1
+		case errX != nil && errY == nil:
+			return -1
+		case errX != nil && errY != nil && a[i] != b[i]:
+			return strings.Compare(strings.ToLower(a[i]), strings.ToLower(b[i]))
+		}
+	}
+	return len(a) - len(b)
+}
+
+// contains tells whether a version is in the range. A version less precise than the bounds, like 7.2 against
+// 7.2.24, is compared with the bounds cut to its length and only reported as possibly affected.
+func (r VersionRange) contains(version string) (affected, possible bool) {
+	v := versionParts(version)
+	if len(v) == 0 {
+		return false, false
+	}
+	for _, bound := range []string{r.StartIncluding, r.StartExcluding, r.EndIncluding, r.EndExcluding} {
+		if len(versionParts(bound)) > len(v) {
+			possible = true
+		}
+	}
+	bound := func(value string) []string {
+		parts := versionParts(value)
+		if possible && len(parts) > len(v) {
+			parts = parts[:len(v)]
+		}
+		return parts
+	}
+
+	if r.StartIncluding != "" && compareVersions(v, bound(r.StartIncluding)) < 0 {
+		return false, false
+	}
+	if r.StartExcluding != "" && (compareVersions(v, bound(r.StartExcluding)) < 0 || !possible && compareVersions(v, bound(r.StartExcluding)) == 0) {
+		return false, false
+	}
+	if r.EndIncluding != "" && compareVersions(v, bound(r.EndIncluding)) > 0 {
+		return false, false
+	}
+	if r.EndExcluding != "" && (compareVersions(v, bound(r.EndExcluding)) > 0 || !possible && compareVersions(v, bound(r.EndExcluding)) == 0) {
+		return false, false
+	}
+	return true, possible
+}
+
+// Match looks up the CVEs affecting the version of a technology and the end of life of its release cycle
+func (db *VulnDB) Match(technology DetectedTechnology) ComponentVulnerabilities {
+	result := ComponentVulnerabilities{Technology: technology, Possible: map[string]bool{}}
+	key, _ := cpeProduct(technology.CPE)
+	product, ok := db.Products[key]
+	if !ok || technology.Version == "" {
+		return result
+	}
+
+	for _, cve := range product.CVEs {
+		affected, definite := false, false
+		for _, r := range cve.Ranges {
+			if ok, possible := r.contains(technology.Version); ok {
+				affected = true
+				definite = definite || !possible
+			}
+		}
+		if affected {
+			result.CVEs = append(result.CVEs, cve)
+			result.Possible[cve.ID] = !definite
+		}
+	}
+	sort.Slice(result.CVEs, func(i, j int) bool {
+		return result.CVEs[i].CVSS > result.CVEs[j].CVSS
+	})
+
+	// The longest cycle the version starts with wins, so 1.0.1 is preferred over 1
+	v := versionParts(technology.Version)
+	for _, cycle := range product.EOL {
+		c := versionParts(cycle.Cycle)
+		if len(c) > len(v) || compareVersions(v[:len(c)], c) != 0 || len(c) <= len(versionParts(result.EOLCycle)) {
+			continue
+		}
+		result.EOLCycle, result.EOL = cycle.Cycle, cycle.EOL
+	}
+	if date, err := time.Parse("2006-01-02", result.EOL); err == nil {
+		result.Outdated = time.Now().After(date)
+	}
+	return result
+}
+
+// MatchVulnerabilities maps the detected technologies with a version to the dataset
+func MatchVulnerabilities(detected []DetectedTechnology) ([]ComponentVulnerabilities, error) {
+	db, err := VulnerabilityDB()
+	if err != nil {
+		return nil, err
+	}
+	var results []ComponentVulnerabilities
+	for _, technology := range detected {
+		if result := db.Match(technology); len(result.CVEs) > 0 || result.EOLCycle != "" {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// cvssColor colors a score by its CVSS v3 severity
+func cvssColor(score float64) string {
+	text := fmt.Sprintf("%.1f", score)
+	switch {
+	case score >= 9:
+		return color.New(color.FgRed, color.Bold).Sprint(text + " Critical")
+	case score >= 7:
+		return color.RedString(text + " High")
+	case score >= 4:
+		return color.YellowString(text + " Medium")
+	case score > 0:
+		return color.CyanString(text + " Low")
+	default:
+		return text
+	}
+}
+
+// FormatVulnerabilityReport lists the CVEs and end-of-life status of every component found in the dataset
+func FormatVulnerabilityReport(results []ComponentVulnerabilities) string {
+	var sb strings.Builder
+	sb.WriteString(color.New(color.FgYellow, color.Bold).Sprint("\nKnown Vulnerabilities (offline dataset):\n"))
+	if len(results) == 0 {
+		sb.WriteString("No known vulnerabilities or end-of-life releases for the detected versions\n")
+		return sb.String()
+	}
+
+	table := tablewriter.NewWriter(&sb)
+	table.SetHeader([]string{"Component", "Version", "End of Life", "CVE", "CVSS", "Summary"})
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+
+	outdated, cves := 0, 0
+	for _, result := range results {
+		eol := ""
+		switch {
+		case result.Outdated:
+			eol = color.RedString("%s since %s", result.EOLCycle, result.EOL)
+			outdated++
+		case result.EOL != "":
+			eol = color.GreenString("%s supported until %s", result.EOLCycle, result.EOL)
+		case result.EOLCycle != "":
+			eol = color.GreenString("%s supported", result.EOLCycle)
+		}
+		name, version := result.Technology.Name, result.Technology.Version
+		if len(result.CVEs) == 0 {
+			table.Append([]string{name, version, eol, "", "", ""})
+			continue
+		}
+		for _, cve := range result.CVEs {
+			id := cve.ID
+			if result.Possible[cve.ID] {
+				id += " (possible)"
+			}
+			summary := cve.Summary
+			if len(summary) > 90 {
+				summary = summary[:87] + "..."
+			}
+			table.Append([]string{name, version, eol, id, cvssColor(cve.CVSS), summary})
+			// The component is only named on its first row
+			name, version, eol = "", "", ""
+			cves++
+		}
+	}
+	table.Render()
+
+	if outdated > 0 {
+		sb.WriteString(color.RedString("%d components run a release that reached its end of life\n", outdated))
+	}
+	if cves > 0 {
+		sb.WriteString(color.RedString("%d known vulnerabilities match the detected versions, (possible) marks versions too imprecise to be sure\n", cves))
+	}
+	return sb.String()
+}
+
+// ImportVulnerabilityData merges datasets and NVD feeds into the dataset file at output, which is created
+// when missing. It returns the number of products and CVE entries written.
+func ImportVulnerabilityData(output string, inputs []string) (int, int, error) {
+	db := &VulnDB{Products: map[string]*VulnProduct{}}
+	for _, path := range append([]string{output}, inputs...) {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) && path == output {
+			continue
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		if err := db.Load(data); err != nil {
+			return 0, 0, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	cves := 0
+	for _, product := range db.Products {
+		cves += len(product.CVEs)
+	}
+	data, err := json.Marshal(db)
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(db.Products), cves, os.WriteFile(output, data, 0644)
+}
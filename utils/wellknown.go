@@ -0,0 +1,556 @@
+package utils
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+// maxSitemaps limits how many sitemaps of a sitemap index are read
+const maxSitemaps = 5
+
+// interestingPathPattern matches robots.txt and sitemap paths that usually hide something worth a look
+var interestingPathPattern = regexp.MustCompile(`(?i)admin|login|signin|backup|bak|config|api|private|secret|internal|test|dev|staging|debug|\.git|\.env|sql|db|dump|upload|phpmyadmin|cgi-bin|old|tmp|temp|console|dashboard|manage|wp-admin|server-status|account|export`)
+
+// robotsTechnologies maps paths found in robots.txt or sitemaps to the software they reveal
+var robotsTechnologies = map[string]string{
+	"/wp-admin":        "WordPress",
+	"/wp-content":      "WordPress",
+	"/wp-includes":     "WordPress",
+	"/xmlrpc.php":      "WordPress",
+	"/administrator/":  "Joomla",
+	"/core/":           "Drupal",
+	"/user/login":      "Drupal",
+	"/catalogsearch/":  "Magento",
+	"/checkout/cart":   "Magento",
+	"/bitrix/":         "Bitrix",
+	"/typo3":           "TYPO3",
+	"/umbraco":         "Umbraco",
+	"/sitecore":        "Sitecore",
+	"/ghost/":          "Ghost",
+	"/_next/":          "Next.js",
+	"/cdn-cgi/":        "Cloudflare",
+	"/aspnet_client":   "ASP.NET",
+	"/_layouts/":       "SharePoint",
+	"/owa/":            "Outlook Web Access",
+	"/actuator":        "Spring Boot",
+	"/manager/html":    "Apache Tomcat",
+	"/CFIDE/":          "Adobe ColdFusion",
+	"/phpmyadmin":      "phpMyAdmin",
+	"/jenkins":         "Jenkins",
+	"/confluence":      "Confluence",
+	"/jira":            "Jira",
+	"/graphql":         "GraphQL",
+	"/swagger":         "Swagger/OpenAPI",
+	"/api-docs":        "Swagger/OpenAPI",
+	"/auth/realms/":    "Keycloak",
+	"/adfs/":           "AD FS",
+	"/remote/login":    "Fortinet FortiGate SSL VPN",
+	"/dana-na/":        "Pulse Secure VPN",
+	"/global-protect/": "Palo Alto GlobalProtect",
+	"/desktopmodules/": "DotNetNuke",
+}
+
+// openIDProviders maps issuer hosts or paths to the identity provider they reveal
+var openIDProviders = map[string]string{
+	"login.microsoftonline.com": "Microsoft Entra ID",
+	"sts.windows.net":           "Microsoft Entra ID",
+	"accounts.google.com":       "Google",
+	"okta.com":                  "Okta",
+	"oktapreview.com":           "Okta",
+	"auth0.com":                 "Auth0",
+	"onelogin.com":              "OneLogin",
+	"pingidentity.com":          "Ping Identity",
+	"amazoncognito.com":         "Amazon Cognito",
+	"cognito-idp.":              "Amazon Cognito",
+	"/realms/":                  "Keycloak",
+	"/adfs":                     "AD FS",
+	"/oauth2/default":           "Okta",
+	"b2clogin.com":              "Azure AD B2C",
+	"fusionauth.io":             "FusionAuth",
+	"/application/o/":           "authentik",
+	"gluu":                      "Gluu",
+}
+
+// SecurityTxt is a parsed security.txt file (RFC 9116)
+type SecurityTxt struct {
+	URL                string
+	Fields             map[string][]string
+	Expires            time.Time
+	Signed             bool
+	Issues             []string
+	ContentType        string
+	PreferredLanguages string
+}
+
+// WellKnownResource is the answer for one probed /.well-known/ URL
+type WellKnownResource struct {
+	Path    string
+	Status  int
+	Summary string
+}
+
+// WellKnownInfo collects what the well-known files and robots.txt disclose about a site
+type WellKnownInfo struct {
+	BaseURL          string
+	SecurityTxt      *SecurityTxt
+	SecurityContacts []string
+	Disallowed       []string
+	Interesting      []string
+	Sitemaps         []string
+	SitemapURLs      int
+	Resources        []WellKnownResource
+	Technologies     []string
+}
+
+func newWellKnownClient() *http.Client {
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+}
+
+func fetchWellKnown(client *http.Client, rawURL string) (*http.Response, []byte, error) {
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	return resp, body, err
+}
+
+// ParseSecurityTxt parses and validates a security.txt file fetched from url
+func ParseSecurityTxt(content, fetchedURL string) *SecurityTxt {
+	txt := &SecurityTxt{URL: fetchedURL, Fields: map[string][]string{}}
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	issue := func(format string, args ...interface{}) {
+		txt.Issues = append(txt.Issues, fmt.Sprintf(format, args...))
+	}
+
+	// The signed message is between the armor header and the signature, with dash-escaped lines
+	if strings.HasPrefix(strings.TrimSpace(content), "-----BEGIN PGP SIGNED MESSAGE-----") {
+		txt.Signed = true
+		if i := strings.Index(content, "\n\n"); i >= 0 {
+			content = content[i+2:]
+		}
+		if i := strings.Index(content, "-----BEGIN PGP SIGNATURE-----"); i >= 0 {
+			content = content[:i]
+		}
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimPrefix(strings.TrimSpace(line), "- ")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			issue("Invalid line %q", line)
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		txt.Fields[name] = append(txt.Fields[name], strings.TrimSpace(value))
+	}
+
+	contacts := txt.Fields["contact"]
+	if len(contacts) == 0 {
+		issue("Contact is missing, it is required")
+	}
+	for _, contact := range contacts {
+		switch {
+		case strings.HasPrefix(contact, "mailto:"), strings.HasPrefix(contact, "https://"), strings.HasPrefix(contact, "tel:"):
+		case strings.HasPrefix(contact, "http://"):
+			issue("Contact %s uses http, web URIs must use https", contact)
+		default:
+			issue("Contact %s is not a URI, use mailto:, https:// or tel:", contact)
+		}
+	}
+
+	switch expires := txt.Fields["expires"]; {
+	case len(expires) == 0:
+		issue("Expires is missing, it is required")
+	case len(expires) > 1:
+		issue("Expires appears %d times, it must appear once", len(expires))
+	default:
+		t, err := time.Parse(time.RFC3339, expires[0])
+		if err != nil {
+			issue("Expires %q is not an RFC 3339 date", expires[0])
+			break
+		}
+		txt.Expires = t
+		if t.Before(time.Now()) {
+			issue("Expired on %s, the file must be considered stale", t.Format("2006-01-02"))
+		} else if t.After(time.Now().AddDate(1, 0, 0)) {
+			issue("Expires is more than a year ahead, RFC 9116 recommends less than a year")
+		}
+	}
+
+	if languages := txt.Fields["preferred-languages"]; len(languages) > 1 {
+		issue("Preferred-Languages appears %d times, it must appear at most once", len(languages))
+	} else if len(languages) == 1 {
+		txt.PreferredLanguages = languages[0]
+	}
+	for _, field := range []string{"encryption", "acknowledgments", "policy", "hiring", "canonical", "csaf"} {
+		for _, value := range txt.Fields[field] {
+			if strings.HasPrefix(value, "http://") {
+				issue("%s %s uses http, web URIs must use https", fieldName(field), value)
+			}
+		}
+	}
+	if canonical := txt.Fields["canonical"]; len(canonical) > 0 {
+		found := false
+		for _, value := range canonical {
+			if value == fetchedURL {
+				found = true
+			}
+		}
+		if !found {
+			issue("Canonical does not list %s, the file may have been copied from another site", fetchedURL)
+		}
+	}
+	return txt
+}
+
+// ParseRobots returns the disallowed paths and the sitemaps of a robots.txt
+func ParseRobots(content string) (disallowed, sitemaps []string) {
+	seen := map[string]bool{}
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "disallow":
+			if value != "" && !seen[value] {
+				seen[value] = true
+				disallowed = append(disallowed, value)
+			}
+		case "sitemap":
+			sitemaps = append(sitemaps, value)
+		}
+	}
+	return disallowed, sitemaps
+}
+
+// sitemapDocument covers both <urlset> and <sitemapindex>
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []string `xml:"url>loc"`
+	Sitemaps []string `xml:"sitemap>loc"`
+}
+
+// readSitemaps reads the sitemaps and one level of sitemap indexes and returns the page URLs
+func readSitemaps(client *http.Client, sitemaps []string) []string {
+	var pages []string
+	queue := append([]string{}, sitemaps...)
+	seen := map[string]bool{}
+	for read := 0; len(queue) > 0 && read < maxSitemaps; {
+		sitemap := queue[0]
+		queue = queue[1:]
+		if seen[sitemap] {
+			continue
+		}
+		seen[sitemap] = true
+		read++
+
+		resp, body, err := fetchWellKnown(client, sitemap)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			continue
+		}
+		var doc sitemapDocument
+		if xml.Unmarshal(body, &doc) != nil {
+			continue
+		}
+		pages = append(pages, doc.URLs...)
+		queue = append(queue, doc.Sitemaps...)
+	}
+	return pages
+}
+
+// wellKnownProbes are fetched from /.well-known/ and summarized by the function
+var wellKnownProbes = []struct {
+	Name      string
+	Summarize func(resp *http.Response, body []byte, info *WellKnownInfo) string
+}{
+	{"openid-configuration", summarizeOpenIDConfiguration},
+	{"oauth-authorization-server", summarizeOpenIDConfiguration},
+	{"change-password", summarizeChangePassword},
+	{"apple-app-site-association", summarizeAppleAppSiteAssociation},
+	{"assetlinks.json", summarizeAssetLinks},
+}
+
+func summarizeOpenIDConfiguration(resp *http.Response, body []byte, info *WellKnownInfo) string {
+	var config struct {
+		Issuer                string   `json:"issuer"`
+		AuthorizationEndpoint string   `json:"authorization_endpoint"`
+		RegistrationEndpoint  string   `json:"registration_endpoint"`
+		GrantTypes            []string `json:"grant_types_supported"`
+	}
+	if json.Unmarshal(body, &config) != nil || config.Issuer == "" {
+		return "Not a valid metadata document"
+	}
+	summary := "Issuer " + config.Issuer
+	for marker, provider := range openIDProviders {
+		if provider != "" && (strings.Contains(config.Issuer, marker) || strings.Contains(config.AuthorizationEndpoint, marker)) {
+			summary += " (" + provider + ")"
+			info.Technologies = append(info.Technologies, provider)
+			break
+		}
+	}
+	if config.RegistrationEndpoint != "" {
+		summary += ", dynamic client registration at " + config.RegistrationEndpoint
+	}
+	for _, grant := range config.GrantTypes {
+		if grant == "password" || grant == "implicit" {
+			summary += ", legacy grant " + grant + " enabled"
+		}
+	}
+	return summary
+}
+
+func summarizeChangePassword(resp *http.Response, body []byte, info *WellKnownInfo) string {
+	if resp.Request.URL.Path != "/.well-known/change-password" {
+		return "Redirects to " + resp.Request.URL.String()
+	}
+	return "Served directly, it should redirect to the password change page"
+}
+
+func summarizeAppleAppSiteAssociation(resp *http.Response, body []byte, info *WellKnownInfo) string {
+	var aasa struct {
+		Applinks struct {
+			Details []struct {
+				AppID  string   `json:"appID"`
+				AppIDs []string `json:"appIDs"`
+			} `json:"details"`
+		} `json:"applinks"`
+		Webcredentials struct {
+			Apps []string `json:"apps"`
+		} `json:"webcredentials"`
+	}
+	if json.Unmarshal(body, &aasa) != nil {
+		return "Not valid JSON"
+	}
+	var apps []string
+	for _, detail := range aasa.Applinks.Details {
+		if detail.AppID != "" {
+			apps = append(apps, detail.AppID)
+		}
+		apps = append(apps, detail.AppIDs...)
+	}
+	apps = append(apps, aasa.Webcredentials.Apps...)
+	if len(apps) > 0 {
+		info.Technologies = append(info.Technologies, "iOS app")
+	}
+	return "iOS apps: " + strings.Join(uniqueStrings(apps), ", ")
+}
+
+func summarizeAssetLinks(resp *http.Response, body []byte, info *WellKnownInfo) string {
+	var links []struct {
+		Target struct {
+			Namespace   string `json:"namespace"`
+			PackageName string `json:"package_name"`
+			Site        string `json:"site"`
+		} `json:"target"`
+	}
+	if json.Unmarshal(body, &links) != nil {
+		return "Not valid JSON"
+	}
+	var packages []string
+	for _, link := range links {
+		if link.Target.PackageName != "" {
+			packages = append(packages, link.Target.PackageName)
+		}
+	}
+	if len(packages) > 0 {
+		info.Technologies = append(info.Technologies, "Android app")
+	}
+	return "Android apps: " + strings.Join(uniqueStrings(packages), ", ")
+}
+
+// fieldName restores the canonical spelling of a lowercased security.txt field, e.g. Preferred-Languages
+func fieldName(field string) string {
+	if field == "csaf" {
+		return "CSAF"
+	}
+	parts := strings.Split(field, "-")
+	for i, part := range parts {
+		parts[i] = strings.ToUpper(part[:1]) + part[1:]
+	}
+	return strings.Join(parts, "-")
+}
+
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// InspectWellKnown fetches security.txt, robots.txt, the sitemaps and the other well-known resources of a domain
+func InspectWellKnown(domain string) (*WellKnownInfo, error) {
+	baseURL, err := CheckURL(domain)
+	if err != nil {
+		return nil, err
+	}
+	client := newWellKnownClient()
+	info := &WellKnownInfo{BaseURL: baseURL}
+
+	// RFC 9116 requires HTTPS and allows /security.txt as a legacy location
+	for _, location := range []string{"https://" + domain + "/.well-known/security.txt", "https://" + domain + "/security.txt", "http://" + domain + "/.well-known/security.txt"} {
+		resp, body, err := fetchWellKnown(client, location)
+		if err != nil || resp.StatusCode != http.StatusOK || len(body) == 0 || strings.Contains(strings.ToLower(resp.Header.Get("Content-Type")), "html") {
+			continue
+		}
+		info.SecurityTxt = ParseSecurityTxt(string(body), location)
+		info.SecurityTxt.ContentType = resp.Header.Get("Content-Type")
+		if !strings.HasPrefix(strings.ToLower(info.SecurityTxt.ContentType), "text/plain") {
+			info.SecurityTxt.Issues = append(info.SecurityTxt.Issues, "Content-Type is "+info.SecurityTxt.ContentType+", it must be text/plain")
+		}
+		if strings.HasPrefix(location, "http://") {
+			info.SecurityTxt.Issues = append(info.SecurityTxt.Issues, "Only available over HTTP, it must be served over HTTPS")
+		} else if !strings.Contains(location, "/.well-known/") {
+			info.SecurityTxt.Issues = append(info.SecurityTxt.Issues, "Only found at the legacy /security.txt location")
+		}
+		info.SecurityContacts = info.SecurityTxt.Fields["contact"]
+		break
+	}
+
+	sitemaps := []string{baseURL + "/sitemap.xml"}
+	if resp, body, err := fetchWellKnown(client, baseURL+"/robots.txt"); err == nil && resp.StatusCode == http.StatusOK {
+		var robotsSitemaps []string
+		info.Disallowed, robotsSitemaps = ParseRobots(string(body))
+		if len(robotsSitemaps) > 0 {
+			sitemaps = robotsSitemaps
+		}
+	}
+	info.Sitemaps = sitemaps
+	pages := readSitemaps(client, sitemaps)
+	info.SitemapURLs = len(pages)
+
+	paths := append([]string{}, info.Disallowed...)
+	for _, page := range pages {
+		if u, err := url.Parse(page); err == nil {
+			paths = append(paths, u.Path)
+		}
+	}
+	for _, path := range uniqueStrings(paths) {
+		if interestingPathPattern.MatchString(path) {
+			info.Interesting = append(info.Interesting, path)
+		}
+		for marker, technology := range robotsTechnologies {
+			if strings.HasPrefix(strings.ToLower(path), strings.ToLower(marker)) {
+				info.Technologies = append(info.Technologies, technology)
+			}
+		}
+	}
+
+	for _, probe := range wellKnownProbes {
+		resp, body, err := fetchWellKnown(client, baseURL+"/.well-known/"+probe.Name)
+		if err != nil {
+			continue
+		}
+		resource := WellKnownResource{Path: "/.well-known/" + probe.Name, Status: resp.StatusCode}
+		// change-password is expected to end at an HTML page, the others are JSON documents
+		if resp.StatusCode == http.StatusOK && (probe.Name == "change-password" || !strings.Contains(strings.ToLower(resp.Header.Get("Content-Type")), "html")) {
+			resource.Summary = probe.Summarize(resp, body, info)
+		}
+		info.Resources = append(info.Resources, resource)
+	}
+
+	info.Technologies = uniqueStrings(info.Technologies)
+	sort.Strings(info.Technologies)
+	return info, nil
+}
+
+// GetWellKnownReport renders security.txt, robots.txt, sitemap and well-known findings for a domain
+func GetWellKnownReport(domain string) (string, error) {
+	info, err := InspectWellKnown(domain)
+	if err != nil {
+		return "", err
+	}
+	bold := color.New(color.FgYellow, color.Bold)
+
+	var sb strings.Builder
+	sb.WriteString(bold.Sprintf("\nWell-Known Resources for %s\n", domain))
+
+	sb.WriteString(bold.Sprint("\nsecurity.txt:\n"))
+	if info.SecurityTxt == nil {
+		sb.WriteString(color.RedString("  Not found, publish /.well-known/security.txt with Contact and Expires (RFC 9116)\n"))
+	} else {
+		txt := info.SecurityTxt
+		sb.WriteString(fmt.Sprintf("  URL: %s\n", txt.URL))
+		for _, field := range []string{"contact", "expires", "encryption", "policy", "acknowledgments", "preferred-languages", "canonical", "hiring", "csaf"} {
+			for _, value := range txt.Fields[field] {
+				sb.WriteString(fmt.Sprintf("  %s: %s\n", fieldName(field), value))
+			}
+		}
+		if txt.Signed {
+			sb.WriteString("  Signed: yes\n")
+		} else {
+			sb.WriteString("  Signed: no, signing with OpenPGP is recommended\n")
+		}
+		for _, issue := range txt.Issues {
+			sb.WriteString(color.RedString("  - %s\n", issue))
+		}
+		if len(txt.Issues) == 0 {
+			sb.WriteString(color.GreenString("  Valid\n"))
+		}
+	}
+	if len(info.SecurityContacts) > 0 {
+		sb.WriteString(fmt.Sprintf("%s %s\n", bold.Sprint("Disclosure Contact:"), strings.Join(info.SecurityContacts, ", ")))
+	}
+
+	sb.WriteString(bold.Sprint("\nrobots.txt and sitemaps:\n"))
+	sb.WriteString(fmt.Sprintf("  Disallowed paths: %d\n", len(info.Disallowed)))
+	sb.WriteString(fmt.Sprintf("  Sitemaps: %s (%d URLs)\n", strings.Join(info.Sitemaps, ", "), info.SitemapURLs))
+	if len(info.Interesting) > 0 {
+		sb.WriteString("  Interesting paths:\n")
+		for _, path := range info.Interesting {
+			sb.WriteString(color.YellowString("    %s\n", path))
+		}
+	}
+
+	sb.WriteString(bold.Sprint("\nOther /.well-known/ resources:\n"))
+	table := tablewriter.NewWriter(&sb)
+	table.SetHeader([]string{"Path", "Status", "Details"})
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	for _, resource := range info.Resources {
+		status := fmt.Sprintf("%d", resource.Status)
+		if resource.Summary != "" {
+			status = color.GreenString(status)
+		}
+		table.Append([]string{resource.Path, status, resource.Summary})
+	}
+	table.Render()
+
+	if len(info.Technologies) > 0 {
+		sb.WriteString(fmt.Sprintf("%s %s\n", bold.Sprint("Technologies:"), strings.Join(info.Technologies, ", ")))
+	}
+	return sb.String(), nil
+}